@@ -0,0 +1,149 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HubFailoverPhase contains the phase of the hub failover
+type HubFailoverPhase string
+
+const (
+	// HubFailoverPhaseRunning means the failover steps are running
+	HubFailoverPhaseRunning HubFailoverPhase = "Running"
+	// HubFailoverPhaseCompleted means all failover steps completed and this hub is the active hub
+	HubFailoverPhaseCompleted HubFailoverPhase = "Completed"
+	// HubFailoverPhaseFailed means a failover step failed; the failover stops at this step
+	HubFailoverPhaseFailed HubFailoverPhase = "Failed"
+)
+
+// HubFailoverStepName is the name of a hub failover step
+type HubFailoverStepName string
+
+const (
+	// HubFailoverStepStopOldHubBackupSchedule removes the BackupSchedule resources from the old hub
+	HubFailoverStepStopOldHubBackupSchedule HubFailoverStepName = "StopOldHubBackupSchedule"
+	// HubFailoverStepPassiveRestore restores the credentials and resources, skipping the managed clusters
+	HubFailoverStepPassiveRestore HubFailoverStepName = "PassiveRestore"
+	// HubFailoverStepActivationRestore restores the managed clusters
+	HubFailoverStepActivationRestore HubFailoverStepName = "ActivationRestore"
+	// HubFailoverStepWaitManagedClustersAvailable waits for the restored managed clusters to connect to this hub
+	HubFailoverStepWaitManagedClustersAvailable HubFailoverStepName = "WaitManagedClustersAvailable"
+	// HubFailoverStepCreateBackupSchedule creates the BackupSchedule on this hub
+	HubFailoverStepCreateBackupSchedule HubFailoverStepName = "CreateBackupSchedule"
+)
+
+// HubFailoverStepPhase contains the phase of a hub failover step
+type HubFailoverStepPhase string
+
+const (
+	// HubFailoverStepPhasePending means the step didn't start
+	HubFailoverStepPhasePending HubFailoverStepPhase = "Pending"
+	// HubFailoverStepPhaseRunning means the step is running
+	HubFailoverStepPhaseRunning HubFailoverStepPhase = "Running"
+	// HubFailoverStepPhaseCompleted means the step completed
+	HubFailoverStepPhaseCompleted HubFailoverStepPhase = "Completed"
+	// HubFailoverStepPhaseSkipped means the step was not run
+	HubFailoverStepPhaseSkipped HubFailoverStepPhase = "Skipped"
+	// HubFailoverStepPhaseFailed means the step failed
+	HubFailoverStepPhaseFailed HubFailoverStepPhase = "Failed"
+)
+
+// HubFailoverSpec defines the desired state of HubFailover
+type HubFailoverSpec struct {
+	// OldHubKubeconfigSecret is the name of a secret from the HubFailover namespace,
+	// with a kubeconfig key used to connect to the old hub and remove its BackupSchedule resources.
+	// If not set, the BackupSchedule resources must be removed from the old hub before the failover
+	// +kubebuilder:validation:Optional
+	OldHubKubeconfigSecret string `json:"oldHubKubeconfigSecret,omitempty"`
+	// ManagedClustersTimeout is how long to wait for the restored managed clusters
+	// to connect to this hub. Defaults to 1h
+	// +kubebuilder:validation:Optional
+	ManagedClustersTimeout metav1.Duration `json:"managedClustersTimeout,omitempty"`
+	// BackupSchedule defines the BackupSchedule created on this hub once the failover completes
+	// +kubebuilder:validation:Required
+	BackupSchedule BackupScheduleSpec `json:"backupSchedule"`
+}
+
+// HubFailoverStep is the status of a hub failover step
+type HubFailoverStep struct {
+	// Name of the step
+	Name HubFailoverStepName `json:"name"`
+	// Phase of the step
+	Phase HubFailoverStepPhase `json:"phase"`
+	// Message on the last operation of the step
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+	// StartTime is the time the step started
+	// +kubebuilder:validation:Optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time the step completed, was skipped or failed
+	// +kubebuilder:validation:Optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// HubFailoverStatus defines the observed state of HubFailover
+type HubFailoverStatus struct {
+	// Phase is the current phase of the hub failover
+	// +kubebuilder:validation:Optional
+	Phase HubFailoverPhase `json:"phase"`
+	// Message on the last operation
+	// +kubebuilder:validation:Optional
+	LastMessage string `json:"lastMessage"`
+	// Steps lists the failover steps, in the order they are run
+	// +kubebuilder:validation:Optional
+	Steps []HubFailoverStep `json:"steps,omitempty"`
+	// PassiveRestoreName is the name of the Restore restoring the credentials and resources
+	// +kubebuilder:validation:Optional
+	PassiveRestoreName string `json:"passiveRestoreName,omitempty"`
+	// ActivationRestoreName is the name of the Restore restoring the managed clusters
+	// +kubebuilder:validation:Optional
+	ActivationRestoreName string `json:"activationRestoreName,omitempty"`
+	// BackupScheduleName is the name of the BackupSchedule created on this hub
+	// +kubebuilder:validation:Optional
+	BackupScheduleName string `json:"backupScheduleName,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:validation:Optional
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName={"hfo"}
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Message",type=string,JSONPath=`.status.lastMessage`
+
+// HubFailover is the Schema for the hub failovers API
+type HubFailover struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HubFailoverSpec   `json:"spec,omitempty"`
+	Status HubFailoverStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// HubFailoverList contains a list of hub failovers
+type HubFailoverList struct {
+	metav1.TypeMeta `              json:",inline"`
+	metav1.ListMeta `              json:"metadata,omitempty"`
+	Items           []HubFailover `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HubFailover{}, &HubFailoverList{})
+}
@@ -17,7 +17,10 @@ limitations under the License.
 package v1beta1
 
 import (
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // RestorePhase contains the phase of the restore
@@ -36,6 +39,81 @@ const (
 	RestorePhaseError = "Error"
 	// RestorePhaseUnknown means the restore is in unknown phase
 	RestorePhaseUnknown = "Unknown"
+	// RestorePhaseEnabled means the restore finished and keeps restoring new backups
+	RestorePhaseEnabled = "Enabled"
+)
+
+// ConflictPolicy defines how a restore handles resources already existing on the hub
+type ConflictPolicy string
+
+const (
+	// ConflictPolicySkip leaves the existing resources untouched
+	ConflictPolicySkip ConflictPolicy = "skip"
+	// ConflictPolicyUpdate overwrites the existing resources with the backed up version
+	ConflictPolicyUpdate ConflictPolicy = "update"
+	// ConflictPolicyFail stops the restore if any backed up resource already exists
+	ConflictPolicyFail ConflictPolicy = "fail"
+)
+
+// ConflictAction is the action taken for a resource already existing on the hub
+type ConflictAction string
+
+const (
+	// ConflictActionSkipped means the existing resource was left untouched
+	ConflictActionSkipped ConflictAction = "Skipped"
+	// ConflictActionOverwritten means the existing resource was replaced with the backed up version
+	ConflictActionOverwritten ConflictAction = "Overwritten"
+	// ConflictActionFailed means the existing resource stopped the restore
+	ConflictActionFailed ConflictAction = "Failed"
+)
+
+// CleanupType defines the cleanup of hub resources not saved by the restored backups
+type CleanupType string
+
+const (
+	// CleanupTypeNone doesn't remove any hub resource
+	CleanupTypeNone CleanupType = "None"
+	// CleanupTypePreview lists the hub resources to be removed, without removing them
+	CleanupTypePreview CleanupType = "Preview"
+	// CleanupTypeDelete removes the hub resources before the Velero restores are created
+	CleanupTypeDelete CleanupType = "Delete"
+)
+
+// ManagedClusterActivationPhase is the reconnection phase of a restored managed cluster
+type ManagedClusterActivationPhase string
+
+const (
+	// ManagedClusterActivationPending means the managed cluster is not connected to the hub yet
+	ManagedClusterActivationPending ManagedClusterActivationPhase = "Pending"
+	// ManagedClusterActivationAvailable means the managed cluster is connected to the hub
+	ManagedClusterActivationAvailable ManagedClusterActivationPhase = "Available"
+	// ManagedClusterActivationFailed means the managed cluster did not connect to the hub in time
+	ManagedClusterActivationFailed ManagedClusterActivationPhase = "Failed"
+)
+
+// RestoreHookStage is the stage of the restore when a hook runs
+type RestoreHookStage string
+
+const (
+	// RestoreHookStagePre runs the hook before the velero restore is created
+	RestoreHookStagePre RestoreHookStage = "PreRestore"
+	// RestoreHookStagePost runs the hook after the velero restore has run to completion
+	RestoreHookStagePost RestoreHookStage = "PostRestore"
+)
+
+// RestoreHookPhase is the phase of a restore hook
+type RestoreHookPhase string
+
+const (
+	// RestoreHookPhaseRunning means the hook job is running
+	RestoreHookPhaseRunning RestoreHookPhase = "Running"
+	// RestoreHookPhaseSucceeded means the hook job completed successfully
+	RestoreHookPhaseSucceeded RestoreHookPhase = "Succeeded"
+	// RestoreHookPhaseFailed means the hook job failed
+	RestoreHookPhaseFailed RestoreHookPhase = "Failed"
+	// RestoreHookPhaseAttached means the velero restore hook was added to the velero restore,
+	// velero runs it on the restored pods
+	RestoreHookPhaseAttached RestoreHookPhase = "Attached"
 )
 
 // RestoreSpec defines the desired state of Restore
@@ -58,6 +136,166 @@ type RestoreSpec struct {
 	// backup_name points to the name of the backup to be restored
 	// +kubebuilder:validation:Required
 	VeleroCredentialsBackupName *string `json:"veleroCredentialsBackupName"`
+	// ConflictPolicy defines how backed up resources already existing on the hub are handled,
+	// for the resource types managed by the operator.
+	// Valid values are skip, update or fail. skip leaves the existing resources untouched,
+	// update overwrites them with the backed up version and fail stops the restore if any resource exists.
+	// If not set, the existing resources are left untouched and not reported
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=skip;update;fail
+	ConflictPolicy ConflictPolicy `json:"conflictPolicy,omitempty"`
+	// CleanupBeforeRestore defines how hub resources not saved by the restored resources backup are handled.
+	// Only resources of the kinds backed up by the resources backup are considered.
+	// Valid values are None, Preview or Delete. None leaves the resources untouched,
+	// Preview lists them in the restore status and Delete removes them before the Velero restores are created.
+	// Resources with the cluster.open-cluster-management.io/skip-restore-cleanup label are never removed.
+	// Defaults to None
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=None;Preview;Delete
+	CleanupBeforeRestore CleanupType `json:"cleanupBeforeRestore,omitempty"`
+	// SyncRestoreWithNewBackups keeps the restore running after the Velero restores are completed,
+	// restoring the credentials and resources of new backups, as in a passive hub configuration.
+	// Requires veleroCredentialsBackupName and veleroResourcesBackupName set to latest
+	// and veleroManagedClustersBackupName set to skip. Setting veleroManagedClustersBackupName to latest
+	// activates the managed clusters and stops the sync
+	// +kubebuilder:validation:Optional
+	SyncRestoreWithNewBackups bool `json:"syncRestoreWithNewBackups,omitempty"`
+	// RestoreSyncInterval is the interval used to look for new backups when syncRestoreWithNewBackups is set.
+	// Defaults to 30m
+	// +kubebuilder:validation:Optional
+	RestoreSyncInterval metav1.Duration `json:"restoreSyncInterval,omitempty"`
+	// SourceHub restricts the restored backups to the ones produced by this hub, identified by the
+	// cluster.open-cluster-management.io/backup-cluster label set on the backups.
+	// Applies to the latest backups and to the backups restored by name.
+	// If not set, backups produced by any hub are restored
+	// +kubebuilder:validation:Optional
+	SourceHub string `json:"sourceHub,omitempty"`
+	// StorageLocation is the name of the velero BackupStorageLocation from where the backups are restored.
+	// If not set, the first available storage location created by the OADP operator is validated
+	// and the latest backups are looked up among the backups of the primary velero schedules
+	// +kubebuilder:validation:Optional
+	StorageLocation string `json:"storageLocation,omitempty"`
+	// CredentialsEncryption references the key used to decrypt the restored credentials,
+	// when the backups were created with credentials encryption
+	// +kubebuilder:validation:Optional
+	CredentialsEncryption *CredentialsEncryption `json:"credentialsEncryption,omitempty"`
+	// Hooks are run before and after each velero restore created by this restore
+	// +kubebuilder:validation:Optional
+	Hooks *RestoreHooks `json:"hooks,omitempty"`
+	// Transforms patch the restored resources once the velero restore restoring them has run to completion,
+	// for example to replace values specific to the hub where the backups were taken
+	// +kubebuilder:validation:Optional
+	Transforms []RestoreTransform `json:"transforms,omitempty"`
+	// SkipDefaultTransforms disables the transforms applied by default to the restored ACM resources
+	// +kubebuilder:validation:Optional
+	SkipDefaultTransforms bool `json:"skipDefaultTransforms,omitempty"`
+	// VeleroRestoreTimeout is the time a velero restore can stay new or in progress, after which
+	// the restore reports an Error phase. With the Report policy, the restore reports the phase of
+	// the velero restores again if they complete. If not set, the velero restores never time out
+	// +kubebuilder:validation:Optional
+	VeleroRestoreTimeout *metav1.Duration `json:"veleroRestoreTimeout,omitempty"`
+	// StuckRestorePolicy is the action taken on a velero restore running for longer than veleroRestoreTimeout:
+	// Report annotates the velero restore, Delete deletes it and stops the restore. Velero can't cancel
+	// a restore, the resources already restored are kept and velero may keep restoring resources.
+	// Defaults to Report
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Report;Delete
+	StuckRestorePolicy StuckOperationPolicy `json:"stuckRestorePolicy,omitempty"`
+	// RetryPolicy creates again the velero restores which failed validation or failed,
+	// keeping the velero restores which succeeded. If not set, a failed velero restore stops the restore
+	// +kubebuilder:validation:Optional
+	RetryPolicy *RestoreRetryPolicy `json:"retryPolicy,omitempty"`
+	// RunHistoryLimit is the number of previous runs of the restore kept in the restore status, with their
+	// velero restores. A new run starts when the spec is updated or the
+	// cluster.open-cluster-management.io/rerun annotation is set to a new value. Defaults to 3
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	RunHistoryLimit *int `json:"runHistoryLimit,omitempty"`
+	// ManagedClusterActivationTimeout is the time the restored managed clusters have to connect to this hub
+	// once the managed clusters backup is restored, after which their activation is reported as Failed.
+	// Defaults to 1h
+	// +kubebuilder:validation:Optional
+	ManagedClusterActivationTimeout *metav1.Duration `json:"managedClusterActivationTimeout,omitempty"`
+}
+
+// RestoreRetryPolicy defines how the failed velero restores are created again
+type RestoreRetryPolicy struct {
+	// MaxAttempts is the max number of times a velero restore is run, including the first attempt.
+	// Defaults to 3
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// Backoff is the time to wait after a velero restore failed before the first retry,
+	// doubled for each following retry up to 1h. Defaults to 1m
+	// +kubebuilder:validation:Optional
+	Backoff metav1.Duration `json:"backoff,omitempty"`
+}
+
+// RestoreTransform patches the restored resources of a kind
+type RestoreTransform struct {
+	// APIVersion of the patched resources, as group/version
+	// +kubebuilder:validation:Required
+	APIVersion string `json:"apiVersion"`
+	// Kind of the patched resources
+	// +kubebuilder:validation:Required
+	Kind string `json:"kind"`
+	// Patches are the JSON patch operations applied to each restored resource of this kind.
+	// remove and replace operations are skipped if the path doesn't exist on the resource
+	// +kubebuilder:validation:Required
+	Patches []JSONPatchOperation `json:"patches"`
+}
+
+// JSONPatchOperation is a JSON patch operation, as defined by RFC 6902
+type JSONPatchOperation struct {
+	// Op is the operation, one of add, remove, replace, move, copy or test
+	// +kubebuilder:validation:Enum=add;remove;replace;move;copy;test
+	Op string `json:"op"`
+	// Path is the JSON pointer to the patched value
+	Path string `json:"path"`
+	// From is the JSON pointer to the value moved or copied
+	// +kubebuilder:validation:Optional
+	From string `json:"from,omitempty"`
+	// Value used by the add, replace and test operations. ${HUB_API_SERVER_URL} is replaced
+	// with the API server URL of this hub
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Value *runtime.RawExtension `json:"value,omitempty"`
+}
+
+// RestoreHooks are the actions run before and after the velero restores
+type RestoreHooks struct {
+	// PreRestore hooks run before the velero restores are created,
+	// no velero restore is created until they all succeed
+	// +kubebuilder:validation:Optional
+	PreRestore []RestoreHook `json:"preRestore,omitempty"`
+	// PostRestore hooks run once the velero restore they apply to has run to completion
+	// +kubebuilder:validation:Optional
+	PostRestore []RestoreHook `json:"postRestore,omitempty"`
+}
+
+// RestoreHook is a Job run on the hub or a velero restore hook, set for the velero restores
+// of the selected resource types. Exactly one of job or veleroHook must be set
+type RestoreHook struct {
+	// Name of the hook, unique within the restore hooks
+	Name string `json:"name"`
+	// ResourceTypes are the types of the velero restores the hook applies to, such as
+	// managedClusters, credentials, credentialsHive, credentialsCluster, resources or resourcesGeneric.
+	// If not set, the hook applies to all velero restores
+	// +kubebuilder:validation:Optional
+	ResourceTypes []string `json:"resourceTypes,omitempty"`
+	// Job is the template of the Job run in the restore namespace for each velero restore,
+	// with the restore-hooks service account
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Job *batchv1.JobTemplateSpec `json:"job,omitempty"`
+	// VeleroHook is added to the hooks of the velero restores and run by velero on the restored pods.
+	// Only allowed for postRestore hooks
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	VeleroHook *veleroapi.RestoreResourceHookSpec `json:"veleroHook,omitempty"`
 }
 
 // RestoreStatus defines the observed state of Restore
@@ -74,6 +312,203 @@ type RestoreStatus struct {
 	// Message on the last operation
 	// +kubebuilder:validation:Optional
 	LastMessage string `json:"lastMessage"`
+	// VeleroRestoreResults contains the warnings and errors reported by each finished Velero restore
+	// +kubebuilder:validation:Optional
+	VeleroRestoreResults []VeleroRestoreResult `json:"veleroRestoreResults,omitempty"`
+	// ConflictingResources lists the backed up resources found on the hub before the restore,
+	// with the action taken according to the conflict policy
+	// +kubebuilder:validation:Optional
+	ConflictingResources []ConflictingResource `json:"conflictingResources,omitempty"`
+	// CleanupPreview lists the hub resources not saved by the restored resources backup,
+	// removed before the restore if cleanupBeforeRestore is Delete
+	// +kubebuilder:validation:Optional
+	CleanupPreview []string `json:"cleanupPreview,omitempty"`
+	// HubAPIServerURL is the API server URL of this hub, used to reconnect the restored managed clusters
+	// +kubebuilder:validation:Optional
+	HubAPIServerURL string `json:"hubAPIServerURL,omitempty"`
+	// ManagedClusterActivations reports the reconnection status of each restored managed cluster
+	// +kubebuilder:validation:Optional
+	ManagedClusterActivations []ManagedClusterActivation `json:"managedClusterActivations,omitempty"`
+	// SourceHubs lists the hubs which produced the backups found in the storage location
+	// +kubebuilder:validation:Optional
+	SourceHubs []string `json:"sourceHubs,omitempty"`
+	// StorageLocation reports the validation status of the velero storage location used by the restore
+	// +kubebuilder:validation:Optional
+	StorageLocation *StorageLocationStatus `json:"storageLocation,omitempty"`
+	// PreflightChecks are the results of the checks run before creating the velero restores
+	// +kubebuilder:validation:Optional
+	PreflightChecks []PreflightCheck `json:"preflightChecks,omitempty"`
+	// Hooks reports the outcome of each restore hook, for each velero restore it applies to
+	// +kubebuilder:validation:Optional
+	Hooks []RestoreHookStatus `json:"hooks,omitempty"`
+	// TransformResults reports the restored resources patched by the transforms, for each velero restore
+	// +kubebuilder:validation:Optional
+	TransformResults []RestoreTransformResult `json:"transformResults,omitempty"`
+	// Progress reports the items restored by the velero restores
+	// +kubebuilder:validation:Optional
+	Progress *RestoreProgress `json:"progress,omitempty"`
+	// TimedOutVeleroRestores lists the velero restores which ran for longer than veleroRestoreTimeout
+	// +kubebuilder:validation:Optional
+	TimedOutVeleroRestores []string `json:"timedOutVeleroRestores,omitempty"`
+	// VeleroRestoreAttempts is the history of the velero restores run with the retry policy
+	// +kubebuilder:validation:Optional
+	VeleroRestoreAttempts []VeleroRestoreAttempt `json:"veleroRestoreAttempts,omitempty"`
+	// Run is the number of the current run of the restore, starting from 1
+	// +kubebuilder:validation:Optional
+	Run int `json:"run,omitempty"`
+	// ObservedGeneration is the generation of the restore spec used by the current run
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ObservedRerun is the value of the cluster.open-cluster-management.io/rerun annotation
+	// when the current run started
+	// +kubebuilder:validation:Optional
+	ObservedRerun string `json:"observedRerun,omitempty"`
+	// PreviousRuns reports the outcome of the previous runs of the restore, the latest last
+	// +kubebuilder:validation:Optional
+	PreviousRuns []RestoreRun `json:"previousRuns,omitempty"`
+}
+
+// RestoreRun is the outcome of a previous run of the restore
+type RestoreRun struct {
+	// Run is the number of the run
+	Run int `json:"run"`
+	// Generation is the generation of the restore spec used by the run
+	// +kubebuilder:validation:Optional
+	Generation int64 `json:"generation,omitempty"`
+	// Phase is the last phase of the run
+	// +kubebuilder:validation:Optional
+	Phase RestorePhase `json:"phase,omitempty"`
+	// LastMessage is the last message of the run
+	// +kubebuilder:validation:Optional
+	LastMessage string `json:"lastMessage,omitempty"`
+	// VeleroRestores lists the velero restores created by the run
+	// +kubebuilder:validation:Optional
+	VeleroRestores []string `json:"veleroRestores,omitempty"`
+	// EndTime is the time a new run replaced this run
+	// +kubebuilder:validation:Optional
+	EndTime *metav1.Time `json:"endTime,omitempty"`
+}
+
+// VeleroRestoreAttempt is an attempt to restore a backup with a velero restore
+type VeleroRestoreAttempt struct {
+	// VeleroRestoreName is the name of the velero restore run for this attempt
+	VeleroRestoreName string `json:"veleroRestoreName"`
+	// BackupName is the name of the restored velero backup
+	BackupName string `json:"backupName"`
+	// Attempt is the number of the attempt, starting from 1
+	Attempt int `json:"attempt"`
+	// Phase of the velero restore
+	// +kubebuilder:validation:Optional
+	Phase veleroapi.RestorePhase `json:"phase,omitempty"`
+	// FailureReason reports why the velero restore failed
+	// +kubebuilder:validation:Optional
+	FailureReason string `json:"failureReason,omitempty"`
+	// CompletionTime is the time the velero restore completed or failed
+	// +kubebuilder:validation:Optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// RestoreProgress aggregates the progress reported by the velero restores; velero updates
+// its progress on a best-effort basis, so it is an estimate
+type RestoreProgress struct {
+	// TotalItems is the number of items to be restored by the velero restores
+	// +kubebuilder:validation:Optional
+	TotalItems int `json:"totalItems,omitempty"`
+	// ItemsRestored is the number of items restored so far
+	// +kubebuilder:validation:Optional
+	ItemsRestored int `json:"itemsRestored,omitempty"`
+	// Percentage of the items restored so far
+	// +kubebuilder:validation:Optional
+	Percentage int `json:"percentage,omitempty"`
+	// EstimatedTimeRemaining is the time left to restore the remaining items, at the rate
+	// the items were restored so far
+	// +kubebuilder:validation:Optional
+	EstimatedTimeRemaining *metav1.Duration `json:"estimatedTimeRemaining,omitempty"`
+	// LastReportTime is the time of the last progress event
+	// +kubebuilder:validation:Optional
+	LastReportTime *metav1.Time `json:"lastReportTime,omitempty"`
+}
+
+// RestoreTransformResult reports the transforms applied to the resources restored by a velero restore
+type RestoreTransformResult struct {
+	// VeleroRestoreName is the name of the velero restore
+	VeleroRestoreName string `json:"veleroRestoreName"`
+	// Patched is the number of restored resources patched by the transforms
+	// +kubebuilder:validation:Optional
+	Patched int `json:"patched,omitempty"`
+	// Errors lists the restored resources which could not be patched
+	// +kubebuilder:validation:Optional
+	Errors []string `json:"errors,omitempty"`
+}
+
+// RestoreHookStatus is the outcome of a restore hook for a velero restore
+type RestoreHookStatus struct {
+	// Name of the hook
+	Name string `json:"name"`
+	// Stage of the hook
+	Stage RestoreHookStage `json:"stage"`
+	// VeleroRestoreName is the name of the velero restore the hook ran for
+	VeleroRestoreName string `json:"veleroRestoreName"`
+	// JobName is the name of the Job created for the hook
+	// +kubebuilder:validation:Optional
+	JobName string `json:"jobName,omitempty"`
+	// Phase of the hook
+	Phase RestoreHookPhase `json:"phase"`
+	// Message on the last hook operation
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+	// CompletionTime is the time the hook job completed or failed
+	// +kubebuilder:validation:Optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// ConflictingResource is a backed up resource already existing on the hub
+type ConflictingResource struct {
+	// Kind is the group, version and kind of the resource
+	Kind string `json:"kind"`
+	// Namespace of the resource, empty for cluster scoped resources
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+	// Name of the resource
+	Name string `json:"name"`
+	// Action taken for the resource
+	Action ConflictAction `json:"action"`
+}
+
+// ManagedClusterActivation is the reconnection status of a restored managed cluster
+type ManagedClusterActivation struct {
+	// Name of the managed cluster
+	Name string `json:"name"`
+	// HiveProvisioned is true for clusters created by hive, which are reconnected by hive
+	// +kubebuilder:validation:Optional
+	HiveProvisioned bool `json:"hiveProvisioned,omitempty"`
+	// ImportSecretRegenerated is true once the restored import secret of an imported cluster
+	// was removed, so that the import controller regenerates it for this hub
+	// +kubebuilder:validation:Optional
+	ImportSecretRegenerated bool `json:"importSecretRegenerated,omitempty"`
+	// Phase is the reconnection phase of the managed cluster
+	Phase ManagedClusterActivationPhase `json:"phase"`
+	// Message on the last activation step
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+}
+
+// VeleroRestoreResult summarizes the warnings and errors reported by a Velero restore
+type VeleroRestoreResult struct {
+	// VeleroRestoreName is the name of the Velero restore
+	VeleroRestoreName string `json:"veleroRestoreName"`
+	// Warnings is the number of warnings reported by the Velero restore
+	// +kubebuilder:validation:Optional
+	Warnings int `json:"warnings,omitempty"`
+	// Errors is the number of errors reported by the Velero restore
+	// +kubebuilder:validation:Optional
+	Errors int `json:"errors,omitempty"`
+	// FailureReason is the error that caused the entire Velero restore to fail
+	// +kubebuilder:validation:Optional
+	FailureReason string `json:"failureReason,omitempty"`
+	// Summary of the detailed Velero restore results, grouped by namespace and resource kind
+	// +kubebuilder:validation:Optional
+	Summary []string `json:"summary,omitempty"`
 }
 
 // +kubebuilder:object:root=true
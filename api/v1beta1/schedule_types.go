@@ -41,6 +41,52 @@ const (
 	// SchedulePhaseUnknown means the schedule has been processed by
 	// the ScheduleController but there are some unknown issues
 	SchedulePhaseUnknown SchedulePhase = "Unknown"
+	// SchedulePhaseBackupCollision means backups from another hub were found in the
+	// storage location; the schedule stopped producing backups until its spec is updated
+	SchedulePhaseBackupCollision SchedulePhase = "BackupCollision"
+)
+
+// RestoreTestPhase is the phase of a test restore
+type RestoreTestPhase string
+
+const (
+	// RestoreTestPhaseRunning means the test restore is running
+	RestoreTestPhaseRunning RestoreTestPhase = "Running"
+	// RestoreTestPhasePassed means all the velero restores of the test completed
+	RestoreTestPhasePassed RestoreTestPhase = "Passed"
+	// RestoreTestPhaseFailed means the test restore could not be started or some velero restores failed
+	RestoreTestPhaseFailed RestoreTestPhase = "Failed"
+)
+
+// PreflightCheckStatus is the result of a pre-flight check
+type PreflightCheckStatus string
+
+const (
+	// PreflightCheckPassed means the check passed
+	PreflightCheckPassed PreflightCheckStatus = "Passed"
+	// PreflightCheckWarning means the check found an issue which doesn't prevent the backups or restores
+	PreflightCheckWarning PreflightCheckStatus = "Warning"
+	// PreflightCheckFailed means the check failed; no velero schedule or restore is created
+	PreflightCheckFailed PreflightCheckStatus = "Failed"
+)
+
+// StuckOperationPolicy is the action taken on a velero backup or restore running for longer than its timeout
+type StuckOperationPolicy string
+
+const (
+	// StuckOperationPolicyReport annotates the velero backup or restore and reports it
+	StuckOperationPolicyReport StuckOperationPolicy = "Report"
+	// StuckOperationPolicyDelete deletes the velero backup or restore after reporting it
+	StuckOperationPolicyDelete StuckOperationPolicy = "Delete"
+)
+
+const (
+	// BackupScheduleConditionBackupCollision is true when another hub writes backups
+	// to the same storage location as this schedule
+	BackupScheduleConditionBackupCollision = "BackupCollision"
+	// BackupScheduleConditionBackupVerified is false when the latest completed backups
+	// saved much less resources of a kind than found on the hub
+	BackupScheduleConditionBackupVerified = "BackupVerified"
 )
 
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
@@ -59,6 +105,116 @@ type BackupScheduleSpec struct {
 	// Maximum number of scheduled backups after which the old backups are being removed
 	// +kubebuilder:validation:Required
 	MaxBackups int `json:"maxBackups"`
+	// StorageLocation is the name of the velero BackupStorageLocation where the backups are saved.
+	// If not set, the first available storage location created by the OADP operator is used
+	// +kubebuilder:validation:Optional
+	StorageLocation string `json:"storageLocation,omitempty"`
+	// SecondaryStorageLocations are the names of velero BackupStorageLocations where the hub resources
+	// are also backed up, for example in another region. A set of velero schedules is created for
+	// each secondary location, named after the primary schedules with the location name as suffix.
+	// These schedules run independently from the primary schedules, their backups are not copies of the
+	// primary backups and can save a different content
+	// +kubebuilder:validation:Optional
+	SecondaryStorageLocations []string `json:"secondaryStorageLocations,omitempty"`
+	// RestoreTest periodically restores the configmaps and secrets of the latest backups into
+	// sandbox namespaces, to verify the backups can be restored
+	// +kubebuilder:validation:Optional
+	RestoreTest *RestoreTestSpec `json:"restoreTest,omitempty"`
+	// CredentialsEncryption references the key used to encrypt the backed up credentials.
+	// If set, encrypted copies of the credentials are backed up instead of the credentials
+	// +kubebuilder:validation:Optional
+	CredentialsEncryption *CredentialsEncryption `json:"credentialsEncryption,omitempty"`
+	// Hooks are run before and after the backups, to keep the backed up resources consistent
+	// +kubebuilder:validation:Optional
+	Hooks *BackupHooks `json:"hooks,omitempty"`
+	// VeleroBackupTimeout is the time a velero backup created by the schedules can stay new or in progress,
+	// after which it is considered stuck. If not set, the velero backups never time out
+	// +kubebuilder:validation:Optional
+	VeleroBackupTimeout *metav1.Duration `json:"veleroBackupTimeout,omitempty"`
+	// StuckBackupPolicy is the action taken on a velero backup running for longer than veleroBackupTimeout:
+	// Report annotates the velero backup, Delete requests velero to delete it with its data in the storage
+	// location; velero doesn't delete a backup it is still processing. Defaults to Report
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Report;Delete
+	StuckBackupPolicy StuckOperationPolicy `json:"stuckBackupPolicy,omitempty"`
+}
+
+// BackupHooks are the actions run before and after the backups
+type BackupHooks struct {
+	// PreBackup hooks are run by velero in the selected pods before backing up the resources
+	// +kubebuilder:validation:Optional
+	PreBackup []BackupHook `json:"preBackup,omitempty"`
+	// PostBackup hooks are run by velero in the selected pods after backing up the resources
+	// +kubebuilder:validation:Optional
+	PostBackup []BackupHook `json:"postBackup,omitempty"`
+	// PauseReconcilers are paused shortly before the scheduled backups and while a backup of the schedule
+	// is running, and resumed once no backup is running or due
+	// +kubebuilder:validation:Optional
+	PauseReconcilers []PausedReconciler `json:"pauseReconcilers,omitempty"`
+}
+
+// BackupHook is a command run by velero in the containers of the selected pods,
+// added to the velero backups of the selected resource types
+type BackupHook struct {
+	// Name of the hook, unique within the schedule hooks
+	Name string `json:"name"`
+	// ResourceTypes are the types of the velero backups the hook is added to, such as
+	// managedClusters, credentials, credentialsHive, credentialsCluster, resources or resourcesGeneric.
+	// If not set, the hook is added to all velero backups
+	// +kubebuilder:validation:Optional
+	ResourceTypes []string `json:"resourceTypes,omitempty"`
+	// IncludedNamespaces are the namespaces of the pods running the hook, all namespaces if not set
+	// +kubebuilder:validation:Optional
+	IncludedNamespaces []string `json:"includedNamespaces,omitempty"`
+	// ExcludedNamespaces are the namespaces of the pods not running the hook
+	// +kubebuilder:validation:Optional
+	ExcludedNamespaces []string `json:"excludedNamespaces,omitempty"`
+	// LabelSelector selects the pods running the hook
+	// +kubebuilder:validation:Optional
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+	// Exec is the command run in a container of the selected pods
+	// +kubebuilder:validation:Required
+	Exec veleroapi.ExecHook `json:"exec"`
+}
+
+// PausedReconciler is a resource paused while the backups are running, either scaled down
+// or annotated to pause the controller reconciling it
+type PausedReconciler struct {
+	// APIVersion of the resource, defaults to apps/v1
+	// +kubebuilder:validation:Optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Kind of the resource, defaults to Deployment; Deployment and StatefulSet resources can be paused,
+	// and MultiClusterHub resources with an annotation
+	// +kubebuilder:validation:Optional
+	Kind string `json:"kind,omitempty"`
+	// Namespace of the resource, one of open-cluster-management, open-cluster-management-hub
+	// or multicluster-engine
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+	// Name of the resource
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+	// Annotation set on the resource to pause its controller, as key=value, for example
+	// mch-pause=true on the MultiClusterHub. If not set, the resource is scaled down to 0 replicas
+	// +kubebuilder:validation:Optional
+	Annotation string `json:"annotation,omitempty"`
+}
+
+// CredentialsEncryption references the secret holding the key used to encrypt the backed up credentials
+type CredentialsEncryption struct {
+	// KeySecretName is the name of the secret holding the encryption key, in the velero namespace
+	// +kubebuilder:validation:Required
+	KeySecretName string `json:"keySecretName"`
+	// KeySecretKey is the key of the secret data holding the encryption key, defaults to key
+	// +kubebuilder:validation:Optional
+	KeySecretKey string `json:"keySecretKey,omitempty"`
+}
+
+// RestoreTestSpec schedules test restores of the latest backups
+type RestoreTestSpec struct {
+	// Schedule is a Cron expression defining when to run the test restores
+	// +kubebuilder:validation:Required
+	Schedule string `json:"schedule"`
 }
 
 // BackupScheduleStatus defines the observed state of BackupSchedule
@@ -78,6 +234,184 @@ type BackupScheduleStatus struct {
 	// Velero Schedule for backing up credentials
 	// +kubebuilder:validation:Optional
 	VeleroScheduleCredentials *veleroapi.Schedule `json:"veleroScheduleCredentials,omitempty"`
+	// Conditions of the schedule, such as BackupCollision
+	// +kubebuilder:validation:Optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// StorageLocation reports the validation status of the velero storage location used by the schedule
+	// +kubebuilder:validation:Optional
+	StorageLocation *StorageLocationStatus `json:"storageLocation,omitempty"`
+	// PreflightChecks are the results of the checks run before creating the velero schedules
+	// +kubebuilder:validation:Optional
+	PreflightChecks []PreflightCheck `json:"preflightChecks,omitempty"`
+	// BackupVerification compares the resources saved by the latest completed backups with the hub resources
+	// +kubebuilder:validation:Optional
+	BackupVerification *BackupVerification `json:"backupVerification,omitempty"`
+	// RestoreTest is the result of the latest test restore
+	// +kubebuilder:validation:Optional
+	RestoreTest *RestoreTestStatus `json:"restoreTest,omitempty"`
+	// CredentialsInventory lists the secrets saved by the credentials backups
+	// +kubebuilder:validation:Optional
+	CredentialsInventory *CredentialsInventory `json:"credentialsInventory,omitempty"`
+	// DependencyReport lists the references from backed up resources to resources which are not backed up
+	// +kubebuilder:validation:Optional
+	DependencyReport *DependencyReport `json:"dependencyReport,omitempty"`
+	// PausedReconcilers lists the resources paused while a backup is running
+	// +kubebuilder:validation:Optional
+	PausedReconcilers []PausedReconciler `json:"pausedReconcilers,omitempty"`
+	// TimedOutVeleroBackups lists the latest velero backups which ran for longer than veleroBackupTimeout
+	// +kubebuilder:validation:Optional
+	TimedOutVeleroBackups []string `json:"timedOutVeleroBackups,omitempty"`
+}
+
+// DependencyReport is the result of the analysis of the references between the backed up resources
+type DependencyReport struct {
+	// BackupTimestamp identifies the latest completed backups when the references were analyzed,
+	// by the timestamp suffix of the backup names
+	// +kubebuilder:validation:Optional
+	BackupTimestamp string `json:"backupTimestamp,omitempty"`
+	// AnalysisTime is the last time the references were analyzed
+	// +kubebuilder:validation:Optional
+	AnalysisTime *metav1.Time `json:"analysisTime,omitempty"`
+	// Resources is the number of analyzed backed up resources
+	// +kubebuilder:validation:Optional
+	Resources int `json:"resources,omitempty"`
+	// References is the number of references found from the analyzed resources
+	// +kubebuilder:validation:Optional
+	References int `json:"references,omitempty"`
+	// DanglingReferences lists the references to resources missing on the hub or not backed up
+	// +kubebuilder:validation:Optional
+	DanglingReferences []DanglingReference `json:"danglingReferences,omitempty"`
+}
+
+// DanglingReference is a reference from a backed up resource which would be broken after a restore
+type DanglingReference struct {
+	// Source is the referencing resource, as kind.group namespace/name
+	Source string `json:"source"`
+	// Target is the referenced resource, as kind.group namespace/name
+	Target string `json:"target"`
+	// Reason is NotFound if the referenced resource doesn't exist on the hub,
+	// NotBackedUp if it is not saved by any backup
+	Reason string `json:"reason"`
+}
+
+// CredentialsInventory reports the secrets matched by the credentials velero schedules,
+// the full list of secrets being saved in the inventory ConfigMap
+type CredentialsInventory struct {
+	// ConfigMapName is the name of the ConfigMap listing the secrets matched by each credentials schedule,
+	// in the BackupSchedule namespace
+	ConfigMapName string `json:"configMapName"`
+	// BackupTimestamp identifies the latest completed backups when the secrets were listed,
+	// by the timestamp suffix of the backup names
+	// +kubebuilder:validation:Optional
+	BackupTimestamp string `json:"backupTimestamp,omitempty"`
+	// UpdateTime is the last time the list of secrets changed
+	// +kubebuilder:validation:Optional
+	UpdateTime *metav1.Time `json:"updateTime,omitempty"`
+	// Schedules are the number of secrets matched by each credentials velero schedule
+	// +kubebuilder:validation:Optional
+	Schedules []CredentialsInventoryCount `json:"schedules,omitempty"`
+	// UnlabeledSecretsCount is the number of secrets which look like credentials but are not saved
+	// by any credentials backup
+	// +kubebuilder:validation:Optional
+	UnlabeledSecretsCount int `json:"unlabeledSecretsCount,omitempty"`
+	// UnlabeledSecrets lists the first 100 secrets which look like credentials but are not saved
+	// by any credentials backup, as namespace/name; all of them are listed in the ConfigMap
+	// +kubebuilder:validation:Optional
+	UnlabeledSecrets []string `json:"unlabeledSecrets,omitempty"`
+}
+
+// CredentialsInventoryCount is the number of secrets matched by a credentials velero schedule
+type CredentialsInventoryCount struct {
+	// Schedule is the name of the velero schedule
+	Schedule string `json:"schedule"`
+	// Secrets is the number of secrets matched by the schedule label selector
+	Secrets int `json:"secrets"`
+}
+
+// RestoreTestStatus is the result of a test restore
+type RestoreTestStatus struct {
+	// Phase of the test restore, Running, Passed or Failed
+	Phase RestoreTestPhase `json:"phase"`
+	// BackupTimestamp identifies the restored backups, by the timestamp suffix of the backup names
+	// +kubebuilder:validation:Optional
+	BackupTimestamp string `json:"backupTimestamp,omitempty"`
+	// StartTime is the time the test restore started
+	// +kubebuilder:validation:Optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time the test restore completed
+	// +kubebuilder:validation:Optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Duration of the test restore
+	// +kubebuilder:validation:Optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// TotalItems is the number of items velero attempted to restore
+	// +kubebuilder:validation:Optional
+	TotalItems int `json:"totalItems,omitempty"`
+	// ItemsRestored is the number of items restored by velero
+	// +kubebuilder:validation:Optional
+	ItemsRestored int `json:"itemsRestored,omitempty"`
+	// Warnings is the number of warnings reported by the velero restores
+	// +kubebuilder:validation:Optional
+	Warnings int `json:"warnings,omitempty"`
+	// Errors is the number of errors reported by the velero restores
+	// +kubebuilder:validation:Optional
+	Errors int `json:"errors,omitempty"`
+	// Message describing the test restore result
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+}
+
+// BackupVerification reports how the resources saved by a set of backups compare with the hub resources
+type BackupVerification struct {
+	// BackupTimestamp identifies the verified backups, by the timestamp suffix of the backup names
+	BackupTimestamp string `json:"backupTimestamp"`
+	// VerificationTime is the time the backups were verified
+	// +kubebuilder:validation:Optional
+	VerificationTime *metav1.Time `json:"verificationTime,omitempty"`
+	// Resources are the number of backed up and hub resources, by backup and kind
+	// +kubebuilder:validation:Optional
+	Resources []BackupResourceCount `json:"resources,omitempty"`
+	// Drops lists the kinds with much less backed up resources than found on the hub
+	// +kubebuilder:validation:Optional
+	Drops []string `json:"drops,omitempty"`
+}
+
+// BackupResourceCount is the number of resources of a kind saved by a backup and found on the hub
+type BackupResourceCount struct {
+	// Backup is the name of the velero backup
+	Backup string `json:"backup"`
+	// Kind of the resources, as kind.group
+	Kind string `json:"kind"`
+	// BackedUp is the number of resources saved by the backup
+	BackedUp int `json:"backedUp"`
+	// Live is the number of resources found on the hub when the backup was verified
+	Live int `json:"live"`
+}
+
+// PreflightCheck is the result of a check run before creating velero schedules or restores
+type PreflightCheck struct {
+	// Name of the check
+	Name string `json:"name"`
+	// Status of the check, Passed, Warning or Failed
+	Status PreflightCheckStatus `json:"status"`
+	// Message describing the check result
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+}
+
+// StorageLocationStatus is the validation status of a velero BackupStorageLocation
+type StorageLocationStatus struct {
+	// Name of the velero BackupStorageLocation
+	Name string `json:"name"`
+	// Phase of the velero BackupStorageLocation, Available or Unavailable
+	// +kubebuilder:validation:Optional
+	Phase string `json:"phase,omitempty"`
+	// LastValidationTime is the last time velero validated the storage location
+	// +kubebuilder:validation:Optional
+	LastValidationTime *metav1.Time `json:"lastValidationTime,omitempty"`
+	// ValidationError describes why the storage location can't be used
+	// +kubebuilder:validation:Optional
+	ValidationError string `json:"validationError,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -23,15 +23,102 @@ package v1beta1
 
 import (
 	"github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupHook) DeepCopyInto(out *BackupHook) {
+	*out = *in
+	if in.ResourceTypes != nil {
+		in, out := &in.ResourceTypes, &out.ResourceTypes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.IncludedNamespaces != nil {
+		in, out := &in.IncludedNamespaces, &out.IncludedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludedNamespaces != nil {
+		in, out := &in.ExcludedNamespaces, &out.ExcludedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LabelSelector != nil {
+		in, out := &in.LabelSelector, &out.LabelSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Exec.DeepCopyInto(&out.Exec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupHook.
+func (in *BackupHook) DeepCopy() *BackupHook {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupHook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupHooks) DeepCopyInto(out *BackupHooks) {
+	*out = *in
+	if in.PreBackup != nil {
+		in, out := &in.PreBackup, &out.PreBackup
+		*out = make([]BackupHook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PostBackup != nil {
+		in, out := &in.PostBackup, &out.PostBackup
+		*out = make([]BackupHook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PauseReconcilers != nil {
+		in, out := &in.PauseReconcilers, &out.PauseReconcilers
+		*out = make([]PausedReconciler, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupHooks.
+func (in *BackupHooks) DeepCopy() *BackupHooks {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupHooks)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupResourceCount) DeepCopyInto(out *BackupResourceCount) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupResourceCount.
+func (in *BackupResourceCount) DeepCopy() *BackupResourceCount {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupResourceCount)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BackupSchedule) DeepCopyInto(out *BackupSchedule) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -89,6 +176,31 @@ func (in *BackupScheduleList) DeepCopyObject() runtime.Object {
 func (in *BackupScheduleSpec) DeepCopyInto(out *BackupScheduleSpec) {
 	*out = *in
 	out.VeleroTTL = in.VeleroTTL
+	if in.SecondaryStorageLocations != nil {
+		in, out := &in.SecondaryStorageLocations, &out.SecondaryStorageLocations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RestoreTest != nil {
+		in, out := &in.RestoreTest, &out.RestoreTest
+		*out = new(RestoreTestSpec)
+		**out = **in
+	}
+	if in.CredentialsEncryption != nil {
+		in, out := &in.CredentialsEncryption, &out.CredentialsEncryption
+		*out = new(CredentialsEncryption)
+		**out = **in
+	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = new(BackupHooks)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VeleroBackupTimeout != nil {
+		in, out := &in.VeleroBackupTimeout, &out.VeleroBackupTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupScheduleSpec.
@@ -119,6 +231,53 @@ func (in *BackupScheduleStatus) DeepCopyInto(out *BackupScheduleStatus) {
 		*out = new(v1.Schedule)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.StorageLocation != nil {
+		in, out := &in.StorageLocation, &out.StorageLocation
+		*out = new(StorageLocationStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PreflightChecks != nil {
+		in, out := &in.PreflightChecks, &out.PreflightChecks
+		*out = make([]PreflightCheck, len(*in))
+		copy(*out, *in)
+	}
+	if in.BackupVerification != nil {
+		in, out := &in.BackupVerification, &out.BackupVerification
+		*out = new(BackupVerification)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RestoreTest != nil {
+		in, out := &in.RestoreTest, &out.RestoreTest
+		*out = new(RestoreTestStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CredentialsInventory != nil {
+		in, out := &in.CredentialsInventory, &out.CredentialsInventory
+		*out = new(CredentialsInventory)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DependencyReport != nil {
+		in, out := &in.DependencyReport, &out.DependencyReport
+		*out = new(DependencyReport)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PausedReconcilers != nil {
+		in, out := &in.PausedReconcilers, &out.PausedReconcilers
+		*out = make([]PausedReconciler, len(*in))
+		copy(*out, *in)
+	}
+	if in.TimedOutVeleroBackups != nil {
+		in, out := &in.TimedOutVeleroBackups, &out.TimedOutVeleroBackups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupScheduleStatus.
@@ -132,26 +291,168 @@ func (in *BackupScheduleStatus) DeepCopy() *BackupScheduleStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Restore) DeepCopyInto(out *Restore) {
+func (in *BackupVerification) DeepCopyInto(out *BackupVerification) {
+	*out = *in
+	if in.VerificationTime != nil {
+		in, out := &in.VerificationTime, &out.VerificationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]BackupResourceCount, len(*in))
+		copy(*out, *in)
+	}
+	if in.Drops != nil {
+		in, out := &in.Drops, &out.Drops
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupVerification.
+func (in *BackupVerification) DeepCopy() *BackupVerification {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupVerification)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConflictingResource) DeepCopyInto(out *ConflictingResource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConflictingResource.
+func (in *ConflictingResource) DeepCopy() *ConflictingResource {
+	if in == nil {
+		return nil
+	}
+	out := new(ConflictingResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialsEncryption) DeepCopyInto(out *CredentialsEncryption) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialsEncryption.
+func (in *CredentialsEncryption) DeepCopy() *CredentialsEncryption {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialsEncryption)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialsInventory) DeepCopyInto(out *CredentialsInventory) {
+	*out = *in
+	if in.UpdateTime != nil {
+		in, out := &in.UpdateTime, &out.UpdateTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Schedules != nil {
+		in, out := &in.Schedules, &out.Schedules
+		*out = make([]CredentialsInventoryCount, len(*in))
+		copy(*out, *in)
+	}
+	if in.UnlabeledSecrets != nil {
+		in, out := &in.UnlabeledSecrets, &out.UnlabeledSecrets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialsInventory.
+func (in *CredentialsInventory) DeepCopy() *CredentialsInventory {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialsInventory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialsInventoryCount) DeepCopyInto(out *CredentialsInventoryCount) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialsInventoryCount.
+func (in *CredentialsInventoryCount) DeepCopy() *CredentialsInventoryCount {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialsInventoryCount)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DanglingReference) DeepCopyInto(out *DanglingReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DanglingReference.
+func (in *DanglingReference) DeepCopy() *DanglingReference {
+	if in == nil {
+		return nil
+	}
+	out := new(DanglingReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DependencyReport) DeepCopyInto(out *DependencyReport) {
+	*out = *in
+	if in.AnalysisTime != nil {
+		in, out := &in.AnalysisTime, &out.AnalysisTime
+		*out = (*in).DeepCopy()
+	}
+	if in.DanglingReferences != nil {
+		in, out := &in.DanglingReferences, &out.DanglingReferences
+		*out = make([]DanglingReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DependencyReport.
+func (in *DependencyReport) DeepCopy() *DependencyReport {
+	if in == nil {
+		return nil
+	}
+	out := new(DependencyReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HubFailover) DeepCopyInto(out *HubFailover) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Restore.
-func (in *Restore) DeepCopy() *Restore {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HubFailover.
+func (in *HubFailover) DeepCopy() *HubFailover {
 	if in == nil {
 		return nil
 	}
-	out := new(Restore)
+	out := new(HubFailover)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *Restore) DeepCopyObject() runtime.Object {
+func (in *HubFailover) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -159,31 +460,31 @@ func (in *Restore) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *RestoreList) DeepCopyInto(out *RestoreList) {
+func (in *HubFailoverList) DeepCopyInto(out *HubFailoverList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]Restore, len(*in))
+		*out = make([]HubFailover, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreList.
-func (in *RestoreList) DeepCopy() *RestoreList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HubFailoverList.
+func (in *HubFailoverList) DeepCopy() *HubFailoverList {
 	if in == nil {
 		return nil
 	}
-	out := new(RestoreList)
+	out := new(HubFailoverList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *RestoreList) DeepCopyObject() runtime.Object {
+func (in *HubFailoverList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -191,46 +492,630 @@ func (in *RestoreList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *RestoreSpec) DeepCopyInto(out *RestoreSpec) {
+func (in *HubFailoverSpec) DeepCopyInto(out *HubFailoverSpec) {
 	*out = *in
-	if in.VeleroManagedClustersBackupName != nil {
-		in, out := &in.VeleroManagedClustersBackupName, &out.VeleroManagedClustersBackupName
-		*out = new(string)
-		**out = **in
+	out.ManagedClustersTimeout = in.ManagedClustersTimeout
+	in.BackupSchedule.DeepCopyInto(&out.BackupSchedule)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HubFailoverSpec.
+func (in *HubFailoverSpec) DeepCopy() *HubFailoverSpec {
+	if in == nil {
+		return nil
 	}
-	if in.VeleroResourcesBackupName != nil {
-		in, out := &in.VeleroResourcesBackupName, &out.VeleroResourcesBackupName
-		*out = new(string)
-		**out = **in
+	out := new(HubFailoverSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HubFailoverStatus) DeepCopyInto(out *HubFailoverStatus) {
+	*out = *in
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]HubFailoverStep, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
-	if in.VeleroCredentialsBackupName != nil {
-		in, out := &in.VeleroCredentialsBackupName, &out.VeleroCredentialsBackupName
-		*out = new(string)
-		**out = **in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HubFailoverStatus.
+func (in *HubFailoverStatus) DeepCopy() *HubFailoverStatus {
+	if in == nil {
+		return nil
 	}
+	out := new(HubFailoverStatus)
+	in.DeepCopyInto(out)
+	return out
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreSpec.
-func (in *RestoreSpec) DeepCopy() *RestoreSpec {
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HubFailoverStep) DeepCopyInto(out *HubFailoverStep) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HubFailoverStep.
+func (in *HubFailoverStep) DeepCopy() *HubFailoverStep {
 	if in == nil {
 		return nil
 	}
-	out := new(RestoreSpec)
+	out := new(HubFailoverStep)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *RestoreStatus) DeepCopyInto(out *RestoreStatus) {
+func (in *JSONPatchOperation) DeepCopyInto(out *JSONPatchOperation) {
 	*out = *in
+	if in.Value != nil {
+		in, out := &in.Value, &out.Value
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreStatus.
-func (in *RestoreStatus) DeepCopy() *RestoreStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JSONPatchOperation.
+func (in *JSONPatchOperation) DeepCopy() *JSONPatchOperation {
 	if in == nil {
 		return nil
 	}
-	out := new(RestoreStatus)
+	out := new(JSONPatchOperation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedClusterActivation) DeepCopyInto(out *ManagedClusterActivation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedClusterActivation.
+func (in *ManagedClusterActivation) DeepCopy() *ManagedClusterActivation {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedClusterActivation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PausedReconciler) DeepCopyInto(out *PausedReconciler) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PausedReconciler.
+func (in *PausedReconciler) DeepCopy() *PausedReconciler {
+	if in == nil {
+		return nil
+	}
+	out := new(PausedReconciler)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreflightCheck) DeepCopyInto(out *PreflightCheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreflightCheck.
+func (in *PreflightCheck) DeepCopy() *PreflightCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(PreflightCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Restore) DeepCopyInto(out *Restore) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Restore.
+func (in *Restore) DeepCopy() *Restore {
+	if in == nil {
+		return nil
+	}
+	out := new(Restore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Restore) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreHook) DeepCopyInto(out *RestoreHook) {
+	*out = *in
+	if in.ResourceTypes != nil {
+		in, out := &in.ResourceTypes, &out.ResourceTypes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Job != nil {
+		in, out := &in.Job, &out.Job
+		*out = new(batchv1.JobTemplateSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VeleroHook != nil {
+		in, out := &in.VeleroHook, &out.VeleroHook
+		*out = new(v1.RestoreResourceHookSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreHook.
+func (in *RestoreHook) DeepCopy() *RestoreHook {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreHook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreHookStatus) DeepCopyInto(out *RestoreHookStatus) {
+	*out = *in
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreHookStatus.
+func (in *RestoreHookStatus) DeepCopy() *RestoreHookStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreHookStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreHooks) DeepCopyInto(out *RestoreHooks) {
+	*out = *in
+	if in.PreRestore != nil {
+		in, out := &in.PreRestore, &out.PreRestore
+		*out = make([]RestoreHook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PostRestore != nil {
+		in, out := &in.PostRestore, &out.PostRestore
+		*out = make([]RestoreHook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreHooks.
+func (in *RestoreHooks) DeepCopy() *RestoreHooks {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreHooks)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreList) DeepCopyInto(out *RestoreList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Restore, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreList.
+func (in *RestoreList) DeepCopy() *RestoreList {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *RestoreList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreProgress) DeepCopyInto(out *RestoreProgress) {
+	*out = *in
+	if in.EstimatedTimeRemaining != nil {
+		in, out := &in.EstimatedTimeRemaining, &out.EstimatedTimeRemaining
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.LastReportTime != nil {
+		in, out := &in.LastReportTime, &out.LastReportTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreProgress.
+func (in *RestoreProgress) DeepCopy() *RestoreProgress {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreProgress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreRetryPolicy) DeepCopyInto(out *RestoreRetryPolicy) {
+	*out = *in
+	out.Backoff = in.Backoff
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreRetryPolicy.
+func (in *RestoreRetryPolicy) DeepCopy() *RestoreRetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreRetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreRun) DeepCopyInto(out *RestoreRun) {
+	*out = *in
+	if in.VeleroRestores != nil {
+		in, out := &in.VeleroRestores, &out.VeleroRestores
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EndTime != nil {
+		in, out := &in.EndTime, &out.EndTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreRun.
+func (in *RestoreRun) DeepCopy() *RestoreRun {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreRun)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreSpec) DeepCopyInto(out *RestoreSpec) {
+	*out = *in
+	if in.VeleroManagedClustersBackupName != nil {
+		in, out := &in.VeleroManagedClustersBackupName, &out.VeleroManagedClustersBackupName
+		*out = new(string)
+		**out = **in
+	}
+	if in.VeleroResourcesBackupName != nil {
+		in, out := &in.VeleroResourcesBackupName, &out.VeleroResourcesBackupName
+		*out = new(string)
+		**out = **in
+	}
+	if in.VeleroCredentialsBackupName != nil {
+		in, out := &in.VeleroCredentialsBackupName, &out.VeleroCredentialsBackupName
+		*out = new(string)
+		**out = **in
+	}
+	out.RestoreSyncInterval = in.RestoreSyncInterval
+	if in.CredentialsEncryption != nil {
+		in, out := &in.CredentialsEncryption, &out.CredentialsEncryption
+		*out = new(CredentialsEncryption)
+		**out = **in
+	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = new(RestoreHooks)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Transforms != nil {
+		in, out := &in.Transforms, &out.Transforms
+		*out = make([]RestoreTransform, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VeleroRestoreTimeout != nil {
+		in, out := &in.VeleroRestoreTimeout, &out.VeleroRestoreTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RestoreRetryPolicy)
+		**out = **in
+	}
+	if in.RunHistoryLimit != nil {
+		in, out := &in.RunHistoryLimit, &out.RunHistoryLimit
+		*out = new(int)
+		**out = **in
+	}
+	if in.ManagedClusterActivationTimeout != nil {
+		in, out := &in.ManagedClusterActivationTimeout, &out.ManagedClusterActivationTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreSpec.
+func (in *RestoreSpec) DeepCopy() *RestoreSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreStatus) DeepCopyInto(out *RestoreStatus) {
+	*out = *in
+	if in.VeleroRestoreResults != nil {
+		in, out := &in.VeleroRestoreResults, &out.VeleroRestoreResults
+		*out = make([]VeleroRestoreResult, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ConflictingResources != nil {
+		in, out := &in.ConflictingResources, &out.ConflictingResources
+		*out = make([]ConflictingResource, len(*in))
+		copy(*out, *in)
+	}
+	if in.CleanupPreview != nil {
+		in, out := &in.CleanupPreview, &out.CleanupPreview
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ManagedClusterActivations != nil {
+		in, out := &in.ManagedClusterActivations, &out.ManagedClusterActivations
+		*out = make([]ManagedClusterActivation, len(*in))
+		copy(*out, *in)
+	}
+	if in.SourceHubs != nil {
+		in, out := &in.SourceHubs, &out.SourceHubs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StorageLocation != nil {
+		in, out := &in.StorageLocation, &out.StorageLocation
+		*out = new(StorageLocationStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PreflightChecks != nil {
+		in, out := &in.PreflightChecks, &out.PreflightChecks
+		*out = make([]PreflightCheck, len(*in))
+		copy(*out, *in)
+	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = make([]RestoreHookStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TransformResults != nil {
+		in, out := &in.TransformResults, &out.TransformResults
+		*out = make([]RestoreTransformResult, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Progress != nil {
+		in, out := &in.Progress, &out.Progress
+		*out = new(RestoreProgress)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TimedOutVeleroRestores != nil {
+		in, out := &in.TimedOutVeleroRestores, &out.TimedOutVeleroRestores
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.VeleroRestoreAttempts != nil {
+		in, out := &in.VeleroRestoreAttempts, &out.VeleroRestoreAttempts
+		*out = make([]VeleroRestoreAttempt, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PreviousRuns != nil {
+		in, out := &in.PreviousRuns, &out.PreviousRuns
+		*out = make([]RestoreRun, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreStatus.
+func (in *RestoreStatus) DeepCopy() *RestoreStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreTestSpec) DeepCopyInto(out *RestoreTestSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreTestSpec.
+func (in *RestoreTestSpec) DeepCopy() *RestoreTestSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreTestSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreTestStatus) DeepCopyInto(out *RestoreTestStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreTestStatus.
+func (in *RestoreTestStatus) DeepCopy() *RestoreTestStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreTestStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreTransform) DeepCopyInto(out *RestoreTransform) {
+	*out = *in
+	if in.Patches != nil {
+		in, out := &in.Patches, &out.Patches
+		*out = make([]JSONPatchOperation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreTransform.
+func (in *RestoreTransform) DeepCopy() *RestoreTransform {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreTransform)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreTransformResult) DeepCopyInto(out *RestoreTransformResult) {
+	*out = *in
+	if in.Errors != nil {
+		in, out := &in.Errors, &out.Errors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreTransformResult.
+func (in *RestoreTransformResult) DeepCopy() *RestoreTransformResult {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreTransformResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageLocationStatus) DeepCopyInto(out *StorageLocationStatus) {
+	*out = *in
+	if in.LastValidationTime != nil {
+		in, out := &in.LastValidationTime, &out.LastValidationTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageLocationStatus.
+func (in *StorageLocationStatus) DeepCopy() *StorageLocationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageLocationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VeleroRestoreAttempt) DeepCopyInto(out *VeleroRestoreAttempt) {
+	*out = *in
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VeleroRestoreAttempt.
+func (in *VeleroRestoreAttempt) DeepCopy() *VeleroRestoreAttempt {
+	if in == nil {
+		return nil
+	}
+	out := new(VeleroRestoreAttempt)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VeleroRestoreResult) DeepCopyInto(out *VeleroRestoreResult) {
+	*out = *in
+	if in.Summary != nil {
+		in, out := &in.Summary, &out.Summary
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VeleroRestoreResult.
+func (in *VeleroRestoreResult) DeepCopy() *VeleroRestoreResult {
+	if in == nil {
+		return nil
+	}
+	out := new(VeleroRestoreResult)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -45,6 +45,28 @@ var (
 		"hive.openshift.io",
 	}
 
+	// api groups of the backed up resources the restore can overwrite, clean up or transform on the hub,
+	// each one has a matching RBAC rule on the restore controller
+	restoredAPIGroups = []string{
+		"action.open-cluster-management.io",
+		"addon.open-cluster-management.io",
+		"agent.open-cluster-management.io",
+		"app.k8s.io",
+		"apps.open-cluster-management.io",
+		"argoproj.io",
+		"cluster.open-cluster-management.io",
+		"core.observatorium.io",
+		"discovery.open-cluster-management.io",
+		"hive.openshift.io",
+		"imageregistry.open-cluster-management.io",
+		"inventory.open-cluster-management.io",
+		"observability.open-cluster-management.io",
+		"policy.open-cluster-management.io",
+		"search.open-cluster-management.io",
+		"submarineraddon.open-cluster-management.io",
+		"view.open-cluster-management.io",
+	}
+
 	// exclude resources from these api groups
 	excludedAPIGroups = []string{
 		"admission.cluster.open-cluster-management.io",
@@ -134,52 +156,74 @@ func cleanupBackups(
 				bkp.Status.Phase != veleroapi.BackupPhaseDeleting
 		})
 
-		if maxBackups < len(sliceBackups) {
-			// need to delete backups
-			// sort backups by create time
-			sort.Slice(sliceBackups, func(i, j int) bool {
-				var timeA int64
-				var timeB int64
-				if sliceBackups[i].Status.StartTimestamp != nil {
-					timeA = sliceBackups[i].Status.StartTimestamp.Time.Unix()
+		// keep maxBackups backups in each storage location
+		backupsByLocation := make(map[string][]veleroapi.Backup)
+		for i := range sliceBackups {
+			location := sliceBackups[i].Spec.StorageLocation
+			backupsByLocation[location] = append(backupsByLocation[location], sliceBackups[i])
+		}
+		for location := range backupsByLocation {
+			cleanupLocationBackups(ctx, maxBackups, backupsByLocation[location], veleroBackupList.Items, c)
+		}
+
+	}
+}
+
+// clean up the old backups saved in a storage location if they exceed the maxCount number
+func cleanupLocationBackups(
+	ctx context.Context,
+	maxBackups int,
+	locationBackups []veleroapi.Backup,
+	allBackups []veleroapi.Backup,
+	c client.Client,
+) {
+	if maxBackups < len(locationBackups) {
+		// need to delete backups
+		// sort backups by create time
+		sort.Slice(locationBackups, func(i, j int) bool {
+			var timeA int64
+			var timeB int64
+			if locationBackups[i].Status.StartTimestamp != nil {
+				timeA = locationBackups[i].Status.StartTimestamp.Time.Unix()
+			}
+			if locationBackups[j].Status.StartTimestamp != nil {
+				timeB = locationBackups[j].Status.StartTimestamp.Time.Unix()
+			}
+			return timeA < timeB
+		})
+
+		for i := 0; i < len(locationBackups)-maxBackups; i++ {
+
+			// for each resources backup find all corresponding backups
+			// with the creation timestamp in the +- 2s interval and remove them
+			resourcesBackup := &locationBackups[i]
+			creationTimestamp := resourcesBackup.CreationTimestamp
+			relatedBackups := filterBackups(allBackups, func(bkp veleroapi.Backup) bool {
+				isRelated := false
+				if creationTimestamp.Sub(bkp.CreationTimestamp.Time).Seconds() > 2 ||
+					bkp.CreationTimestamp.Sub(creationTimestamp.Time) > 2 {
+					return isRelated // not related, more then 2s appart
 				}
-				if sliceBackups[j].Status.StartTimestamp != nil {
-					timeB = sliceBackups[j].Status.StartTimestamp.Time.Unix()
+				if bkp.Spec.StorageLocation != resourcesBackup.Spec.StorageLocation {
+					return isRelated // saved in another storage location
 				}
-				return timeA < timeB
-			})
-
-			for i := 0; i < len(sliceBackups)-maxBackups; i++ {
-
-				// for each resources backup find all corresponding backups
-				// with the creation timestamp in the +- 2s interval and remove them
-				resourcesBackup := &sliceBackups[i]
-				creationTimestamp := resourcesBackup.CreationTimestamp
-				relatedBackups := filterBackups(veleroBackupList.Items[:], func(bkp veleroapi.Backup) bool {
-					isRelated := false
-					if creationTimestamp.Sub(bkp.CreationTimestamp.Time).Seconds() > 2 ||
-						bkp.CreationTimestamp.Sub(creationTimestamp.Time) > 2 {
-						return isRelated // not related, more then 2s appart
-					}
 
-					// check if the backup name is in the list of acm backups
-					for key := range veleroScheduleNames {
-						if strings.HasPrefix(bkp.Name, veleroScheduleNames[key]) {
-							isRelated = true
-							break
-						}
+				// check if the backup name is in the list of acm backups
+				for key := range veleroScheduleNames {
+					if strings.HasPrefix(bkp.Name, veleroScheduleNames[key]) {
+						isRelated = true
+						break
 					}
+				}
 
-					return isRelated
+				return isRelated
 
-				})
-				// delete all related backups with the same timestamp
-				for i := range relatedBackups {
-					deleteBackup(ctx, &relatedBackups[i], c)
-				}
+			})
+			// delete all related backups with the same timestamp
+			for i := range relatedBackups {
+				deleteBackup(ctx, &relatedBackups[i], c)
 			}
 		}
-
 	}
 }
 
@@ -225,6 +269,25 @@ func deleteBackup(
 	}
 }
 
+// returns the namespaces excluded from the acm resources backup
+func getResourcesBackupExcludedNamespaces(ctx context.Context, c client.Client) []string {
+	backupLogger := log.FromContext(ctx)
+	excludedNamespaces := []string{"local-cluster"}
+
+	// exclude acm channel namespaces
+	channels := chnv1.ChannelList{}
+	if err := c.List(ctx, &channels, &client.ListOptions{}); err != nil {
+		backupLogger.Error(err, "failed to get chnv1.ChannelList")
+	} else {
+		for i := range channels.Items {
+			if channels.Items[i].Name == "charts-v1" {
+				excludedNamespaces = appendUnique(excludedNamespaces, channels.Items[i].Namespace)
+			}
+		}
+	}
+	return excludedNamespaces
+}
+
 // set all acm resources backup info
 func setResourcesBackupInfo(
 	ctx context.Context,
@@ -233,13 +296,8 @@ func setResourcesBackupInfo(
 	c client.Client,
 ) {
 
-	backupLogger := log.FromContext(ctx)
 	var clusterResource bool = true
 	veleroBackupTemplate.IncludeClusterResources = &clusterResource
-	veleroBackupTemplate.ExcludedNamespaces = appendUnique(
-		veleroBackupTemplate.ExcludedNamespaces,
-		"local-cluster",
-	)
 
 	for i := range resourcesToBackup { // acm resources
 		veleroBackupTemplate.IncludedResources = appendUnique(
@@ -248,21 +306,12 @@ func setResourcesBackupInfo(
 		)
 	}
 
-	// exclude acm channel namespaces
-	channels := chnv1.ChannelList{}
-	if err := c.List(ctx, &channels, &client.ListOptions{}); err != nil {
-		backupLogger.Error(err, "failed to get chnv1.ChannelList")
-	} else {
-		for i := range channels.Items {
-			if channels.Items[i].Name == "charts-v1" {
-				veleroBackupTemplate.ExcludedNamespaces = appendUnique(
-					veleroBackupTemplate.ExcludedNamespaces,
-					channels.Items[i].Namespace,
-				)
-			}
-		}
+	for _, namespace := range getResourcesBackupExcludedNamespaces(ctx, c) {
+		veleroBackupTemplate.ExcludedNamespaces = appendUnique(
+			veleroBackupTemplate.ExcludedNamespaces,
+			namespace,
+		)
 	}
-
 }
 
 // set credentials backup info
@@ -478,3 +527,8 @@ func shouldBackupAPIGroup(groupStr string) bool {
 
 	return ok
 }
+
+// returns true if the restore can overwrite, clean up or transform the resources of this api group
+func isRestoredAPIGroup(groupStr string) bool {
+	return shouldBackupAPIGroup(groupStr) && findValue(restoredAPIGroups, groupStr)
+}
@@ -0,0 +1,538 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	"github.com/robfig/cron/v3"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// interval used to check the running backups while reconcilers are paused
+	pausedReconcilersCheckInterval = 1 * time.Minute
+	// the reconcilers are paused this long before the next scheduled backup starts
+	backupPauseLeadTime = 2 * time.Minute
+	// time given to velero to create a scheduled backup, the reconcilers are resumed if the backup is not created
+	backupStartTimeout = 5 * time.Minute
+	// annotation set on the paused resources, with the name of the backup schedule which paused them
+	pausedByBackupAnnotation = "cluster.open-cluster-management.io/paused-by-backup-schedule"
+	// annotation keeping the replicas of the resources scaled down while the backups are running
+	pausedReplicasAnnotation = "cluster.open-cluster-management.io/paused-replicas"
+	// annotation keeping the key of the annotation pausing the resources, removed once the backup completes
+	pausedAnnotationKeyAnnotation = "cluster.open-cluster-management.io/paused-annotation"
+	// finalizer resuming the paused reconcilers when the backup schedule is deleted
+	pausedReconcilersFinalizer = "cluster.open-cluster-management.io/resume-paused-reconcilers"
+)
+
+// pausableKind is a kind of resource which can be paused while the backups are running
+type pausableKind struct {
+	// version used to list the resources of this kind
+	version string
+	// scalable resources can be scaled down, the other ones are paused with an annotation
+	scalable bool
+}
+
+// pausableKinds are the kinds of the resources the backup schedules can pause,
+// the operator is only allowed to update resources of these kinds
+var pausableKinds = map[schema.GroupKind]pausableKind{
+	{Group: "apps", Kind: "Deployment"}:                                     {version: "v1", scalable: true},
+	{Group: "apps", Kind: "StatefulSet"}:                                    {version: "v1", scalable: true},
+	{Group: "operator.open-cluster-management.io", Kind: "MultiClusterHub"}: {version: "v1"},
+}
+
+// pausableNamespaces are the ACM and MCH namespaces of the resources the backup schedules can pause,
+// so the backup schedules can't scale down the platform or user workloads
+var pausableNamespaces = []string{
+	"open-cluster-management",
+	"open-cluster-management-hub",
+	"multicluster-engine",
+}
+
+// backupRunningChanged triggers a reconcile when a velero backup starts or stops running
+var backupRunningChanged = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldBackup, okOld := e.ObjectOld.(*veleroapi.Backup)
+		newBackup, okNew := e.ObjectNew.(*veleroapi.Backup)
+		return okOld && okNew &&
+			oldBackup.Status.Phase != newBackup.Status.Phase &&
+			(oldBackup.Status.Phase == veleroapi.BackupPhaseInProgress ||
+				newBackup.Status.Phase == veleroapi.BackupPhaseInProgress)
+	},
+}
+
+// returns an error if the backup hooks are not valid
+func validateBackupHooks(backupSchedule *v1beta1.BackupSchedule) error {
+	hooks := backupSchedule.Spec.Hooks
+	if hooks == nil {
+		return nil
+	}
+	names := map[string]bool{}
+	for _, hook := range append(append([]v1beta1.BackupHook{}, hooks.PreBackup...), hooks.PostBackup...) {
+		if hook.Name == "" {
+			return fmt.Errorf("backup hooks must have a name")
+		}
+		if names[hook.Name] {
+			return fmt.Errorf("backup hook name %s is used by more than one hook", hook.Name)
+		}
+		names[hook.Name] = true
+
+		if len(hook.Exec.Command) == 0 {
+			return fmt.Errorf("backup hook %s must set a command", hook.Name)
+		}
+		for _, resourceType := range hook.ResourceTypes {
+			if _, ok := veleroScheduleNames[ResourceType(resourceType)]; !ok {
+				return fmt.Errorf("backup hook %s: unknown resource type %s", hook.Name, resourceType)
+			}
+		}
+	}
+	for i := range hooks.PauseReconcilers {
+		reconciler := &hooks.PauseReconcilers[i]
+		if reconciler.Name == "" {
+			return fmt.Errorf("paused reconcilers must have a name")
+		}
+		if !findValue(pausableNamespaces, reconciler.Namespace) {
+			return fmt.Errorf("paused reconciler %s: resources in namespace %q can't be paused, allowed namespaces: %s",
+				reconciler.Name, reconciler.Namespace, strings.Join(pausableNamespaces, ", "))
+		}
+		if reconciler.Annotation != "" && !strings.Contains(reconciler.Annotation, "=") {
+			return fmt.Errorf("paused reconciler %s: annotation must be set as key=value", reconciler.Name)
+		}
+		gvk, err := getPausedReconcilerGVK(reconciler)
+		if err != nil {
+			return fmt.Errorf("paused reconciler %s: %v", reconciler.Name, err)
+		}
+		kind, ok := pausableKinds[gvk.GroupKind()]
+		if !ok {
+			return fmt.Errorf("paused reconciler %s: kind %s can't be paused", reconciler.Name, gvk.GroupKind())
+		}
+		if !kind.scalable && reconciler.Annotation == "" {
+			return fmt.Errorf("paused reconciler %s: %s can only be paused with an annotation",
+				reconciler.Name, gvk.GroupKind())
+		}
+	}
+	return nil
+}
+
+// returns true if the backup hook applies to the velero backups of this resource type
+func isBackupHookForType(hook *v1beta1.BackupHook, key ResourceType) bool {
+	if len(hook.ResourceTypes) == 0 {
+		return true
+	}
+	for _, resourceType := range hook.ResourceTypes {
+		if ResourceType(resourceType) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the resource type of the backups produced by the velero schedule, including secondary schedules
+func getScheduleResourceType(scheduleName string) (ResourceType, bool) {
+	for key, name := range veleroScheduleNames {
+		if scheduleName == name || strings.HasPrefix(scheduleName, name+"-") {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// returns the velero hooks of the backups of this resource type
+func getVeleroBackupHooks(backupSchedule *v1beta1.BackupSchedule, key ResourceType) veleroapi.BackupHooks {
+	veleroHooks := veleroapi.BackupHooks{}
+	if backupSchedule.Spec.Hooks == nil {
+		return veleroHooks
+	}
+	addHooks := func(hooks []v1beta1.BackupHook, pre bool) {
+		for i := range hooks {
+			hook := hooks[i].DeepCopy()
+			if !isBackupHookForType(hook, key) {
+				continue
+			}
+			veleroHook := veleroapi.BackupResourceHookSpec{
+				Name:               hook.Name,
+				IncludedNamespaces: hook.IncludedNamespaces,
+				ExcludedNamespaces: hook.ExcludedNamespaces,
+				LabelSelector:      hook.LabelSelector,
+			}
+			if pre {
+				veleroHook.PreHooks = []veleroapi.BackupResourceHook{{Exec: &hook.Exec}}
+			} else {
+				veleroHook.PostHooks = []veleroapi.BackupResourceHook{{Exec: &hook.Exec}}
+			}
+			veleroHooks.Resources = append(veleroHooks.Resources, veleroHook)
+		}
+	}
+	addHooks(backupSchedule.Spec.Hooks.PreBackup, true)
+	addHooks(backupSchedule.Spec.Hooks.PostBackup, false)
+	return veleroHooks
+}
+
+// returns true if the hooks of the velero schedules don't match the hooks of the backup schedule
+func isScheduleHooksUpdated(schedules *veleroapi.ScheduleList, backupSchedule *v1beta1.BackupSchedule) bool {
+	for i := range schedules.Items {
+		key, ok := getScheduleResourceType(schedules.Items[i].Name)
+		if !ok {
+			continue
+		}
+		current := schedules.Items[i].Spec.Template.Hooks.Resources
+		wanted := getVeleroBackupHooks(backupSchedule, key).Resources
+		if len(current) != len(wanted) || (len(wanted) > 0 && !reflect.DeepEqual(current, wanted)) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns true if a backup produced by the velero schedules is running
+func (r *BackupScheduleReconciler) isBackupRunning(
+	ctx context.Context,
+	namespace string,
+	schedules []veleroapi.Schedule,
+) (bool, error) {
+	backups := &veleroapi.BackupList{}
+	if err := r.List(ctx, backups, client.InNamespace(namespace)); err != nil {
+		return false, err
+	}
+	for i := range backups.Items {
+		if backups.Items[i].Status.Phase != veleroapi.BackupPhaseNew &&
+			backups.Items[i].Status.Phase != veleroapi.BackupPhaseInProgress {
+			continue
+		}
+		for j := range schedules {
+			if backups.Items[i].Labels[veleroapi.ScheduleNameLabel] == schedules[j].Name {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// returns true if a backup of the velero schedules starts in less than backupPauseLeadTime, or was due
+// less than backupStartTimeout ago; otherwise returns the time left before the next backup is due,
+// or 0 if no backup is scheduled.
+// The first backup of a new velero schedule starts right away, it is only seen once running
+func isBackupDue(schedules []veleroapi.Schedule, now time.Time) (bool, time.Duration) {
+	wait := time.Duration(0)
+	for i := range schedules {
+		cronSchedule, err := cron.ParseStandard(schedules[i].Spec.Schedule)
+		if err != nil {
+			continue
+		}
+		// velero runs the next backup at the first cron time after its last backup
+		lastBackup := time.Time{}
+		if schedules[i].Status.LastBackup != nil {
+			lastBackup = schedules[i].Status.LastBackup.Time
+		}
+		nextBackup := cronSchedule.Next(lastBackup)
+		if now.After(nextBackup.Add(backupStartTimeout)) {
+			continue
+		}
+		pauseTime := nextBackup.Add(-backupPauseLeadTime)
+		if !now.Before(pauseTime) {
+			return true, 0
+		}
+		if wait == 0 || pauseTime.Sub(now) < wait {
+			wait = pauseTime.Sub(now)
+		}
+	}
+	return false, wait
+}
+
+// returns the group, version and kind of the resource paused by the reconciler entry
+func getPausedReconcilerGVK(reconciler *v1beta1.PausedReconciler) (schema.GroupVersionKind, error) {
+	apiVersion, kind := reconciler.APIVersion, reconciler.Kind
+	if apiVersion == "" {
+		apiVersion = "apps/v1"
+	}
+	if kind == "" {
+		kind = "Deployment"
+	}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	return gv.WithKind(kind), err
+}
+
+// returns the resource paused by the reconciler entry
+func getPausedReconcilerObject(
+	ctx context.Context,
+	c client.Client,
+	reconciler *v1beta1.PausedReconciler,
+) (*unstructured.Unstructured, error) {
+	gvk, err := getPausedReconcilerGVK(reconciler)
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	err = c.Get(ctx, types.NamespacedName{Namespace: reconciler.Namespace, Name: reconciler.Name}, obj)
+	return obj, err
+}
+
+// returns the resources paused by the backup schedule, found from their annotation
+// so they are resumed even if the paused reconcilers status was not saved
+func getPausedObjects(
+	ctx context.Context,
+	c client.Client,
+	backupSchedule *v1beta1.BackupSchedule,
+) ([]unstructured.Unstructured, error) {
+	objs := []unstructured.Unstructured{}
+	for groupKind, kind := range pausableKinds {
+		gvk := groupKind.WithVersion(kind.version)
+		listGVK := gvk.GroupVersion().WithKind(gvk.Kind + "List")
+		// kinds known by the scheme are listed with their type, the other ones as unstructured
+		var list client.ObjectList = &unstructured.UnstructuredList{}
+		if obj, err := c.Scheme().New(listGVK); err == nil {
+			if typed, ok := obj.(client.ObjectList); ok {
+				list = typed
+			}
+		}
+		list.GetObjectKind().SetGroupVersionKind(listGVK)
+		if err := c.List(ctx, list); err != nil {
+			if apimeta.IsNoMatchError(err) {
+				// the kind is not installed on this hub
+				continue
+			}
+			return nil, err
+		}
+		items, err := apimeta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			accessor, err := apimeta.Accessor(item)
+			if err != nil {
+				return nil, err
+			}
+			if accessor.GetAnnotations()[pausedByBackupAnnotation] != backupSchedule.Name {
+				continue
+			}
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(item)
+			if err != nil {
+				return nil, err
+			}
+			obj := unstructured.Unstructured{Object: content}
+			obj.SetGroupVersionKind(gvk)
+			objs = append(objs, obj)
+		}
+	}
+	return objs, nil
+}
+
+// pauses the reconciler, with an annotation or by scaling down the resource;
+// returns false if the reconciler was already paused, by the user or by another schedule
+func pauseReconciler(
+	ctx context.Context,
+	c client.Client,
+	backupSchedule *v1beta1.BackupSchedule,
+	reconciler *v1beta1.PausedReconciler,
+) (bool, error) {
+	obj, err := getPausedReconcilerObject(ctx, c, reconciler)
+	if err != nil {
+		return false, err
+	}
+	original := obj.DeepCopy()
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if _, ok := annotations[pausedByBackupAnnotation]; ok {
+		return false, nil
+	}
+
+	if reconciler.Annotation != "" {
+		keyValue := strings.SplitN(reconciler.Annotation, "=", 2)
+		if _, ok := annotations[keyValue[0]]; ok {
+			// paused by the user, leave it paused once the backup completes
+			return false, nil
+		}
+		annotations[keyValue[0]] = keyValue[1]
+		annotations[pausedAnnotationKeyAnnotation] = keyValue[0]
+	} else {
+		replicas, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			replicas = 1
+		}
+		if replicas == 0 {
+			return false, nil
+		}
+		annotations[pausedReplicasAnnotation] = strconv.FormatInt(replicas, 10)
+		if err := unstructured.SetNestedField(obj.Object, int64(0), "spec", "replicas"); err != nil {
+			return false, err
+		}
+	}
+	annotations[pausedByBackupAnnotation] = backupSchedule.Name
+	obj.SetAnnotations(annotations)
+	return true, c.Patch(ctx, obj, client.MergeFrom(original))
+}
+
+// resumes a resource paused by a backup schedule, using the annotations set when pausing it
+func resumePausedObject(ctx context.Context, c client.Client, obj *unstructured.Unstructured) error {
+	original := obj.DeepCopy()
+	annotations := obj.GetAnnotations()
+	if key, ok := annotations[pausedAnnotationKeyAnnotation]; ok {
+		delete(annotations, key)
+		delete(annotations, pausedAnnotationKeyAnnotation)
+	}
+	if value, ok := annotations[pausedReplicasAnnotation]; ok {
+		replicas, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(obj.Object, replicas, "spec", "replicas"); err != nil {
+			return err
+		}
+		delete(annotations, pausedReplicasAnnotation)
+	}
+	delete(annotations, pausedByBackupAnnotation)
+	obj.SetAnnotations(annotations)
+	return client.IgnoreNotFound(c.Patch(ctx, obj, client.MergeFrom(original)))
+}
+
+// adds or removes the finalizer resuming the paused reconcilers when the backup schedule is deleted;
+// the status changes of the backup schedule are kept, to be saved with the status
+func (r *BackupScheduleReconciler) setPausedReconcilersFinalizer(
+	ctx context.Context,
+	backupSchedule *v1beta1.BackupSchedule,
+	set bool,
+) error {
+	if controllerutil.ContainsFinalizer(backupSchedule, pausedReconcilersFinalizer) == set {
+		return nil
+	}
+	updated := backupSchedule.DeepCopy()
+	if set {
+		controllerutil.AddFinalizer(updated, pausedReconcilersFinalizer)
+	} else {
+		controllerutil.RemoveFinalizer(updated, pausedReconcilersFinalizer)
+	}
+	if err := r.Patch(ctx, updated, client.MergeFrom(backupSchedule)); err != nil {
+		return err
+	}
+	backupSchedule.Finalizers = updated.Finalizers
+	backupSchedule.ResourceVersion = updated.ResourceVersion
+	return nil
+}
+
+// resumes all the resources paused by the backup schedule, including the ones removed from the spec
+// or missing from the status, then removes the finalizer
+func (r *BackupScheduleReconciler) resumePausedReconcilers(
+	ctx context.Context,
+	backupSchedule *v1beta1.BackupSchedule,
+) error {
+	scheduleLogger := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(backupSchedule, pausedReconcilersFinalizer) &&
+		len(backupSchedule.Status.PausedReconcilers) == 0 {
+		return nil
+	}
+	objs, err := getPausedObjects(ctx, r.Client, backupSchedule)
+	if err != nil {
+		return err
+	}
+	for i := range objs {
+		if err := resumePausedObject(ctx, r.Client, &objs[i]); err != nil {
+			return err
+		}
+		scheduleLogger.Info("reconciler resumed after the backup",
+			"kind", objs[i].GetKind(), "name", objs[i].GetName(), "namespace", objs[i].GetNamespace())
+	}
+	backupSchedule.Status.PausedReconcilers = nil
+	return r.setPausedReconcilersFinalizer(ctx, backupSchedule, false)
+}
+
+// returns true if the backup schedule pauses reconcilers while its backups are running
+func isPauseReconcilersEnabled(backupSchedule *v1beta1.BackupSchedule) bool {
+	return backupSchedule.Spec.Hooks != nil &&
+		len(backupSchedule.Spec.Hooks.PauseReconcilers) > 0 &&
+		validateBackupHooks(backupSchedule) == nil &&
+		!isBackupCollisionActive(backupSchedule)
+}
+
+// pauses the reconcilers of the backup schedule shortly before its next backup and while one of its
+// backups is running, and resumes them once no backup is running or due;
+// returns when the paused reconcilers must be checked again, or 0 if no backup is scheduled
+func (r *BackupScheduleReconciler) updatePausedReconcilers(
+	ctx context.Context,
+	backupSchedule *v1beta1.BackupSchedule,
+) (time.Duration, error) {
+	scheduleLogger := log.FromContext(ctx)
+
+	pause, wait := false, time.Duration(0)
+	if isPauseReconcilersEnabled(backupSchedule) {
+		schedules := veleroapi.ScheduleList{}
+		if err := r.List(
+			ctx,
+			&schedules,
+			client.InNamespace(backupSchedule.Namespace),
+			client.MatchingFields{scheduleOwnerKey: backupSchedule.Name},
+		); err != nil {
+			return 0, err
+		}
+		running, err := r.isBackupRunning(ctx, backupSchedule.Namespace, schedules.Items)
+		if err != nil {
+			return 0, err
+		}
+		due, untilDue := isBackupDue(schedules.Items, time.Now())
+		pause, wait = running || due, untilDue
+	}
+	if !pause {
+		return wait, r.resumePausedReconcilers(ctx, backupSchedule)
+	}
+
+	// set the finalizer before pausing any resource, so they are resumed if the backup schedule is deleted
+	if err := r.setPausedReconcilersFinalizer(ctx, backupSchedule, true); err != nil {
+		return 0, err
+	}
+	for i := range backupSchedule.Spec.Hooks.PauseReconcilers {
+		reconciler := &backupSchedule.Spec.Hooks.PauseReconcilers[i]
+		paused, err := pauseReconciler(ctx, r.Client, backupSchedule, reconciler)
+		if err != nil {
+			if client.IgnoreNotFound(err) == nil {
+				continue
+			}
+			return 0, err
+		}
+		if paused {
+			scheduleLogger.Info("reconciler paused for the backup",
+				"kind", reconciler.Kind, "name", reconciler.Name, "namespace", reconciler.Namespace)
+			backupSchedule.Status.PausedReconcilers = append(backupSchedule.Status.PausedReconcilers, *reconciler)
+		}
+	}
+	return pausedReconcilersCheckInterval, nil
+}
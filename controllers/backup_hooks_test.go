@@ -0,0 +1,391 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newHooksSchedule(hooks *v1beta1.BackupHooks) *v1beta1.BackupSchedule {
+	return &v1beta1.BackupSchedule{
+		ObjectMeta: metav1.ObjectMeta{Name: "schedule", Namespace: "velero-ns"},
+		Spec:       v1beta1.BackupScheduleSpec{Hooks: hooks},
+	}
+}
+
+func Test_validateBackupHooks(t *testing.T) {
+	exec := veleroapi.ExecHook{Command: []string{"sync"}}
+	tests := []struct {
+		name    string
+		hooks   *v1beta1.BackupHooks
+		wantErr bool
+	}{
+		{
+			name:    "no hooks",
+			wantErr: false,
+		},
+		{
+			name: "valid hooks",
+			hooks: &v1beta1.BackupHooks{
+				PreBackup:  []v1beta1.BackupHook{{Name: "freeze", Exec: exec, ResourceTypes: []string{"resources"}}},
+				PostBackup: []v1beta1.BackupHook{{Name: "unfreeze", Exec: exec}},
+				PauseReconcilers: []v1beta1.PausedReconciler{
+					{
+						APIVersion: "operator.open-cluster-management.io/v1",
+						Kind:       "MultiClusterHub",
+						Namespace:  "open-cluster-management",
+						Name:       "multiclusterhub",
+						Annotation: "mch-pause=true",
+					},
+					{Namespace: "open-cluster-management", Name: "hub-subscription"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "duplicate names",
+			hooks: &v1beta1.BackupHooks{
+				PreBackup:  []v1beta1.BackupHook{{Name: "hook", Exec: exec}},
+				PostBackup: []v1beta1.BackupHook{{Name: "hook", Exec: exec}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "no command",
+			hooks: &v1beta1.BackupHooks{
+				PreBackup: []v1beta1.BackupHook{{Name: "freeze"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown resource type",
+			hooks: &v1beta1.BackupHooks{
+				PreBackup: []v1beta1.BackupHook{{Name: "freeze", Exec: exec, ResourceTypes: []string{"pods"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "annotation without value",
+			hooks: &v1beta1.BackupHooks{
+				PauseReconcilers: []v1beta1.PausedReconciler{{
+					Namespace:  "open-cluster-management",
+					Name:       "multiclusterhub",
+					Annotation: "mch-pause",
+				}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "kind not allowed",
+			hooks: &v1beta1.BackupHooks{
+				PauseReconcilers: []v1beta1.PausedReconciler{{
+					APIVersion: "v1",
+					Kind:       "Secret",
+					Namespace:  "open-cluster-management",
+					Name:       "pull-secret",
+				}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "namespace not allowed",
+			hooks: &v1beta1.BackupHooks{
+				PauseReconcilers: []v1beta1.PausedReconciler{{Namespace: "kube-system", Name: "coredns"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "no namespace",
+			hooks: &v1beta1.BackupHooks{
+				PauseReconcilers: []v1beta1.PausedReconciler{{Name: "hub-subscription"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "kind not scalable",
+			hooks: &v1beta1.BackupHooks{
+				PauseReconcilers: []v1beta1.PausedReconciler{{
+					APIVersion: "operator.open-cluster-management.io/v1",
+					Kind:       "MultiClusterHub",
+					Namespace:  "open-cluster-management",
+					Name:       "multiclusterhub",
+				}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateBackupHooks(newHooksSchedule(tt.hooks)); (err != nil) != tt.wantErr {
+				t.Errorf("validateBackupHooks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_getVeleroBackupHooks(t *testing.T) {
+	backupSchedule := newHooksSchedule(&v1beta1.BackupHooks{
+		PreBackup: []v1beta1.BackupHook{{
+			Name:               "freeze",
+			ResourceTypes:      []string{string(Resources)},
+			IncludedNamespaces: []string{"app"},
+			Exec:               veleroapi.ExecHook{Command: []string{"fsfreeze", "--freeze", "/data"}},
+		}},
+		PostBackup: []v1beta1.BackupHook{{
+			Name: "notify",
+			Exec: veleroapi.ExecHook{Command: []string{"notify"}},
+		}},
+	})
+
+	hooks := getVeleroBackupHooks(backupSchedule, Resources)
+	if len(hooks.Resources) != 2 {
+		t.Fatalf("getVeleroBackupHooks() = %v, want 2 hooks", hooks.Resources)
+	}
+	if hooks.Resources[0].Name != "freeze" || len(hooks.Resources[0].PreHooks) != 1 ||
+		hooks.Resources[0].IncludedNamespaces[0] != "app" {
+		t.Errorf("getVeleroBackupHooks() pre hook = %v", hooks.Resources[0])
+	}
+	if hooks.Resources[1].Name != "notify" || len(hooks.Resources[1].PostHooks) != 1 {
+		t.Errorf("getVeleroBackupHooks() post hook = %v", hooks.Resources[1])
+	}
+	if hooks := getVeleroBackupHooks(backupSchedule, Credentials); len(hooks.Resources) != 1 {
+		t.Errorf("getVeleroBackupHooks() = %v for credentials, want 1 hook", hooks.Resources)
+	}
+
+	schedules := &veleroapi.ScheduleList{Items: []veleroapi.Schedule{
+		{ObjectMeta: metav1.ObjectMeta{Name: veleroScheduleNames[Resources]}},
+		{ObjectMeta: metav1.ObjectMeta{Name: veleroScheduleNames[Credentials] + "-secondary"}},
+	}}
+	schedules.Items[0].Spec.Template.Hooks = getVeleroBackupHooks(backupSchedule, Resources)
+	schedules.Items[1].Spec.Template.Hooks = getVeleroBackupHooks(backupSchedule, Credentials)
+	if isScheduleHooksUpdated(schedules, backupSchedule) {
+		t.Errorf("isScheduleHooksUpdated() = true for up to date schedules")
+	}
+	backupSchedule.Spec.Hooks.PostBackup = nil
+	if !isScheduleHooksUpdated(schedules, backupSchedule) {
+		t.Errorf("isScheduleHooksUpdated() = false after removing a hook")
+	}
+}
+
+func Test_isBackupDue(t *testing.T) {
+	lastBackup := metav1.NewTime(time.Date(2021, 9, 10, 10, 0, 0, 0, time.UTC))
+	hourly := veleroapi.Schedule{
+		Spec:   veleroapi.ScheduleSpec{Schedule: "0 * * * *"},
+		Status: veleroapi.ScheduleStatus{LastBackup: &lastBackup},
+	}
+	tests := []struct {
+		name      string
+		schedule  veleroapi.Schedule
+		now       time.Time
+		wantDue   bool
+		wantAfter time.Duration
+	}{
+		{
+			name:      "next backup later",
+			schedule:  hourly,
+			now:       lastBackup.Add(30 * time.Minute),
+			wantDue:   false,
+			wantAfter: 28 * time.Minute,
+		},
+		{
+			name:     "next backup about to start",
+			schedule: hourly,
+			now:      lastBackup.Add(59 * time.Minute),
+			wantDue:  true,
+		},
+		{
+			name:     "next backup not created yet",
+			schedule: hourly,
+			now:      lastBackup.Add(63 * time.Minute),
+			wantDue:  true,
+		},
+		{
+			name:     "next backup missed",
+			schedule: hourly,
+			now:      lastBackup.Add(70 * time.Minute),
+			wantDue:  false,
+		},
+		{
+			name:     "no backup yet",
+			schedule: veleroapi.Schedule{Spec: veleroapi.ScheduleSpec{Schedule: "0 * * * *"}},
+			now:      lastBackup.Add(30 * time.Minute),
+			wantDue:  false,
+		},
+		{
+			name:     "invalid schedule",
+			schedule: veleroapi.Schedule{Spec: veleroapi.ScheduleSpec{Schedule: "hourly"}},
+			now:      lastBackup.Add(30 * time.Minute),
+			wantDue:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due, after := isBackupDue([]veleroapi.Schedule{tt.schedule}, tt.now)
+			if due != tt.wantDue || after != tt.wantAfter {
+				t.Errorf("isBackupDue() = %v, %v, want %v, %v", due, after, tt.wantDue, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func Test_updatePausedReconcilers(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(testScheme)
+	_ = veleroapi.AddToScheme(testScheme)
+	_ = v1beta1.AddToScheme(testScheme)
+
+	replicas := int32(2)
+	backup := &veleroapi.Backup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      veleroScheduleNames[Resources] + "-20210910181336",
+			Namespace: "velero-ns",
+			Labels:    map[string]string{veleroapi.ScheduleNameLabel: veleroScheduleNames[Resources]},
+		},
+		Status: veleroapi.BackupStatus{Phase: veleroapi.BackupPhaseInProgress},
+	}
+	// the last backup was just created, the next one is not due before the next year
+	lastBackup := metav1.Now()
+	schedule := &veleroapi.Schedule{
+		ObjectMeta: metav1.ObjectMeta{Name: veleroScheduleNames[Resources], Namespace: "velero-ns"},
+		Spec:       veleroapi.ScheduleSpec{Schedule: "0 0 1 1 *"},
+		Status:     veleroapi.ScheduleStatus{LastBackup: &lastBackup},
+	}
+	backupSchedule := newHooksSchedule(&v1beta1.BackupHooks{
+		PauseReconcilers: []v1beta1.PausedReconciler{
+			{Namespace: "open-cluster-management", Name: "scaled"},
+			{Namespace: "open-cluster-management", Name: "annotated", Annotation: "pause=true"},
+			{Namespace: "open-cluster-management", Name: "missing"},
+			{
+				APIVersion: "operator.open-cluster-management.io/v1",
+				Kind:       "MultiClusterHub",
+				Namespace:  "open-cluster-management",
+				Name:       "multiclusterhub",
+				Annotation: "mch-pause=true",
+			},
+		},
+	})
+	multiClusterHub := &unstructured.Unstructured{}
+	multiClusterHub.SetAPIVersion("operator.open-cluster-management.io/v1")
+	multiClusterHub.SetKind("MultiClusterHub")
+	multiClusterHub.SetNamespace("open-cluster-management")
+	multiClusterHub.SetName("multiclusterhub")
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		backup,
+		schedule,
+		backupSchedule.DeepCopy(),
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "scaled", Namespace: "open-cluster-management"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "annotated", Namespace: "open-cluster-management"}},
+		multiClusterHub,
+	).Build()
+	r := &BackupScheduleReconciler{Client: c}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "velero-ns", Name: "schedule"},
+		backupSchedule); err != nil {
+		t.Fatal(err)
+	}
+
+	getDeployment := func(name string) *appsv1.Deployment {
+		deployment := &appsv1.Deployment{}
+		key := types.NamespacedName{Namespace: "open-cluster-management", Name: name}
+		if err := c.Get(context.Background(), key, deployment); err != nil {
+			t.Fatal(err)
+		}
+		return deployment
+	}
+	getMultiClusterHubAnnotations := func() map[string]string {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(multiClusterHub.GroupVersionKind())
+		key := types.NamespacedName{Namespace: "open-cluster-management", Name: "multiclusterhub"}
+		if err := c.Get(context.Background(), key, obj); err != nil {
+			t.Fatal(err)
+		}
+		return obj.GetAnnotations()
+	}
+	setBackupPhase := func(phase veleroapi.BackupPhase) {
+		backup.Status.Phase = phase
+		if err := c.Update(context.Background(), backup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkResumed := func() {
+		checkAfter, err := r.updatePausedReconcilers(context.Background(), backupSchedule)
+		if err != nil || checkAfter <= pausedReconcilersCheckInterval {
+			t.Fatalf("updatePausedReconcilers() = %v, %v, want the time until the next backup", checkAfter, err)
+		}
+		if len(backupSchedule.Status.PausedReconcilers) != 0 || len(backupSchedule.Finalizers) != 0 {
+			t.Errorf("updatePausedReconcilers() paused = %v, finalizers = %v",
+				backupSchedule.Status.PausedReconcilers, backupSchedule.Finalizers)
+		}
+		if scaled := getDeployment("scaled"); *scaled.Spec.Replicas != 2 || len(scaled.Annotations) != 0 {
+			t.Errorf("scaled deployment replicas = %d, annotations = %v", *scaled.Spec.Replicas, scaled.Annotations)
+		}
+		if annotated := getDeployment("annotated"); len(annotated.Annotations) != 0 {
+			t.Errorf("annotated deployment annotations = %v", annotated.Annotations)
+		}
+		if annotations := getMultiClusterHubAnnotations(); len(annotations) != 0 {
+			t.Errorf("multiclusterhub annotations = %v", annotations)
+		}
+	}
+
+	checkAfter, err := r.updatePausedReconcilers(context.Background(), backupSchedule)
+	if err != nil || checkAfter != pausedReconcilersCheckInterval {
+		t.Fatalf("updatePausedReconcilers() = %v, %v, want %v", checkAfter, err, pausedReconcilersCheckInterval)
+	}
+	if len(backupSchedule.Status.PausedReconcilers) != 3 {
+		t.Errorf("updatePausedReconcilers() paused = %v", backupSchedule.Status.PausedReconcilers)
+	}
+	if len(backupSchedule.Finalizers) != 1 || backupSchedule.Finalizers[0] != pausedReconcilersFinalizer {
+		t.Errorf("updatePausedReconcilers() finalizers = %v", backupSchedule.Finalizers)
+	}
+	if scaled := getDeployment("scaled"); *scaled.Spec.Replicas != 0 ||
+		scaled.Annotations[pausedReplicasAnnotation] != "2" {
+		t.Errorf("scaled deployment replicas = %d, annotations = %v", *scaled.Spec.Replicas, scaled.Annotations)
+	}
+	if annotated := getDeployment("annotated"); annotated.Annotations["pause"] != "true" {
+		t.Errorf("annotated deployment annotations = %v", annotated.Annotations)
+	}
+	if annotations := getMultiClusterHubAnnotations(); annotations["mch-pause"] != "true" {
+		t.Errorf("multiclusterhub annotations = %v", annotations)
+	}
+
+	// the reconcilers are resumed once the backup completes
+	setBackupPhase(veleroapi.BackupPhaseCompleted)
+	checkResumed()
+
+	// the paused resources are found from their annotation when the status was not saved
+	setBackupPhase(veleroapi.BackupPhaseInProgress)
+	if _, err := r.updatePausedReconcilers(context.Background(), backupSchedule); err != nil {
+		t.Fatal(err)
+	}
+	backupSchedule.Status.PausedReconcilers = nil
+	setBackupPhase(veleroapi.BackupPhaseCompleted)
+	checkResumed()
+}
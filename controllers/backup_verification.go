@@ -0,0 +1,329 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	clusterv1 "github.com/open-cluster-management/api/cluster/v1"
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// a kind is reported as a drop when the backup saved less than this fraction of the hub resources
+const backupVerificationDropRatio = 0.5
+
+// backupCompleted triggers a reconcile when a velero backup completes
+var backupCompleted = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldBackup, okOld := e.ObjectOld.(*veleroapi.Backup)
+		newBackup, okNew := e.ObjectNew.(*veleroapi.Backup)
+		return okOld && okNew &&
+			oldBackup.Status.Phase != newBackup.Status.Phase &&
+			newBackup.Status.Phase == veleroapi.BackupPhaseCompleted
+	},
+}
+
+// returns the timestamp of the latest set of completed backups produced by the primary velero schedules,
+// and the backups from this set by resource type
+func getLatestBackupSet(backups []veleroapi.Backup) (string, map[ResourceType]*veleroapi.Backup) {
+	sets := make(map[string]map[ResourceType]*veleroapi.Backup)
+	for i := range backups {
+		for key, scheduleName := range veleroScheduleNames {
+			if backups[i].Labels[veleroapi.ScheduleNameLabel] != scheduleName ||
+				!strings.HasPrefix(backups[i].Name, scheduleName+"-") {
+				continue
+			}
+			timestamp := strings.TrimPrefix(backups[i].Name, scheduleName+"-")
+			if sets[timestamp] == nil {
+				sets[timestamp] = make(map[ResourceType]*veleroapi.Backup, len(veleroScheduleNames))
+			}
+			sets[timestamp][key] = &backups[i]
+		}
+	}
+
+	latest := ""
+	for timestamp, set := range sets {
+		if timestamp <= latest || len(set) != len(veleroScheduleNames) {
+			continue
+		}
+		completed := true
+		for _, backup := range set {
+			if backup.Status.Phase != veleroapi.BackupPhaseCompleted {
+				completed = false
+				break
+			}
+		}
+		if completed {
+			latest = timestamp
+		}
+	}
+	if latest == "" {
+		return "", nil
+	}
+	return latest, sets[latest]
+}
+
+// returns the kinds verified for the backups of each resource type;
+// the generic resources backups have no known kinds and are not verified
+func getVerifiedKinds(
+	ctx context.Context,
+	dc discovery.DiscoveryInterface,
+) (map[ResourceType][]schema.GroupVersionKind, error) {
+	resourceKinds, err := getResourcesToBackupKinds(ctx, dc)
+	if err != nil {
+		return nil, err
+	}
+	secret := corev1.SchemeGroupVersion.WithKind("Secret")
+	return map[ResourceType][]schema.GroupVersionKind{
+		Credentials:        {secret},
+		CredentialsHive:    {secret},
+		CredentialsCluster: {secret},
+		ManagedClusters:    {clusterv1.SchemeGroupVersion.WithKind("ManagedCluster")},
+		Resources:          resourceKinds,
+	}, nil
+}
+
+// returns the number of hub resources of this kind the backup is expected to save:
+// resources matching the backup label selector, from the backed up namespaces and not being deleted
+func countHubResources(
+	ctx context.Context,
+	c client.Client,
+	gvk schema.GroupVersionKind,
+	backup *veleroapi.Backup,
+) (int, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	opts := []client.ListOption{}
+	if backup.Spec.LabelSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(backup.Spec.LabelSelector)
+		if err != nil {
+			return 0, err
+		}
+		opts = append(opts, client.MatchingLabelsSelector{Selector: selector})
+	}
+	if err := c.List(ctx, list, opts...); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range list.Items {
+		if list.Items[i].GetDeletionTimestamp() == nil &&
+			isNamespaceBackedUp(backup, list.Items[i].GetNamespace()) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// compares the number of resources of each kind saved by the backup with the hub resources;
+// returns the counts of the kinds found in the backup or on the hub and the kinds with a large drop
+func compareBackupResources(
+	backupName string,
+	kinds []schema.GroupVersionKind,
+	backedUpResources []backedUpResource,
+	hubCounts map[schema.GroupKind]int,
+) ([]v1beta1.BackupResourceCount, []string) {
+	// the version is ignored, velero saves the preferred version of each resource
+	backedUp := make(map[schema.GroupKind]int)
+	for _, res := range backedUpResources {
+		backedUp[res.gvk.GroupKind()]++
+	}
+
+	counts := []v1beta1.BackupResourceCount{}
+	drops := []string{}
+	for _, gvk := range kinds {
+		count := v1beta1.BackupResourceCount{
+			Backup:   backupName,
+			Kind:     gvk.GroupKind().String(),
+			BackedUp: backedUp[gvk.GroupKind()],
+			Live:     hubCounts[gvk.GroupKind()],
+		}
+		if count.BackedUp == 0 && count.Live == 0 {
+			continue
+		}
+		counts = append(counts, count)
+		if float64(count.BackedUp) < float64(count.Live)*backupVerificationDropRatio {
+			drops = append(drops, fmt.Sprintf(
+				"%s saved %d of %d %s resources",
+				backupName,
+				count.BackedUp,
+				count.Live,
+				count.Kind,
+			))
+		}
+	}
+	return counts, drops
+}
+
+// returns the timestamp of the latest set of completed backups in the backup schedule namespace,
+// or an empty string if no set of backups completed
+func (r *BackupScheduleReconciler) getLatestBackupSetTimestamp(
+	ctx context.Context,
+	backupSchedule *v1beta1.BackupSchedule,
+) (string, error) {
+	veleroBackups := &veleroapi.BackupList{}
+	if err := r.List(ctx, veleroBackups, client.InNamespace(backupSchedule.Namespace)); err != nil {
+		return "", fmt.Errorf("unable to list velero backups: %v", err)
+	}
+	timestamp, _ := getLatestBackupSet(veleroBackups.Items)
+	return timestamp, nil
+}
+
+// verifies the latest completed backups saved the resources found on the hub
+// and reports the result in the schedule status and metrics;
+// returns errDownloadNotReady while velero hasn't provided the backup resource lists
+func (r *BackupScheduleReconciler) verifyLatestBackups(
+	ctx context.Context,
+	backupSchedule *v1beta1.BackupSchedule,
+) error {
+	scheduleLogger := log.FromContext(ctx)
+
+	veleroBackups := &veleroapi.BackupList{}
+	if err := r.List(ctx, veleroBackups, client.InNamespace(backupSchedule.Namespace)); err != nil {
+		return fmt.Errorf("unable to list velero backups: %v", err)
+	}
+	timestamp, backups := getLatestBackupSet(veleroBackups.Items)
+	if timestamp == "" || (backupSchedule.Status.BackupVerification != nil &&
+		backupSchedule.Status.BackupVerification.BackupTimestamp == timestamp) {
+		// no new completed backups
+		return nil
+	}
+
+	kinds, err := getVerifiedKinds(ctx, r.DiscoveryClient)
+	if err != nil {
+		return err
+	}
+	keys := make([]ResourceType, 0, len(kinds))
+	for key := range kinds {
+		keys = append(keys, key)
+	}
+	sort.Sort(SortResourceType(keys))
+
+	resourceLists := make(map[ResourceType]map[string][]string, len(keys))
+	waitingForBackups := false
+	for _, key := range keys {
+		resourceList := map[string][]string{}
+		err := downloadVeleroFile(
+			ctx,
+			r.Client,
+			backupSchedule.Namespace,
+			backups[key].Name,
+			veleroapi.DownloadTargetKindBackupResourceList,
+			decodeJSON(&resourceList),
+		)
+		if errors.Is(err, errDownloadNotReady) {
+			// keep going, to request all resource lists at once
+			waitingForBackups = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		resourceLists[key] = resourceList
+	}
+	if waitingForBackups {
+		return errDownloadNotReady
+	}
+
+	verification := &v1beta1.BackupVerification{
+		BackupTimestamp:  timestamp,
+		VerificationTime: &metav1.Time{Time: time.Now()},
+	}
+	backupVerificationResources.Reset()
+	for _, key := range keys {
+		backup := backups[key]
+		hubCounts := make(map[schema.GroupKind]int, len(kinds[key]))
+		for _, gvk := range kinds[key] {
+			count, err := countHubResources(ctx, r.Client, gvk, backup)
+			if err != nil {
+				scheduleLogger.Error(err, "failed to count hub resources", "kind", gvk.String())
+				continue
+			}
+			hubCounts[gvk.GroupKind()] = count
+		}
+
+		counts, drops := compareBackupResources(
+			backup.Name,
+			kinds[key],
+			parseBackupResourceList(resourceLists[key]),
+			hubCounts,
+		)
+		verification.Resources = append(verification.Resources, counts...)
+		verification.Drops = append(verification.Drops, drops...)
+
+		scheduleName := veleroScheduleNames[key]
+		for _, count := range counts {
+			backupVerificationResources.WithLabelValues(scheduleName, count.Kind, "backup").Set(float64(count.BackedUp))
+			backupVerificationResources.WithLabelValues(scheduleName, count.Kind, "hub").Set(float64(count.Live))
+		}
+		backupVerificationDrops.WithLabelValues(scheduleName).Set(float64(len(drops)))
+	}
+
+	if len(verification.Drops) > 0 {
+		scheduleLogger.Info("backups saved much less resources than found on the hub",
+			"drops", verification.Drops)
+	}
+	backupSchedule.Status.BackupVerification = verification
+	setBackupVerifiedCondition(backupSchedule, verification)
+	return nil
+}
+
+// sets the BackupVerified condition, false if the verified backups have drops
+func setBackupVerifiedCondition(
+	backupSchedule *v1beta1.BackupSchedule,
+	verification *v1beta1.BackupVerification,
+) {
+	condition := metav1.Condition{
+		Type:               v1beta1.BackupScheduleConditionBackupVerified,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: backupSchedule.Generation,
+		Reason:             "BackupContentVerified",
+		Message: fmt.Sprintf(
+			"Backups %s saved the resources found on the hub",
+			verification.BackupTimestamp,
+		),
+	}
+	if len(verification.Drops) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "BackupContentDrop"
+		condition.Message = fmt.Sprintf(
+			"Backups %s saved much less resources than found on the hub: %s",
+			verification.BackupTimestamp,
+			strings.Join(verification.Drops, "; "),
+		)
+	}
+	apimeta.SetStatusCondition(&backupSchedule.Status.Conditions, condition)
+}
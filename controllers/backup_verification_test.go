@@ -0,0 +1,159 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newScheduledBackup(scheduleName, timestamp string, phase veleroapi.BackupPhase) veleroapi.Backup {
+	return veleroapi.Backup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      scheduleName + "-" + timestamp,
+			Namespace: "velero",
+			Labels:    map[string]string{veleroapi.ScheduleNameLabel: scheduleName},
+		},
+		Status: veleroapi.BackupStatus{Phase: phase},
+	}
+}
+
+func Test_getLatestBackupSet(t *testing.T) {
+	backups := []veleroapi.Backup{}
+	for _, scheduleName := range veleroScheduleNames {
+		backups = append(backups,
+			newScheduledBackup(scheduleName, "20211019100000", veleroapi.BackupPhaseCompleted),
+			newScheduledBackup(scheduleName, "20211019110000", veleroapi.BackupPhaseCompleted),
+		)
+		if scheduleName != veleroScheduleNames[Resources] {
+			backups = append(backups,
+				newScheduledBackup(scheduleName, "20211019120000", veleroapi.BackupPhaseCompleted))
+		}
+	}
+	// a secondary location backup doesn't complete a backup set
+	backups = append(backups,
+		newScheduledBackup(getSecondaryScheduleName(veleroScheduleNames[Resources], "dr"), "20211019120000",
+			veleroapi.BackupPhaseCompleted))
+
+	timestamp, set := getLatestBackupSet(backups)
+	if timestamp != "20211019110000" {
+		t.Fatalf("getLatestBackupSet() timestamp = %v, want 20211019110000", timestamp)
+	}
+	if len(set) != len(veleroScheduleNames) {
+		t.Errorf("getLatestBackupSet() returned %d backups, want %d", len(set), len(veleroScheduleNames))
+	}
+	if set[Resources].Name != "acm-resources-schedule-20211019110000" {
+		t.Errorf("getLatestBackupSet() resources backup = %v", set[Resources].Name)
+	}
+
+	// the backup set is verified once all its backups are completed
+	for i := range backups {
+		if backups[i].Name == "acm-resources-schedule-20211019110000" {
+			backups[i].Status.Phase = veleroapi.BackupPhaseInProgress
+		}
+	}
+	if timestamp, _ := getLatestBackupSet(backups); timestamp != "20211019100000" {
+		t.Errorf("getLatestBackupSet() timestamp = %v, want 20211019100000", timestamp)
+	}
+
+	if timestamp, _ := getLatestBackupSet(backups[:1]); timestamp != "" {
+		t.Errorf("getLatestBackupSet() timestamp = %v for an incomplete set, want none", timestamp)
+	}
+}
+
+func Test_compareBackupResources(t *testing.T) {
+	policy := schema.GroupVersionKind{Group: "policy.open-cluster-management.io", Version: "v1", Kind: "Policy"}
+	channel := schema.GroupVersionKind{Group: "apps.open-cluster-management.io", Version: "v1", Kind: "Channel"}
+	placement := schema.GroupVersionKind{Group: "cluster.open-cluster-management.io", Version: "v1alpha1", Kind: "Placement"}
+
+	backedUp := parseBackupResourceList(map[string][]string{
+		"apps.open-cluster-management.io/v1/Channel": {"ns1/channel1", "ns1/channel2"},
+	})
+	counts, drops := compareBackupResources(
+		"acm-resources-schedule-20211019110000",
+		[]schema.GroupVersionKind{policy, channel, placement},
+		backedUp,
+		map[schema.GroupKind]int{policy.GroupKind(): 4, channel.GroupKind(): 3},
+	)
+
+	wantCounts := []v1beta1.BackupResourceCount{
+		{
+			Backup:   "acm-resources-schedule-20211019110000",
+			Kind:     "Policy.policy.open-cluster-management.io",
+			BackedUp: 0,
+			Live:     4,
+		},
+		{
+			Backup:   "acm-resources-schedule-20211019110000",
+			Kind:     "Channel.apps.open-cluster-management.io",
+			BackedUp: 2,
+			Live:     3,
+		},
+	}
+	if !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("compareBackupResources() counts = %v, want %v", counts, wantCounts)
+	}
+	wantDrops := []string{
+		"acm-resources-schedule-20211019110000 saved 0 of 4 Policy.policy.open-cluster-management.io resources",
+	}
+	if !reflect.DeepEqual(drops, wantDrops) {
+		t.Errorf("compareBackupResources() drops = %v, want %v", drops, wantDrops)
+	}
+}
+
+func Test_countHubResources(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(testScheme)
+
+	newSecret := func(name, namespace string, labels map[string]string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+	}
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		newSecret("user-1", "ns1", map[string]string{backupCredsUserLabel: "aws"}),
+		newSecret("user-2", "ns2", map[string]string{backupCredsUserLabel: "aws"}),
+		newSecret("user-3", "local-cluster", map[string]string{backupCredsUserLabel: "aws"}),
+		newSecret("other", "ns1", nil),
+	).Build()
+
+	backup := newScheduledBackup(veleroScheduleNames[Credentials], "20211019110000", veleroapi.BackupPhaseCompleted)
+	backup.Spec.LabelSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: backupCredsUserLabel, Operator: metav1.LabelSelectorOpExists},
+	}}
+	backup.Spec.ExcludedNamespaces = []string{"local-cluster"}
+
+	count, err := countHubResources(
+		context.Background(),
+		c,
+		corev1.SchemeGroupVersion.WithKind("Secret"),
+		&backup,
+	)
+	if err != nil {
+		t.Fatalf("countHubResources() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("countHubResources() = %v, want 2", count)
+	}
+}
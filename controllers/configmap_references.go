@@ -0,0 +1,209 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"regexp"
+
+	chnv1 "github.com/open-cluster-management/multicloud-operators-channel/pkg/apis/apps/v1"
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// value of the backup label set on the ConfigMaps referenced by backed up resources,
+// the label is removed from these ConfigMaps once they are no longer referenced
+const referencedConfigMapLabelValue = "referenced-configmap"
+
+// policyGVK is the kind of the governance policies
+var policyGVK = schema.GroupVersionKind{Group: "policy.open-cluster-management.io", Version: "v1", Kind: "Policy"}
+
+// hubConfigMapTemplate matches the policy hub templates reading a ConfigMap, {{hub fromConfigMap "ns" "name" "key" hub}}
+var hubConfigMapTemplate = regexp.MustCompile(`\{\{-?\s*hub\s+fromConfigMap\s+"([^"]*)"\s+"([^"]*)"`)
+
+// configMapReferrer is a backed up resource kind which can reference ConfigMaps
+type configMapReferrer struct {
+	gvk schema.GroupVersionKind
+	// returns the names of the ConfigMaps referenced by the resource
+	getConfigMapRefs func(*unstructured.Unstructured) []types.NamespacedName
+}
+
+// configMapReferrers are the backed up resources whose referenced ConfigMaps are backed up
+var configMapReferrers = []configMapReferrer{
+	{
+		gvk:              chnv1.SchemeGroupVersion.WithKind("Channel"),
+		getConfigMapRefs: getChannelConfigMapRefs,
+	},
+	{
+		gvk:              hivev1.SchemeGroupVersion.WithKind("ClusterDeployment"),
+		getConfigMapRefs: getClusterDeploymentConfigMapRefs,
+	},
+	{
+		gvk:              policyGVK,
+		getConfigMapRefs: getPolicyConfigMapRefs,
+	},
+}
+
+// returns the ConfigMap referenced by the channel, defaulting to the channel namespace
+func getChannelConfigMapRefs(obj *unstructured.Unstructured) []types.NamespacedName {
+	name, _, _ := unstructured.NestedString(obj.Object, "spec", "configMapRef", "name")
+	if name == "" {
+		return nil
+	}
+	namespace, _, _ := unstructured.NestedString(obj.Object, "spec", "configMapRef", "namespace")
+	if namespace == "" {
+		namespace = obj.GetNamespace()
+	}
+	return []types.NamespacedName{{Namespace: namespace, Name: name}}
+}
+
+// returns the install manifests ConfigMap referenced by the cluster deployment
+func getClusterDeploymentConfigMapRefs(obj *unstructured.Unstructured) []types.NamespacedName {
+	name, _, _ := unstructured.NestedString(obj.Object, "spec", "provisioning", "manifestsConfigMapRef", "name")
+	if name == "" {
+		return nil
+	}
+	return []types.NamespacedName{{Namespace: obj.GetNamespace(), Name: name}}
+}
+
+// returns the ConfigMaps read by the hub templates of the policy, defaulting to the policy namespace
+func getPolicyConfigMapRefs(obj *unstructured.Unstructured) []types.NamespacedName {
+	refs := []types.NamespacedName{}
+	walkStrings(obj.Object["spec"], func(value string) {
+		for _, match := range hubConfigMapTemplate.FindAllStringSubmatch(value, -1) {
+			namespace := match[1]
+			if namespace == "" {
+				namespace = obj.GetNamespace()
+			}
+			if match[2] != "" {
+				refs = append(refs, types.NamespacedName{Namespace: namespace, Name: match[2]})
+			}
+		}
+	})
+	return refs
+}
+
+// calls fn with each string value found in the unstructured content
+func walkStrings(content interface{}, fn func(string)) {
+	switch value := content.(type) {
+	case string:
+		fn(value)
+	case map[string]interface{}:
+		for _, item := range value {
+			walkStrings(item, fn)
+		}
+	case []interface{}:
+		for _, item := range value {
+			walkStrings(item, fn)
+		}
+	}
+}
+
+// returns the ConfigMaps referenced by the resources saved by the resources backup
+func getReferencedConfigMaps(
+	ctx context.Context,
+	c client.Client,
+) (map[types.NamespacedName]bool, error) {
+	// the referencing resources must be saved by the resources backup
+	excludedNamespaces := getResourcesBackupExcludedNamespaces(ctx, c)
+
+	referenced := map[types.NamespacedName]bool{}
+	for _, referrer := range configMapReferrers {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(referrer.gvk.GroupVersion().WithKind(referrer.gvk.Kind + "List"))
+		if err := c.List(ctx, list); err != nil {
+			if apimeta.IsNoMatchError(err) {
+				// the resource is not installed on the hub
+				continue
+			}
+			return nil, err
+		}
+		for i := range list.Items {
+			if namespace := list.Items[i].GetNamespace(); isRestoreTestNamespace(namespace) ||
+				findValue(excludedNamespaces, namespace) {
+				continue
+			}
+			for _, ref := range referrer.getConfigMapRefs(&list.Items[i]) {
+				referenced[ref] = true
+			}
+		}
+	}
+	return referenced, nil
+}
+
+// adds the backup label to the ConfigMaps referenced by backed up resources, so they are saved by the
+// generic resources backup, and removes the label from the ConfigMaps no longer referenced
+func labelReferencedConfigMaps(ctx context.Context, c client.Client) error {
+	scheduleLogger := log.FromContext(ctx)
+
+	referenced, err := getReferencedConfigMaps(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	labeled := &corev1.ConfigMapList{}
+	if err := c.List(
+		ctx,
+		labeled,
+		client.MatchingLabels{backupCredsClusterLabel: referencedConfigMapLabelValue},
+	); err != nil {
+		return err
+	}
+	for i := range labeled.Items {
+		configMap := &labeled.Items[i]
+		if isRestoreTestNamespace(configMap.Namespace) ||
+			referenced[types.NamespacedName{Namespace: configMap.Namespace, Name: configMap.Name}] {
+			continue
+		}
+		delete(configMap.Labels, backupCredsClusterLabel)
+		if err := c.Update(ctx, configMap); err != nil {
+			return err
+		}
+		scheduleLogger.Info("Backup label removed from ConfigMap no longer referenced",
+			"name", configMap.Name, "namespace", configMap.Namespace)
+	}
+
+	for ref := range referenced {
+		configMap := &corev1.ConfigMap{}
+		if err := c.Get(ctx, ref, configMap); err != nil {
+			if client.IgnoreNotFound(err) == nil {
+				continue
+			}
+			return err
+		}
+		if _, ok := configMap.Labels[backupCredsClusterLabel]; ok {
+			// already backed up
+			continue
+		}
+		if configMap.Labels == nil {
+			configMap.Labels = map[string]string{}
+		}
+		configMap.Labels[backupCredsClusterLabel] = referencedConfigMapLabelValue
+		if err := c.Update(ctx, configMap); err != nil {
+			return err
+		}
+		scheduleLogger.Info("Backup label added to referenced ConfigMap",
+			"name", configMap.Name, "namespace", configMap.Namespace)
+	}
+	return nil
+}
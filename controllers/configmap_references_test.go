@@ -0,0 +1,123 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	chnv1 "github.com/open-cluster-management/multicloud-operators-channel/pkg/apis/apps/v1"
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_getPolicyConfigMapRefs(t *testing.T) {
+	policy := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "policy1", "namespace": "policies"},
+		"spec": map[string]interface{}{
+			"policy-templates": []interface{}{
+				map[string]interface{}{
+					"objectDefinition": map[string]interface{}{
+						"data": map[string]interface{}{
+							"ca":     `{{hub fromConfigMap "" "ca-bundle" "ca.crt" hub}}`,
+							"region": `{{hub fromConfigMap "config" "regions" (printf "%s" .ManagedClusterName) hub}}`,
+							// managed cluster templates read ConfigMaps from the managed cluster
+							"local": `{{ fromConfigMap "default" "local" "key" }}`,
+						},
+					},
+				},
+			},
+		},
+	}}
+
+	got := map[types.NamespacedName]bool{}
+	for _, ref := range getPolicyConfigMapRefs(policy) {
+		got[ref] = true
+	}
+	want := map[types.NamespacedName]bool{
+		{Namespace: "policies", Name: "ca-bundle"}: true,
+		{Namespace: "config", Name: "regions"}:     true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getPolicyConfigMapRefs() = %v, want %v", got, want)
+	}
+}
+
+func Test_labelReferencedConfigMaps(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(testScheme)
+	_ = chnv1.AddToScheme(testScheme)
+	_ = hivev1.AddToScheme(testScheme)
+
+	newConfigMap := func(namespace, name string, labels map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+	}
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		&chnv1.Channel{
+			ObjectMeta: metav1.ObjectMeta{Name: "git", Namespace: "ns1"},
+			Spec:       chnv1.ChannelSpec{ConfigMapRef: &corev1.ObjectReference{Name: "git-ca"}},
+		},
+		// local-cluster resources are not backed up
+		&chnv1.Channel{
+			ObjectMeta: metav1.ObjectMeta{Name: "local", Namespace: "local-cluster"},
+			Spec:       chnv1.ChannelSpec{ConfigMapRef: &corev1.ObjectReference{Name: "local-ca"}},
+		},
+		// the namespace of the charts-v1 channel is not backed up
+		&chnv1.Channel{
+			ObjectMeta: metav1.ObjectMeta{Name: "charts-v1", Namespace: "charts"},
+			Spec:       chnv1.ChannelSpec{ConfigMapRef: &corev1.ObjectReference{Name: "charts-ca"}},
+		},
+		&hivev1.ClusterDeployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster1", Namespace: "cluster1"},
+			Spec: hivev1.ClusterDeploymentSpec{Provisioning: &hivev1.Provisioning{
+				ManifestsConfigMapRef: &corev1.LocalObjectReference{Name: "cluster1-manifests"},
+			}},
+		},
+		newConfigMap("ns1", "git-ca", nil),
+		newConfigMap("local-cluster", "local-ca", nil),
+		newConfigMap("charts", "charts-ca", nil),
+		newConfigMap("cluster1", "cluster1-manifests", map[string]string{backupCredsClusterLabel: "user"}),
+		newConfigMap("ns2", "old", map[string]string{backupCredsClusterLabel: referencedConfigMapLabelValue}),
+	).Build()
+
+	if err := labelReferencedConfigMaps(context.Background(), c); err != nil {
+		t.Fatalf("labelReferencedConfigMaps() error = %v", err)
+	}
+
+	wantLabels := map[types.NamespacedName]map[string]string{
+		{Namespace: "ns1", Name: "git-ca"}:                  {backupCredsClusterLabel: referencedConfigMapLabelValue},
+		{Namespace: "local-cluster", Name: "local-ca"}:      nil,
+		{Namespace: "charts", Name: "charts-ca"}:            nil,
+		{Namespace: "cluster1", Name: "cluster1-manifests"}: {backupCredsClusterLabel: "user"},
+		{Namespace: "ns2", Name: "old"}:                     {},
+	}
+	for name, want := range wantLabels {
+		configMap := &corev1.ConfigMap{}
+		if err := c.Get(context.Background(), name, configMap); err != nil {
+			t.Fatal(err)
+		}
+		if len(configMap.Labels) != len(want) || (len(want) > 0 && !reflect.DeepEqual(configMap.Labels, want)) {
+			t.Errorf("labelReferencedConfigMaps() %v labels = %v, want %v", name, configMap.Labels, want)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"strings"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/label"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// SealedSecretTypeLabel is set on the encrypted copies of the backed up credentials,
+	// with the type of the credentials: user, hive or cluster
+	SealedSecretTypeLabel = "cluster.open-cluster-management.io/sealed-secret-type"
+	// annotation set on the encrypted copies with the name of the credentials secret
+	sealedSecretNameAnnotation = "cluster.open-cluster-management.io/sealed-secret-name"
+	// prefix of the encrypted copies names
+	sealedSecretPrefix = "acm-sealed-"
+	// data key of the encrypted copies holding the encrypted credentials
+	sealedSecretDataKey = "sealed"
+	// default data key of the encryption key secret
+	defaultEncryptionKey = "key"
+	// max length of a secret name
+	maxSecretNameLength = 253
+)
+
+// backup labels of the credentials secrets, by type of credentials
+var credentialsBackupLabels = []struct {
+	label           string
+	credentialsType SecretType
+}{
+	{backupCredsUserLabel, UserSecret},
+	{backupCredsHiveLabel, HiveSecret},
+	{backupCredsClusterLabel, ClusterSecret},
+}
+
+// resource types of the credentials backups
+var credentialsResourceTypes = map[ResourceType]SecretType{
+	Credentials:        UserSecret,
+	CredentialsHive:    HiveSecret,
+	CredentialsCluster: ClusterSecret,
+}
+
+// sealedPayload is the content of a credentials secret saved encrypted in its copy
+type sealedPayload struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Type        corev1.SecretType `json:"type,omitempty"`
+	Data        map[string][]byte `json:"data,omitempty"`
+}
+
+// credentialsSecretChanged triggers a reconcile when a backed up credentials secret changes
+var credentialsSecretChanged = predicate.NewPredicateFuncs(func(obj client.Object) bool {
+	return getCredentialsType(obj.GetLabels()) != ""
+})
+
+// returns the type of credentials from the backup labels of the secret, empty if the secret is not backed up
+func getCredentialsType(labels map[string]string) SecretType {
+	if credentialsTypes := getCredentialsTypes(labels); len(credentialsTypes) > 0 {
+		return credentialsTypes[0]
+	}
+	return ""
+}
+
+// returns the types of credentials from the backup labels of the secret,
+// a secret with several backup labels is saved by several credentials backups
+func getCredentialsTypes(labels map[string]string) []SecretType {
+	credentialsTypes := []SecretType{}
+	for _, backupLabel := range credentialsBackupLabels {
+		if _, ok := labels[backupLabel.label]; ok {
+			credentialsTypes = append(credentialsTypes, backupLabel.credentialsType)
+		}
+	}
+	return credentialsTypes
+}
+
+// returns the type of credentials saved by the velero schedule, empty for the other schedules
+func getScheduleCredentialsType(scheduleName string) SecretType {
+	for key, secretType := range credentialsResourceTypes {
+		// secondary schedules are named after the primary schedule
+		if scheduleName == veleroScheduleNames[key] ||
+			strings.HasPrefix(scheduleName, veleroScheduleNames[key]+"-") {
+			return secretType
+		}
+	}
+	return ""
+}
+
+// backup the encrypted copies of the credentials instead of the credentials
+func setSealedCredsBackupInfo(veleroBackupTemplate *veleroapi.BackupSpec, credentialsType SecretType) {
+	veleroBackupTemplate.LabelSelector = &metav1.LabelSelector{
+		MatchLabels: map[string]string{SealedSecretTypeLabel: string(credentialsType)},
+	}
+}
+
+// returns true if the credentials velero schedules don't match the encryption setting of the backup schedule
+func isScheduleEncryptionUpdated(schedules *veleroapi.ScheduleList, backupSchedule *v1beta1.BackupSchedule) bool {
+	encrypted := backupSchedule.Spec.CredentialsEncryption != nil
+	for i := range schedules.Items {
+		if getScheduleCredentialsType(schedules.Items[i].Name) == "" {
+			continue
+		}
+		selector := schedules.Items[i].Spec.Template.LabelSelector
+		sealed := false
+		if selector != nil {
+			_, sealed = selector.MatchLabels[SealedSecretTypeLabel]
+		}
+		if sealed != encrypted {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the AES-256 key derived from the content of the encryption key secret
+func getEncryptionKey(
+	ctx context.Context,
+	c client.Client,
+	namespace string,
+	encryption *v1beta1.CredentialsEncryption,
+) ([]byte, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(
+		ctx,
+		types.NamespacedName{Namespace: namespace, Name: encryption.KeySecretName},
+		secret,
+	); err != nil {
+		return nil, fmt.Errorf("unable to get the encryption key secret %s/%s: %v",
+			namespace, encryption.KeySecretName, err)
+	}
+	dataKey := encryption.KeySecretKey
+	if dataKey == "" {
+		dataKey = defaultEncryptionKey
+	}
+	if len(secret.Data[dataKey]) == 0 {
+		return nil, fmt.Errorf("encryption key secret %s/%s has no %s key",
+			namespace, encryption.KeySecretName, dataKey)
+	}
+	key := sha256.Sum256(secret.Data[dataKey])
+	return key[:], nil
+}
+
+// encrypts the data with AES-GCM, the secret identity is authenticated with the data
+func sealData(key []byte, plaintext []byte, identity string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, []byte(identity)), nil
+}
+
+// decrypts data encrypted by sealData for the same secret identity
+func unsealData(key []byte, sealed []byte, identity string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, []byte(identity))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// returns the name of the encrypted copy of a credentials secret for this type of credentials
+func getSealedSecretName(name string, credentialsType SecretType) string {
+	sealedName := sealedSecretPrefix + string(credentialsType) + "-" + name
+	if len(sealedName) <= maxSecretNameLength {
+		return sealedName
+	}
+	// keep the names unique when trimmed
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(sealedName))
+	suffix := fmt.Sprintf("-%08x", hash.Sum32())
+	return strings.TrimRight(sealedName[:maxSecretNameLength-len(suffix)], "-.") + suffix
+}
+
+// returns the content of a credentials secret saved in its encrypted copy
+func getSealedPayload(secret *corev1.Secret) sealedPayload {
+	return sealedPayload{
+		Labels:      secret.Labels,
+		Annotations: secret.Annotations,
+		Type:        secret.Type,
+		Data:        secret.Data,
+	}
+}
+
+// returns the content of the credentials secret decrypted from the encrypted copy
+func unsealSecret(key []byte, sealedSecret *corev1.Secret) (string, *sealedPayload, error) {
+	name := sealedSecret.Annotations[sealedSecretNameAnnotation]
+	if name == "" {
+		return "", nil, fmt.Errorf("encrypted secret %s/%s has no %s annotation",
+			sealedSecret.Namespace, sealedSecret.Name, sealedSecretNameAnnotation)
+	}
+	plaintext, err := unsealData(key, sealedSecret.Data[sealedSecretDataKey], sealedSecret.Namespace+"/"+name)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to decrypt secret %s/%s: %v", sealedSecret.Namespace, name, err)
+	}
+	payload := &sealedPayload{}
+	if err := json.Unmarshal(plaintext, payload); err != nil {
+		return "", nil, err
+	}
+	return name, payload, nil
+}
+
+// returns the encrypted copy of a credentials secret
+func sealSecret(key []byte, secret *corev1.Secret, credentialsType SecretType) (*corev1.Secret, error) {
+	plaintext, err := json.Marshal(getSealedPayload(secret))
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealData(key, plaintext, secret.Namespace+"/"+secret.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        getSealedSecretName(secret.Name, credentialsType),
+			Namespace:   secret.Namespace,
+			Labels:      map[string]string{SealedSecretTypeLabel: string(credentialsType)},
+			Annotations: map[string]string{sealedSecretNameAnnotation: secret.Name},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{sealedSecretDataKey: sealed},
+	}, nil
+}
+
+// returns the backed up credentials secrets, listed by backup label instead of listing all the hub secrets
+func listCredentialsSecrets(ctx context.Context, c client.Client) ([]corev1.Secret, error) {
+	secrets := []corev1.Secret{}
+	listed := make(map[types.NamespacedName]bool)
+	for _, backupLabel := range credentialsBackupLabels {
+		labeledSecrets := &corev1.SecretList{}
+		if err := c.List(ctx, labeledSecrets, client.HasLabels{backupLabel.label}); err != nil {
+			return nil, err
+		}
+		for i := range labeledSecrets.Items {
+			if isRestoreTestNamespace(labeledSecrets.Items[i].Namespace) {
+				continue
+			}
+			identity := types.NamespacedName{
+				Namespace: labeledSecrets.Items[i].Namespace,
+				Name:      labeledSecrets.Items[i].Name,
+			}
+			if !listed[identity] {
+				listed[identity] = true
+				secrets = append(secrets, labeledSecrets.Items[i])
+			}
+		}
+	}
+	return secrets, nil
+}
+
+// keeps an encrypted copy of each backed up credentials secret for each of its credentials types,
+// which is backed up instead of the credentials; the encrypted copies are removed
+// when the credentials encryption is disabled
+func syncSealedCredentials(
+	ctx context.Context,
+	c client.Client,
+	backupSchedule *v1beta1.BackupSchedule,
+) error {
+	sealedSecretList := &corev1.SecretList{}
+	if err := c.List(ctx, sealedSecretList, client.HasLabels{SealedSecretTypeLabel}); err != nil {
+		return err
+	}
+	sealedSecrets := make(map[types.NamespacedName]*corev1.Secret)
+	for i := range sealedSecretList.Items {
+		if isRestoreTestNamespace(sealedSecretList.Items[i].Namespace) {
+			// restored by a test restore, removed with its sandbox namespace
+			continue
+		}
+		sealedSecrets[types.NamespacedName{
+			Namespace: sealedSecretList.Items[i].Namespace,
+			Name:      sealedSecretList.Items[i].Name,
+		}] = &sealedSecretList.Items[i]
+	}
+
+	if backupSchedule.Spec.CredentialsEncryption != nil {
+		key, err := getEncryptionKey(ctx, c, backupSchedule.Namespace, backupSchedule.Spec.CredentialsEncryption)
+		if err != nil {
+			return err
+		}
+		secrets, err := listCredentialsSecrets(ctx, c)
+		if err != nil {
+			return err
+		}
+		for i := range secrets {
+			secret := &secrets[i]
+			for _, credentialsType := range getCredentialsTypes(secret.Labels) {
+				sealedIdentity := types.NamespacedName{
+					Namespace: secret.Namespace,
+					Name:      getSealedSecretName(secret.Name, credentialsType),
+				}
+				existing := sealedSecrets[sealedIdentity]
+				delete(sealedSecrets, sealedIdentity)
+				if err := updateSealedSecret(ctx, c, key, secret, credentialsType, existing); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// remove the copies of deleted credentials
+	for _, sealedSecret := range sealedSecrets {
+		if err := c.Delete(ctx, sealedSecret); err != nil && !k8serr.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// creates or updates the encrypted copy of the credentials secret, if its content changed
+func updateSealedSecret(
+	ctx context.Context,
+	c client.Client,
+	key []byte,
+	secret *corev1.Secret,
+	credentialsType SecretType,
+	existing *corev1.Secret,
+) error {
+	if existing != nil && existing.Labels[SealedSecretTypeLabel] == string(credentialsType) {
+		// the encryption is not deterministic, compare the decrypted content
+		if name, payload, err := unsealSecret(key, existing); err == nil &&
+			name == secret.Name && reflect.DeepEqual(*payload, getSealedPayload(secret)) {
+			return nil
+		}
+	}
+	sealedSecret, err := sealSecret(key, secret, credentialsType)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return c.Create(ctx, sealedSecret)
+	}
+	existing.Labels = sealedSecret.Labels
+	existing.Annotations = sealedSecret.Annotations
+	existing.Type = sealedSecret.Type
+	existing.Data = sealedSecret.Data
+	return c.Update(ctx, existing)
+}
+
+// returns the encrypted copies of the credentials restored by the credentials velero restores
+func (r *RestoreReconciler) getRestoredSealedSecrets(
+	ctx context.Context,
+	veleroRestoreList *veleroapi.RestoreList,
+) ([]corev1.Secret, error) {
+	sealedSecrets := []corev1.Secret{}
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		if key, ok := getVeleroRestoreResourceType(veleroRestore); !ok || credentialsResourceTypes[key] == "" {
+			continue
+		}
+		secrets := &corev1.SecretList{}
+		if err := r.List(
+			ctx,
+			secrets,
+			client.MatchingLabels{veleroapi.RestoreNameLabel: label.GetValidName(veleroRestore.Name)},
+		); err != nil {
+			return nil, err
+		}
+		for j := range secrets.Items {
+			if _, ok := secrets.Items[j].Labels[SealedSecretTypeLabel]; ok {
+				sealedSecrets = append(sealedSecrets, secrets.Items[j])
+			}
+		}
+	}
+	return sealedSecrets, nil
+}
+
+// decrypts the encrypted copies of the credentials restored by the velero restores of this restore
+// into the credentials secrets, then removes the encrypted copies
+func (r *RestoreReconciler) unsealCredentials(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+) error {
+	if restore.Spec.CredentialsEncryption == nil {
+		return nil
+	}
+	sealedSecrets, err := r.getRestoredSealedSecrets(ctx, veleroRestoreList)
+	if err != nil {
+		return err
+	}
+	if len(sealedSecrets) == 0 {
+		return nil
+	}
+	key, err := getEncryptionKey(ctx, r.Client, restore.Namespace, restore.Spec.CredentialsEncryption)
+	if err != nil {
+		return err
+	}
+
+	for i := range sealedSecrets {
+		sealedSecret := &sealedSecrets[i]
+		name, payload, err := unsealSecret(key, sealedSecret)
+		if err != nil {
+			return err
+		}
+		secret := &corev1.Secret{}
+		err = r.Get(ctx, types.NamespacedName{Namespace: sealedSecret.Namespace, Name: name}, secret)
+		if err != nil && !k8serr.IsNotFound(err) {
+			return err
+		}
+		secret.Labels = payload.Labels
+		secret.Annotations = payload.Annotations
+		secret.Type = payload.Type
+		secret.Data = payload.Data
+		if k8serr.IsNotFound(err) {
+			secret.Name = name
+			secret.Namespace = sealedSecret.Namespace
+			err = r.Create(ctx, secret)
+		} else {
+			err = r.Update(ctx, secret)
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.Delete(ctx, sealedSecret); err != nil && !k8serr.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_sealData(t *testing.T) {
+	key := make([]byte, 32)
+	sealed, err := sealData(key, []byte("credentials"), "ns1/secret1")
+	if err != nil {
+		t.Fatalf("sealData() error = %v", err)
+	}
+	if plaintext, err := unsealData(key, sealed, "ns1/secret1"); err != nil || string(plaintext) != "credentials" {
+		t.Errorf("unsealData() = %s, %v, want credentials", plaintext, err)
+	}
+	// the encrypted data is bound to the secret it was created for
+	if _, err := unsealData(key, sealed, "ns1/secret2"); err == nil {
+		t.Errorf("unsealData() for another secret, want error")
+	}
+	otherKey := make([]byte, 32)
+	otherKey[0] = 1
+	if _, err := unsealData(otherKey, sealed, "ns1/secret1"); err == nil {
+		t.Errorf("unsealData() with another key, want error")
+	}
+}
+
+func Test_getScheduleCredentialsType(t *testing.T) {
+	tests := map[string]SecretType{
+		veleroScheduleNames[Credentials]:                                     UserSecret,
+		veleroScheduleNames[CredentialsHive]:                                 HiveSecret,
+		veleroScheduleNames[CredentialsCluster]:                              ClusterSecret,
+		getSecondaryScheduleName(veleroScheduleNames[CredentialsHive], "dr"): HiveSecret,
+		veleroScheduleNames[Resources]:                                       "",
+	}
+	for name, want := range tests {
+		if got := getScheduleCredentialsType(name); got != want {
+			t.Errorf("getScheduleCredentialsType(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func Test_isScheduleEncryptionUpdated(t *testing.T) {
+	backupSchedule := &v1beta1.BackupSchedule{}
+	schedules := &veleroapi.ScheduleList{Items: []veleroapi.Schedule{
+		{ObjectMeta: metav1.ObjectMeta{Name: veleroScheduleNames[Resources]}},
+		{ObjectMeta: metav1.ObjectMeta{Name: veleroScheduleNames[Credentials]}},
+	}}
+	if isScheduleEncryptionUpdated(schedules, backupSchedule) {
+		t.Errorf("isScheduleEncryptionUpdated() = true, want false")
+	}
+
+	backupSchedule.Spec.CredentialsEncryption = &v1beta1.CredentialsEncryption{KeySecretName: "backup-key"}
+	if !isScheduleEncryptionUpdated(schedules, backupSchedule) {
+		t.Errorf("isScheduleEncryptionUpdated() = false, want true")
+	}
+
+	setSealedCredsBackupInfo(&schedules.Items[1].Spec.Template, UserSecret)
+	if isScheduleEncryptionUpdated(schedules, backupSchedule) {
+		t.Errorf("isScheduleEncryptionUpdated() = true, want false")
+	}
+}
+
+func Test_getSealedSecretName(t *testing.T) {
+	if got := getSealedSecretName("aws", UserSecret); got != "acm-sealed-user-aws" {
+		t.Errorf("getSealedSecretName() = %v, want acm-sealed-user-aws", got)
+	}
+	longName := strings.Repeat("a", 250)
+	got := getSealedSecretName(longName+"1", UserSecret)
+	if len(got) != maxSecretNameLength {
+		t.Errorf("getSealedSecretName() length = %d, want %d", len(got), maxSecretNameLength)
+	}
+	if got == getSealedSecretName(longName+"2", UserSecret) {
+		t.Errorf("getSealedSecretName() = %v for different secrets", got)
+	}
+}
+
+func Test_sealedCredentials(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(testScheme)
+
+	keySecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup-key", Namespace: "velero"},
+		Data:       map[string][]byte{"key": []byte("passphrase")},
+	}
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "aws",
+			Namespace: "ns1",
+			Labels:    map[string]string{backupCredsUserLabel: "aws", backupCredsClusterLabel: "aws"},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{"aws_secret_access_key": []byte("secret")},
+	}
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		keySecret,
+		credentials.DeepCopy(),
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "ns1"}},
+		// credentials and encrypted copy restored by a test restore
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      "aws",
+			Namespace: "acm-restore-test-ns1",
+			Labels:    map[string]string{backupCredsUserLabel: "aws"},
+		}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      "acm-sealed-user-aws",
+			Namespace: "acm-restore-test-ns1",
+			Labels:    map[string]string{SealedSecretTypeLabel: string(UserSecret)},
+		}},
+	).Build()
+
+	backupSchedule := &v1beta1.BackupSchedule{
+		ObjectMeta: metav1.ObjectMeta{Name: "schedule", Namespace: "velero"},
+		Spec: v1beta1.BackupScheduleSpec{
+			CredentialsEncryption: &v1beta1.CredentialsEncryption{KeySecretName: "backup-key"},
+		},
+	}
+	if err := syncSealedCredentials(context.Background(), c, backupSchedule); err != nil {
+		t.Fatalf("syncSealedCredentials() error = %v", err)
+	}
+	sealedSecrets := &corev1.SecretList{}
+	if err := c.List(
+		context.Background(),
+		sealedSecrets,
+		client.InNamespace("ns1"),
+		client.HasLabels{SealedSecretTypeLabel},
+	); err != nil {
+		t.Fatal(err)
+	}
+	sandboxCopy := &corev1.Secret{}
+	if err := c.Get(context.Background(),
+		types.NamespacedName{Namespace: "acm-restore-test-ns1", Name: "acm-sealed-user-aws"}, sandboxCopy); err != nil {
+		t.Errorf("syncSealedCredentials() removed the copy restored by the test restore: %v", err)
+	}
+	// a copy is backed up by each credentials backup saving the secret
+	if len(sealedSecrets.Items) != 2 ||
+		sealedSecrets.Items[0].Name != "acm-sealed-cluster-aws" || sealedSecrets.Items[1].Name != "acm-sealed-user-aws" {
+		t.Fatalf("syncSealedCredentials() created %v, want acm-sealed-cluster-aws and acm-sealed-user-aws",
+			sealedSecrets.Items)
+	}
+	if sealedSecrets.Items[0].Labels[SealedSecretTypeLabel] != string(ClusterSecret) {
+		t.Errorf("syncSealedCredentials() type = %v, want %v",
+			sealedSecrets.Items[0].Labels[SealedSecretTypeLabel], ClusterSecret)
+	}
+	sealedSecret := sealedSecrets.Items[1]
+	if sealedSecret.Labels[SealedSecretTypeLabel] != string(UserSecret) {
+		t.Errorf("syncSealedCredentials() type = %v, want %v", sealedSecret.Labels[SealedSecretTypeLabel], UserSecret)
+	}
+
+	// unchanged credentials are not encrypted again
+	if err := syncSealedCredentials(context.Background(), c, backupSchedule); err != nil {
+		t.Fatalf("syncSealedCredentials() error = %v", err)
+	}
+	unchanged := &corev1.Secret{}
+	_ = c.Get(context.Background(), types.NamespacedName{Namespace: "ns1", Name: "acm-sealed-user-aws"}, unchanged)
+	if unchanged.ResourceVersion != sealedSecret.ResourceVersion {
+		t.Errorf("syncSealedCredentials() updated unchanged credentials")
+	}
+
+	// restore the encrypted copy on a new hub
+	veleroRestoreName := "restore-acm-credentials-schedule-20210910181336"
+	restoredLabels := map[string]string{veleroapi.RestoreNameLabel: veleroRestoreName}
+	for key, value := range sealedSecret.Labels {
+		restoredLabels[key] = value
+	}
+	restoreClient := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		keySecret.DeepCopy(),
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        sealedSecret.Name,
+				Namespace:   sealedSecret.Namespace,
+				Labels:      restoredLabels,
+				Annotations: sealedSecret.Annotations,
+			},
+			Data: sealedSecret.Data,
+		},
+		// encrypted copy not restored by the restore
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "acm-sealed-user-gcp",
+				Namespace:   "ns1",
+				Labels:      map[string]string{SealedSecretTypeLabel: string(UserSecret)},
+				Annotations: map[string]string{sealedSecretNameAnnotation: "gcp"},
+			},
+		},
+	).Build()
+	r := &RestoreReconciler{Client: restoreClient}
+	restore := &v1beta1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "velero"},
+		Spec: v1beta1.RestoreSpec{
+			CredentialsEncryption: &v1beta1.CredentialsEncryption{KeySecretName: "backup-key"},
+		},
+	}
+	veleroRestoreList := &veleroapi.RestoreList{Items: []veleroapi.Restore{{
+		ObjectMeta: metav1.ObjectMeta{Name: veleroRestoreName},
+		Spec:       veleroapi.RestoreSpec{BackupName: "acm-credentials-schedule-20210910181336"},
+	}}}
+	if err := r.unsealCredentials(context.Background(), restore, veleroRestoreList); err != nil {
+		t.Fatalf("unsealCredentials() error = %v", err)
+	}
+	restored := &corev1.Secret{}
+	if err := restoreClient.Get(context.Background(), types.NamespacedName{Namespace: "ns1", Name: "aws"}, restored); err != nil {
+		t.Fatalf("unsealCredentials() didn't restore the credentials: %v", err)
+	}
+	if !reflect.DeepEqual(restored.Data, credentials.Data) || !reflect.DeepEqual(restored.Labels, credentials.Labels) {
+		t.Errorf("unsealCredentials() restored %v, want %v", restored, credentials)
+	}
+	if err := restoreClient.Get(
+		context.Background(),
+		types.NamespacedName{Namespace: "ns1", Name: "acm-sealed-user-gcp"},
+		&corev1.Secret{},
+	); err != nil {
+		t.Errorf("unsealCredentials() removed an encrypted copy not restored by the restore: %v", err)
+	}
+	err := restoreClient.Get(
+		context.Background(),
+		types.NamespacedName{Namespace: "ns1", Name: "acm-sealed-user-aws"},
+		&corev1.Secret{},
+	)
+	if !k8serr.IsNotFound(err) {
+		t.Errorf("unsealCredentials() didn't remove the encrypted copy: %v", err)
+	}
+
+	// the encrypted copies are removed when the encryption is disabled
+	backupSchedule.Spec.CredentialsEncryption = nil
+	if err := syncSealedCredentials(context.Background(), c, backupSchedule); err != nil {
+		t.Fatalf("syncSealedCredentials() error = %v", err)
+	}
+	err = c.Get(
+		context.Background(),
+		types.NamespacedName{Namespace: "ns1", Name: "acm-sealed-user-aws"},
+		&corev1.Secret{},
+	)
+	if !k8serr.IsNotFound(err) {
+		t.Errorf("syncSealedCredentials() didn't remove the encrypted copy: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	clusterv1 "github.com/open-cluster-management/api/cluster/v1"
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// suffix of the name of the ConfigMap listing the backed up credentials
+	credentialsInventorySuffix = "-credentials-inventory"
+	// key of the inventory ConfigMap listing the secrets which look like credentials but are not backed up
+	unlabeledSecretsKey = "unlabeled"
+	// label set by the console on the provider credentials
+	providerCredentialsLabel = "cluster.open-cluster-management.io/credentials"
+	// maximum number of unlabeled secrets listed in the BackupSchedule status, all are listed in the ConfigMap
+	maxUnlabeledSecretsPreview = 100
+)
+
+// credentialsScheduleKeys are the velero schedules saving credentials, with the label they select secrets on
+var credentialsScheduleKeys = map[ResourceType]string{
+	Credentials:        backupCredsUserLabel,
+	CredentialsHive:    backupCredsHiveLabel,
+	CredentialsCluster: backupCredsClusterLabel,
+}
+
+// credentialsDataKeys are the secret data keys of cloud provider credentials, pull secrets and ssh keys
+var credentialsDataKeys = []string{
+	"aws_access_key_id",
+	"aws_secret_access_key",
+	"osServiceAccount.json",
+	"osServicePrincipal.json",
+	"clouds.yaml",
+	"pullSecret",
+	"ssh-privatekey",
+	corev1.DockerConfigJsonKey,
+}
+
+// returns true if the secret looks like ACM credentials: a provider credential created by the console,
+// or a secret from a managed cluster namespace holding cloud provider credentials, a pull secret or an ssh key
+func isCredentialsLike(secret *corev1.Secret, clusterNamespaces map[string]bool) bool {
+	if _, ok := secret.Labels[providerCredentialsLabel]; ok {
+		return true
+	}
+	if !clusterNamespaces[secret.Namespace] {
+		return false
+	}
+	for _, key := range credentialsDataKeys {
+		if _, ok := secret.Data[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the secrets matched by each credentials schedule and the secrets which look like credentials
+// but are not matched by any of them, as sorted namespace/name lists
+func getCredentialsInventory(
+	secrets []corev1.Secret,
+	clusterNamespaces map[string]bool,
+) (map[ResourceType][]string, []string) {
+	matched := make(map[ResourceType][]string, len(credentialsScheduleKeys))
+	unlabeled := []string{}
+	for i := range secrets {
+		secret := &secrets[i]
+		if _, ok := secret.Labels[SealedSecretTypeLabel]; ok {
+			// encrypted copies are saved in place of the credentials
+			continue
+		}
+		if isRestoreTestNamespace(secret.Namespace) {
+			continue
+		}
+		name := secret.Namespace + "/" + secret.Name
+		backedUp := false
+		for key, label := range credentialsScheduleKeys {
+			if _, ok := secret.Labels[label]; ok {
+				matched[key] = append(matched[key], name)
+				backedUp = true
+			}
+		}
+		if !backedUp && isCredentialsLike(secret, clusterNamespaces) {
+			unlabeled = append(unlabeled, name)
+		}
+	}
+	for key := range matched {
+		sort.Strings(matched[key])
+	}
+	sort.Strings(unlabeled)
+	return matched, unlabeled
+}
+
+// lists the secrets matched by the credentials schedules in the inventory ConfigMap and reports them
+// in the BackupSchedule status; the inventory is created by the first reconcile, then updated
+// each time a new set of backups completes
+func (r *BackupScheduleReconciler) updateCredentialsInventory(
+	ctx context.Context,
+	backupSchedule *v1beta1.BackupSchedule,
+) error {
+	timestamp, err := r.getLatestBackupSetTimestamp(ctx, backupSchedule)
+	if err != nil {
+		return err
+	}
+	if backupSchedule.Status.CredentialsInventory != nil &&
+		backupSchedule.Status.CredentialsInventory.BackupTimestamp == timestamp {
+		// no new completed backups
+		return nil
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets); err != nil {
+		return err
+	}
+	clusterNamespaces := map[string]bool{}
+	managedClusters := &clusterv1.ManagedClusterList{}
+	if err := r.List(ctx, managedClusters); err != nil {
+		return err
+	}
+	for i := range managedClusters.Items {
+		if managedClusters.Items[i].Name != "local-cluster" {
+			clusterNamespaces[managedClusters.Items[i].Name] = true
+		}
+	}
+
+	matched, unlabeled := getCredentialsInventory(secrets.Items, clusterNamespaces)
+	data := map[string]string{}
+	schedules := []v1beta1.CredentialsInventoryCount{}
+	scheduleKeys := make([]ResourceType, 0, len(credentialsScheduleKeys))
+	for key := range credentialsScheduleKeys {
+		scheduleKeys = append(scheduleKeys, key)
+	}
+	sort.Sort(SortResourceType(scheduleKeys))
+	for _, key := range scheduleKeys {
+		data[veleroScheduleNames[key]] = strings.Join(matched[key], "\n")
+		schedules = append(schedules, v1beta1.CredentialsInventoryCount{
+			Schedule: veleroScheduleNames[key],
+			Secrets:  len(matched[key]),
+		})
+	}
+	data[unlabeledSecretsKey] = strings.Join(unlabeled, "\n")
+
+	configMap := &corev1.ConfigMap{}
+	configMapIdentity := types.NamespacedName{
+		Namespace: backupSchedule.Namespace,
+		Name:      backupSchedule.Name + credentialsInventorySuffix,
+	}
+	err = r.Get(ctx, configMapIdentity, configMap)
+	if err != nil && !k8serr.IsNotFound(err) {
+		return err
+	}
+	changed := !reflect.DeepEqual(configMap.Data, data)
+	if k8serr.IsNotFound(err) {
+		configMap.Name = configMapIdentity.Name
+		configMap.Namespace = configMapIdentity.Namespace
+		configMap.Data = data
+		if err := ctrl.SetControllerReference(backupSchedule, configMap, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, configMap); err != nil {
+			return err
+		}
+	} else if changed {
+		configMap.Data = data
+		if err := r.Update(ctx, configMap); err != nil {
+			return err
+		}
+	}
+
+	inventory := &v1beta1.CredentialsInventory{
+		ConfigMapName:         configMap.Name,
+		BackupTimestamp:       timestamp,
+		Schedules:             schedules,
+		UnlabeledSecretsCount: len(unlabeled),
+	}
+	for _, name := range unlabeled {
+		if len(inventory.UnlabeledSecrets) == maxUnlabeledSecretsPreview {
+			inventory.UnlabeledSecrets = append(
+				inventory.UnlabeledSecrets,
+				fmt.Sprintf("... and %d more", len(unlabeled)-maxUnlabeledSecretsPreview),
+			)
+			break
+		}
+		inventory.UnlabeledSecrets = append(inventory.UnlabeledSecrets, name)
+	}
+	if backupSchedule.Status.CredentialsInventory != nil && !changed {
+		inventory.UpdateTime = backupSchedule.Status.CredentialsInventory.UpdateTime
+	} else {
+		now := metav1.Now()
+		inventory.UpdateTime = &now
+	}
+	backupSchedule.Status.CredentialsInventory = inventory
+	return nil
+}
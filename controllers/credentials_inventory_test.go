@@ -0,0 +1,201 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	clusterv1 "github.com/open-cluster-management/api/cluster/v1"
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newInventorySecret(namespace, name string, labels map[string]string, dataKeys ...string) corev1.Secret {
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Data:       map[string][]byte{},
+	}
+	for _, key := range dataKeys {
+		secret.Data[key] = []byte("value")
+	}
+	return secret
+}
+
+func Test_getCredentialsInventory(t *testing.T) {
+	secrets := []corev1.Secret{
+		newInventorySecret("ns1", "aws", map[string]string{backupCredsUserLabel: "aws"}),
+		newInventorySecret("ns1", "gcp", map[string]string{providerCredentialsLabel: "", backupCredsUserLabel: "gcp"}),
+		newInventorySecret("ns1", "azure", map[string]string{providerCredentialsLabel: ""}),
+		newInventorySecret("cluster1", "cluster1-install-config", map[string]string{backupCredsHiveLabel: "install-config"}),
+		newInventorySecret("cluster1", "cluster1-aws-creds", nil, "aws_access_key_id", "aws_secret_access_key"),
+		newInventorySecret("cluster1", "cluster1-pull-secret", nil, corev1.DockerConfigJsonKey),
+		newInventorySecret("cluster1", "default-token", nil, "token"),
+		newInventorySecret("ns2", "app-pull-secret", nil, corev1.DockerConfigJsonKey),
+		newInventorySecret("ns2", "app-config", map[string]string{backupCredsClusterLabel: ""}),
+		newInventorySecret("ns1", "acm-sealed-aws", map[string]string{SealedSecretTypeLabel: string(UserSecret)}),
+		// copies restored by the test restores
+		newInventorySecret("acm-restore-test-ns1", "aws", map[string]string{backupCredsUserLabel: "aws"}),
+		newInventorySecret("acm-restore-test-ns1", "azure", map[string]string{providerCredentialsLabel: ""}),
+	}
+
+	matched, unlabeled := getCredentialsInventory(secrets, map[string]bool{"cluster1": true})
+
+	wantMatched := map[ResourceType][]string{
+		Credentials:        {"ns1/aws", "ns1/gcp"},
+		CredentialsHive:    {"cluster1/cluster1-install-config"},
+		CredentialsCluster: {"ns2/app-config"},
+	}
+	if !reflect.DeepEqual(matched, wantMatched) {
+		t.Errorf("getCredentialsInventory() matched = %v, want %v", matched, wantMatched)
+	}
+	wantUnlabeled := []string{"cluster1/cluster1-aws-creds", "cluster1/cluster1-pull-secret", "ns1/azure"}
+	if !reflect.DeepEqual(unlabeled, wantUnlabeled) {
+		t.Errorf("getCredentialsInventory() unlabeled = %v, want %v", unlabeled, wantUnlabeled)
+	}
+}
+
+func Test_updateCredentialsInventory(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(testScheme)
+	_ = clusterv1.AddToScheme(testScheme)
+	_ = v1beta1.AddToScheme(testScheme)
+	_ = veleroapi.AddToScheme(testScheme)
+
+	aws := newInventorySecret("ns1", "aws", map[string]string{backupCredsUserLabel: "aws"})
+	unlabeled := newInventorySecret("cluster1", "cluster1-pull-secret", nil, corev1.DockerConfigJsonKey)
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		&aws,
+		&unlabeled,
+		&clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster1"}},
+	).Build()
+	r := &BackupScheduleReconciler{Client: c, Scheme: testScheme}
+
+	backupSchedule := &v1beta1.BackupSchedule{
+		ObjectMeta: metav1.ObjectMeta{Name: "schedule", Namespace: "velero"},
+	}
+	if err := r.updateCredentialsInventory(context.Background(), backupSchedule); err != nil {
+		t.Fatalf("updateCredentialsInventory() error = %v", err)
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := c.Get(
+		context.Background(),
+		types.NamespacedName{Namespace: "velero", Name: "schedule-credentials-inventory"},
+		configMap,
+	); err != nil {
+		t.Fatalf("updateCredentialsInventory() didn't create the ConfigMap: %v", err)
+	}
+	wantData := map[string]string{
+		veleroScheduleNames[Credentials]:        "ns1/aws",
+		veleroScheduleNames[CredentialsHive]:    "",
+		veleroScheduleNames[CredentialsCluster]: "",
+		unlabeledSecretsKey:                     "cluster1/cluster1-pull-secret",
+	}
+	if !reflect.DeepEqual(configMap.Data, wantData) {
+		t.Errorf("updateCredentialsInventory() data = %v, want %v", configMap.Data, wantData)
+	}
+
+	inventory := backupSchedule.Status.CredentialsInventory
+	if inventory == nil || inventory.UpdateTime == nil {
+		t.Fatalf("updateCredentialsInventory() status = %v", inventory)
+	}
+	wantSchedules := []v1beta1.CredentialsInventoryCount{
+		{Schedule: veleroScheduleNames[Credentials], Secrets: 1},
+		{Schedule: veleroScheduleNames[CredentialsCluster], Secrets: 0},
+		{Schedule: veleroScheduleNames[CredentialsHive], Secrets: 0},
+	}
+	if !reflect.DeepEqual(inventory.Schedules, wantSchedules) {
+		t.Errorf("updateCredentialsInventory() schedules = %v, want %v", inventory.Schedules, wantSchedules)
+	}
+	if !reflect.DeepEqual(inventory.UnlabeledSecrets, []string{"cluster1/cluster1-pull-secret"}) ||
+		inventory.UnlabeledSecretsCount != 1 {
+		t.Errorf("updateCredentialsInventory() unlabeled = %v, count = %d",
+			inventory.UnlabeledSecrets, inventory.UnlabeledSecretsCount)
+	}
+
+	// the secrets are listed again once a new set of backups completes
+	for i := 0; i < maxUnlabeledSecretsPreview; i++ {
+		name := fmt.Sprintf("provider-%03d", i)
+		secret := newInventorySecret("ns1", name, map[string]string{providerCredentialsLabel: ""})
+		if err := c.Create(context.Background(), &secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.updateCredentialsInventory(context.Background(), backupSchedule); err != nil {
+		t.Fatalf("updateCredentialsInventory() error = %v", err)
+	}
+	if backupSchedule.Status.CredentialsInventory != inventory {
+		t.Errorf("updateCredentialsInventory() listed the secrets again without new backups")
+	}
+	for _, scheduleName := range veleroScheduleNames {
+		backup := newScheduledBackup(scheduleName, "20211019100000", veleroapi.BackupPhaseCompleted)
+		if err := c.Create(context.Background(), &backup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.updateCredentialsInventory(context.Background(), backupSchedule); err != nil {
+		t.Fatalf("updateCredentialsInventory() error = %v", err)
+	}
+	inventory = backupSchedule.Status.CredentialsInventory
+	if inventory.BackupTimestamp != "20211019100000" {
+		t.Errorf("updateCredentialsInventory() backup timestamp = %v", inventory.BackupTimestamp)
+	}
+	// the status lists a preview of the unlabeled secrets, the ConfigMap lists all of them
+	if inventory.UnlabeledSecretsCount != maxUnlabeledSecretsPreview+1 ||
+		len(inventory.UnlabeledSecrets) != maxUnlabeledSecretsPreview+1 ||
+		inventory.UnlabeledSecrets[maxUnlabeledSecretsPreview] != "... and 1 more" {
+		t.Errorf("updateCredentialsInventory() unlabeled = %v, count = %d",
+			inventory.UnlabeledSecrets, inventory.UnlabeledSecretsCount)
+	}
+	if err := c.Get(
+		context.Background(),
+		types.NamespacedName{Namespace: "velero", Name: "schedule-credentials-inventory"},
+		configMap,
+	); err != nil {
+		t.Fatal(err)
+	}
+	unlabeledNames := strings.Split(configMap.Data[unlabeledSecretsKey], "\n")
+	if len(unlabeledNames) != maxUnlabeledSecretsPreview+1 {
+		t.Errorf("updateCredentialsInventory() ConfigMap lists %d unlabeled secrets", len(unlabeledNames))
+	}
+
+	// the update time changes only with the list of secrets
+	updateTime := metav1.NewTime(inventory.UpdateTime.Add(-time.Hour))
+	inventory.UpdateTime = &updateTime
+	for _, scheduleName := range veleroScheduleNames {
+		backup := newScheduledBackup(scheduleName, "20211019110000", veleroapi.BackupPhaseCompleted)
+		if err := c.Create(context.Background(), &backup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.updateCredentialsInventory(context.Background(), backupSchedule); err != nil {
+		t.Fatalf("updateCredentialsInventory() error = %v", err)
+	}
+	if !backupSchedule.Status.CredentialsInventory.UpdateTime.Equal(&updateTime) {
+		t.Errorf("updateCredentialsInventory() update time changed without changes")
+	}
+}
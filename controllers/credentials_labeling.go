@@ -0,0 +1,319 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	chnv1 "github.com/open-cluster-management/multicloud-operators-channel/pkg/apis/apps/v1"
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// CredentialsLabelingMode defines if the secrets referenced by ACM resources are labeled for backup
+type CredentialsLabelingMode string
+
+const (
+	// CredentialsLabelingDisabled doesn't run the credentials labeling controller
+	CredentialsLabelingDisabled CredentialsLabelingMode = "disabled"
+	// CredentialsLabelingDryRun reports the secrets which would be labeled, without labeling them
+	CredentialsLabelingDryRun CredentialsLabelingMode = "dry-run"
+	// CredentialsLabelingEnabled adds the backup label to the referenced secrets
+	CredentialsLabelingEnabled CredentialsLabelingMode = "enabled"
+
+	// name of the ConfigMap listing the secrets which would be labeled, in dry-run mode
+	credentialsLabelingReportName = "credentials-labeling-dry-run"
+)
+
+// credentialsReferrer is an ACM resource kind referencing secrets which must be backed up
+type credentialsReferrer struct {
+	// kind of the resource, set lowercase as value of the backup label
+	kind string
+	// group version of the resource
+	groupVersion string
+	// plural name of the resource, used to find if the resource is installed
+	resource string
+	// backup label set on the referenced secrets
+	label string
+	// returns an empty resource
+	newObject func() client.Object
+	// returns the names of the secrets referenced by the resource
+	getSecretRefs func(client.Object) []types.NamespacedName
+}
+
+// credentialsReferrers are the resources whose referenced secrets are labeled for backup;
+// the secrets referenced by clusters are backed up with the managed clusters credentials
+var credentialsReferrers = []credentialsReferrer{
+	{
+		kind:          "Channel",
+		groupVersion:  chnv1.SchemeGroupVersion.String(),
+		resource:      "channels",
+		label:         backupCredsUserLabel,
+		newObject:     func() client.Object { return &chnv1.Channel{} },
+		getSecretRefs: getChannelSecretRefs,
+	},
+	{
+		kind:          "ClusterDeployment",
+		groupVersion:  hivev1.SchemeGroupVersion.String(),
+		resource:      "clusterdeployments",
+		label:         backupCredsClusterLabel,
+		newObject:     func() client.Object { return &hivev1.ClusterDeployment{} },
+		getSecretRefs: getClusterDeploymentSecretRefs,
+	},
+	{
+		kind:          "ClusterPool",
+		groupVersion:  hivev1.SchemeGroupVersion.String(),
+		resource:      "clusterpools",
+		label:         backupCredsClusterLabel,
+		newObject:     func() client.Object { return &hivev1.ClusterPool{} },
+		getSecretRefs: getClusterPoolSecretRefs,
+	},
+}
+
+// returns the secret referenced by the channel, defaulting to the channel namespace
+func getChannelSecretRefs(obj client.Object) []types.NamespacedName {
+	channel := obj.(*chnv1.Channel)
+	if channel.Spec.SecretRef == nil || channel.Spec.SecretRef.Name == "" {
+		return nil
+	}
+	namespace := channel.Spec.SecretRef.Namespace
+	if namespace == "" {
+		namespace = channel.Namespace
+	}
+	return []types.NamespacedName{{Namespace: namespace, Name: channel.Spec.SecretRef.Name}}
+}
+
+// returns the secrets referenced by the cluster deployment, from its namespace
+func getClusterDeploymentSecretRefs(obj client.Object) []types.NamespacedName {
+	clusterDeployment := obj.(*hivev1.ClusterDeployment)
+	refs := []*corev1.LocalObjectReference{
+		clusterDeployment.Spec.PullSecretRef,
+		getPlatformCredentialsRef(&clusterDeployment.Spec.Platform),
+	}
+	if clusterDeployment.Spec.Provisioning != nil {
+		refs = append(refs,
+			clusterDeployment.Spec.Provisioning.InstallConfigSecretRef,
+			clusterDeployment.Spec.Provisioning.SSHPrivateKeySecretRef,
+		)
+	}
+	return getLocalSecretRefs(clusterDeployment.Namespace, refs)
+}
+
+// returns the secrets referenced by the cluster pool, from its namespace
+func getClusterPoolSecretRefs(obj client.Object) []types.NamespacedName {
+	clusterPool := obj.(*hivev1.ClusterPool)
+	return getLocalSecretRefs(clusterPool.Namespace, []*corev1.LocalObjectReference{
+		clusterPool.Spec.PullSecretRef,
+		getPlatformCredentialsRef(&clusterPool.Spec.Platform),
+		clusterPool.Spec.InstallConfigSecretTemplateRef,
+	})
+}
+
+// returns the cloud provider credentials of the hive platform
+func getPlatformCredentialsRef(platform *hivev1.Platform) *corev1.LocalObjectReference {
+	switch {
+	case platform.AWS != nil:
+		return &platform.AWS.CredentialsSecretRef
+	case platform.Azure != nil:
+		return &platform.Azure.CredentialsSecretRef
+	case platform.GCP != nil:
+		return &platform.GCP.CredentialsSecretRef
+	case platform.OpenStack != nil:
+		return &platform.OpenStack.CredentialsSecretRef
+	case platform.Ovirt != nil:
+		return &platform.Ovirt.CredentialsSecretRef
+	case platform.VSphere != nil:
+		return &platform.VSphere.CredentialsSecretRef
+	}
+	return nil
+}
+
+// returns the names of the set references, in the namespace
+func getLocalSecretRefs(namespace string, refs []*corev1.LocalObjectReference) []types.NamespacedName {
+	names := []types.NamespacedName{}
+	for _, ref := range refs {
+		if ref != nil && ref.Name != "" {
+			names = append(names, types.NamespacedName{Namespace: namespace, Name: ref.Name})
+		}
+	}
+	return names
+}
+
+// CredentialsLabelingReconciler adds the backup label to the secrets referenced by ACM resources,
+// so they are saved by the credentials backups
+type CredentialsLabelingReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	// DryRun reports the secrets which would be labeled, without labeling them
+	DryRun bool
+	// ReportNamespace is the namespace of the ConfigMap listing the secrets which would be labeled in dry-run mode
+	ReportNamespace string
+}
+
+// returns the key of the dry-run report ConfigMap listing the secrets referenced by the resource
+func getLabelingReportKey(referrer credentialsReferrer, name types.NamespacedName) string {
+	return strings.ToLower(referrer.kind) + "." + name.Namespace + "." + name.Name
+}
+
+// lists the secrets which would be labeled for a referencing resource in the dry-run report ConfigMap,
+// removing its key once there are none
+func (r *CredentialsLabelingReconciler) updateLabelingReport(
+	ctx context.Context,
+	key string,
+	secrets []string,
+) error {
+	report := &corev1.ConfigMap{}
+	err := r.Get(
+		ctx,
+		types.NamespacedName{Namespace: r.ReportNamespace, Name: credentialsLabelingReportName},
+		report,
+	)
+	if k8serr.IsNotFound(err) {
+		if len(secrets) == 0 {
+			return nil
+		}
+		report = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: credentialsLabelingReportName, Namespace: r.ReportNamespace},
+			Data:       map[string]string{key: strings.Join(secrets, "\n")},
+		}
+		return r.Create(ctx, report)
+	}
+	if err != nil {
+		return err
+	}
+
+	value, found := report.Data[key]
+	if (len(secrets) == 0 && !found) || (found && value == strings.Join(secrets, "\n")) {
+		return nil
+	}
+	// the controllers of all the referencing kinds update the report, patch only the key of the resource
+	updated := report.DeepCopy()
+	if len(secrets) == 0 {
+		delete(updated.Data, key)
+	} else {
+		if updated.Data == nil {
+			updated.Data = map[string]string{}
+		}
+		updated.Data[key] = strings.Join(secrets, "\n")
+	}
+	return r.Patch(ctx, updated, client.MergeFrom(report))
+}
+
+//+kubebuilder:rbac:groups=apps.open-cluster-management.io,resources=channels,verbs=get;list;watch
+//+kubebuilder:rbac:groups=hive.openshift.io,resources=clusterdeployments,verbs=get;list;watch
+//+kubebuilder:rbac:groups=hive.openshift.io,resources=clusterpools,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;update
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;patch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// reconcile labels the secrets referenced by a resource of the referrer kind
+func (r *CredentialsLabelingReconciler) reconcile(
+	ctx context.Context,
+	referrer credentialsReferrer,
+	req ctrl.Request,
+) (ctrl.Result, error) {
+	labelingLogger := log.FromContext(ctx)
+
+	if isRestoreTestNamespace(req.Namespace) {
+		// copies restored by the test restores are not backed up
+		return ctrl.Result{}, nil
+	}
+	reportKey := getLabelingReportKey(referrer, req.NamespacedName)
+	obj := referrer.newObject()
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		if k8serr.IsNotFound(err) && r.DryRun {
+			return ctrl.Result{}, r.updateLabelingReport(ctx, reportKey, nil)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	toLabel := []string{}
+	for _, secretRef := range referrer.getSecretRefs(obj) {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, secretRef, secret); err != nil {
+			if k8serr.IsNotFound(err) {
+				continue
+			}
+			return ctrl.Result{}, err
+		}
+		if getCredentialsType(secret.Labels) != "" {
+			// already backed up
+			continue
+		}
+
+		msg := fmt.Sprintf("%s/%s, with %s", secret.Namespace, secret.Name, referrer.label)
+		if r.DryRun {
+			labelingLogger.Info("Secret not backed up, would add the backup label", "secret", msg)
+			r.Recorder.Event(obj, corev1.EventTypeNormal, "Backup label needed:", msg)
+			toLabel = append(toLabel, msg)
+			continue
+		}
+
+		if secret.Labels == nil {
+			secret.Labels = map[string]string{}
+		}
+		secret.Labels[referrer.label] = strings.ToLower(referrer.kind)
+		if err := r.Update(ctx, secret); err != nil {
+			return ctrl.Result{}, err
+		}
+		labelingLogger.Info("Backup label added to secret", "secret", msg)
+		r.Recorder.Event(obj, corev1.EventTypeNormal, "Backup label added:", msg)
+	}
+	if r.DryRun {
+		return ctrl.Result{}, r.updateLabelingReport(ctx, reportKey, toLabel)
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up a controller for each resource kind referencing secrets, when the kind is installed
+func (r *CredentialsLabelingReconciler) SetupWithManager(mgr ctrl.Manager, dc discovery.DiscoveryInterface) error {
+	for i := range credentialsReferrers {
+		referrer := credentialsReferrers[i]
+		if missing, err := findMissingResources(
+			dc,
+			referrer.groupVersion,
+			[]string{referrer.resource},
+		); err != nil || len(missing) > 0 {
+			mgr.GetLogger().Info(
+				"Resource not installed, the secrets it references are not labeled",
+				"resource", referrer.resource,
+			)
+			continue
+		}
+
+		if err := ctrl.NewControllerManagedBy(mgr).
+			Named("credentials-labeling-" + referrer.resource).
+			For(referrer.newObject()).
+			Complete(reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+				return r.reconcile(ctx, referrer, req)
+			})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
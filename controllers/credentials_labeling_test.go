@@ -0,0 +1,145 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	chnv1 "github.com/open-cluster-management/multicloud-operators-channel/pkg/apis/apps/v1"
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	hiveaws "github.com/openshift/hive/apis/hive/v1/aws"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_getClusterDeploymentSecretRefs(t *testing.T) {
+	clusterDeployment := &hivev1.ClusterDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster1", Namespace: "cluster1"},
+		Spec: hivev1.ClusterDeploymentSpec{
+			PullSecretRef: &corev1.LocalObjectReference{Name: "cluster1-pull-secret"},
+			Platform: hivev1.Platform{AWS: &hiveaws.Platform{
+				CredentialsSecretRef: corev1.LocalObjectReference{Name: "cluster1-aws-creds"},
+			}},
+			Provisioning: &hivev1.Provisioning{
+				InstallConfigSecretRef: &corev1.LocalObjectReference{Name: "cluster1-install-config"},
+			},
+		},
+	}
+	want := []types.NamespacedName{
+		{Namespace: "cluster1", Name: "cluster1-pull-secret"},
+		{Namespace: "cluster1", Name: "cluster1-aws-creds"},
+		{Namespace: "cluster1", Name: "cluster1-install-config"},
+	}
+	if got := getClusterDeploymentSecretRefs(clusterDeployment); !reflect.DeepEqual(got, want) {
+		t.Errorf("getClusterDeploymentSecretRefs() = %v, want %v", got, want)
+	}
+}
+
+func Test_CredentialsLabelingReconciler_reconcile(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(testScheme)
+	_ = chnv1.AddToScheme(testScheme)
+
+	channel := &chnv1.Channel{
+		ObjectMeta: metav1.ObjectMeta{Name: "charts", Namespace: "ns1"},
+		Spec: chnv1.ChannelSpec{
+			SecretRef: &corev1.ObjectReference{Name: "charts-auth"},
+		},
+	}
+	newSecret := func() *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "charts-auth", Namespace: "ns1"}}
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "charts"}}
+
+	tests := []struct {
+		name       string
+		dryRun     bool
+		wantLabels map[string]string
+		wantEvent  bool
+		wantReport map[string]string
+	}{
+		{
+			name:       "dry run",
+			dryRun:     true,
+			wantEvent:  true,
+			wantReport: map[string]string{"channel.ns1.charts": "ns1/charts-auth, with " + backupCredsUserLabel},
+		},
+		{
+			name:       "enabled",
+			wantLabels: map[string]string{backupCredsUserLabel: "channel"},
+			wantEvent:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(channel.DeepCopy(), newSecret()).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := &CredentialsLabelingReconciler{
+				Client:          c,
+				Recorder:        recorder,
+				DryRun:          tt.dryRun,
+				ReportNamespace: "backup-ns",
+			}
+
+			if _, err := r.reconcile(context.Background(), credentialsReferrers[0], req); err != nil {
+				t.Fatalf("reconcile() error = %v", err)
+			}
+			secret := &corev1.Secret{}
+			_ = c.Get(context.Background(), types.NamespacedName{Namespace: "ns1", Name: "charts-auth"}, secret)
+			if !reflect.DeepEqual(secret.Labels, tt.wantLabels) {
+				t.Errorf("reconcile() labels = %v, want %v", secret.Labels, tt.wantLabels)
+			}
+			if got := len(recorder.Events) > 0; got != tt.wantEvent {
+				t.Errorf("reconcile() event = %v, want %v", got, tt.wantEvent)
+			}
+			reportKey := types.NamespacedName{Namespace: "backup-ns", Name: credentialsLabelingReportName}
+			report := &corev1.ConfigMap{}
+			_ = c.Get(context.Background(), reportKey, report)
+			if !reflect.DeepEqual(report.Data, tt.wantReport) {
+				t.Errorf("reconcile() report = %v, want %v", report.Data, tt.wantReport)
+			}
+
+			// a labeled secret is left untouched
+			recorder = record.NewFakeRecorder(10)
+			r.Recorder = recorder
+			if _, err := r.reconcile(context.Background(), credentialsReferrers[0], req); err != nil {
+				t.Fatalf("reconcile() error = %v", err)
+			}
+			if !tt.dryRun && len(recorder.Events) > 0 {
+				t.Errorf("reconcile() reported an already labeled secret")
+			}
+
+			// the report entry is removed with the referencing resource
+			_ = c.Delete(context.Background(), channel.DeepCopy())
+			if _, err := r.reconcile(context.Background(), credentialsReferrers[0], req); err != nil {
+				t.Fatalf("reconcile() error = %v", err)
+			}
+			report = &corev1.ConfigMap{}
+			_ = c.Get(context.Background(), reportKey, report)
+			if len(report.Data) > 0 {
+				t.Errorf("reconcile() report = %v, want no entries", report.Data)
+			}
+		})
+	}
+}
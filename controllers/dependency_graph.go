@@ -0,0 +1,357 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	chnv1 "github.com/open-cluster-management/multicloud-operators-channel/pkg/apis/apps/v1"
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// the referenced resource doesn't exist on the hub
+	danglingReasonNotFound = "NotFound"
+	// the referenced resource is not saved by any backup
+	danglingReasonNotBackedUp = "NotBackedUp"
+)
+
+var (
+	secretGVK    = corev1.SchemeGroupVersion.WithKind("Secret")
+	configMapGVK = corev1.SchemeGroupVersion.WithKind("ConfigMap")
+	channelGVK   = chnv1.SchemeGroupVersion.WithKind("Channel")
+)
+
+// objectRef identifies a resource in the reference graph
+type objectRef struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+	name      string
+}
+
+// String returns the resource as kind.group namespace/name
+func (o objectRef) String() string {
+	kind := o.gvk.Kind
+	if o.gvk.Group != "" {
+		kind += "." + o.gvk.Group
+	}
+	if o.namespace == "" {
+		return kind + " " + o.name
+	}
+	return kind + " " + o.namespace + "/" + o.name
+}
+
+// referenceRule returns the resources referenced by a resource kind
+type referenceRule struct {
+	gvk     schema.GroupVersionKind
+	getRefs func(*unstructured.Unstructured) []objectRef
+}
+
+// referenceRules are the references analyzed between the backed up resources
+var referenceRules = []referenceRule{
+	{
+		gvk:     schema.GroupVersionKind{Group: "apps.open-cluster-management.io", Version: "v1", Kind: "Subscription"},
+		getRefs: getSubscriptionRefs,
+	},
+	{
+		gvk: channelGVK,
+		getRefs: func(obj *unstructured.Unstructured) []objectRef {
+			channel := &chnv1.Channel{}
+			if runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, channel) != nil {
+				return nil
+			}
+			return append(
+				toObjectRefs(secretGVK, getChannelSecretRefs(channel)),
+				toObjectRefs(configMapGVK, getChannelConfigMapRefs(obj))...,
+			)
+		},
+	},
+	{
+		gvk: hivev1.SchemeGroupVersion.WithKind("ClusterDeployment"),
+		getRefs: func(obj *unstructured.Unstructured) []objectRef {
+			clusterDeployment := &hivev1.ClusterDeployment{}
+			if runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, clusterDeployment) != nil {
+				return nil
+			}
+			return append(
+				toObjectRefs(secretGVK, getClusterDeploymentSecretRefs(clusterDeployment)),
+				toObjectRefs(configMapGVK, getClusterDeploymentConfigMapRefs(obj))...,
+			)
+		},
+	},
+	{
+		gvk: hivev1.SchemeGroupVersion.WithKind("ClusterPool"),
+		getRefs: func(obj *unstructured.Unstructured) []objectRef {
+			clusterPool := &hivev1.ClusterPool{}
+			if runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, clusterPool) != nil {
+				return nil
+			}
+			return toObjectRefs(secretGVK, getClusterPoolSecretRefs(clusterPool))
+		},
+	},
+	{
+		gvk: policyGVK,
+		getRefs: func(obj *unstructured.Unstructured) []objectRef {
+			return toObjectRefs(configMapGVK, getPolicyConfigMapRefs(obj))
+		},
+	},
+	{
+		gvk:     schema.GroupVersionKind{Group: "policy.open-cluster-management.io", Version: "v1", Kind: "PlacementBinding"},
+		getRefs: getPlacementBindingRefs,
+	},
+}
+
+// returns the references of the kind
+func toObjectRefs(gvk schema.GroupVersionKind, names []types.NamespacedName) []objectRef {
+	refs := make([]objectRef, 0, len(names))
+	for _, name := range names {
+		refs = append(refs, objectRef{gvk: gvk, namespace: name.Namespace, name: name.Name})
+	}
+	return refs
+}
+
+// returns the channels of the subscription, set as namespace/name
+func getSubscriptionRefs(obj *unstructured.Unstructured) []objectRef {
+	refs := []objectRef{}
+	for _, field := range []string{"channel", "secondaryChannel"} {
+		channel, _, _ := unstructured.NestedString(obj.Object, "spec", field)
+		if parts := strings.SplitN(channel, "/", 2); len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+			refs = append(refs, objectRef{gvk: channelGVK, namespace: parts[0], name: parts[1]})
+		}
+	}
+	return refs
+}
+
+// returns the placement and the subjects bound by the placement binding, from its namespace
+func getPlacementBindingRefs(obj *unstructured.Unstructured) []objectRef {
+	refs := []objectRef{}
+	addRef := func(ref map[string]interface{}) {
+		group, _, _ := unstructured.NestedString(ref, "apiGroup")
+		kind, _, _ := unstructured.NestedString(ref, "kind")
+		name, _, _ := unstructured.NestedString(ref, "name")
+		if kind == "" || name == "" {
+			return
+		}
+		// the version is ignored when looking for the referenced resource
+		refs = append(refs, objectRef{
+			gvk:       schema.GroupVersionKind{Group: group, Kind: kind},
+			namespace: obj.GetNamespace(),
+			name:      name,
+		})
+	}
+	if placementRef, found, _ := unstructured.NestedMap(obj.Object, "placementRef"); found {
+		addRef(placementRef)
+	}
+	subjects, _, _ := unstructured.NestedSlice(obj.Object, "subjects")
+	for _, subject := range subjects {
+		if ref, ok := subject.(map[string]interface{}); ok {
+			addRef(ref)
+		}
+	}
+	return refs
+}
+
+// returns true if the velero backup template selects the resource
+func isSelectedByBackup(template *veleroapi.BackupSpec, gvk schema.GroupVersionKind, obj metav1.Object) bool {
+	if !isNamespaceBackedUp(&veleroapi.Backup{Spec: *template}, obj.GetNamespace()) {
+		return false
+	}
+	kind := strings.ToLower(gvk.Kind)
+	kindGroup := kind + "." + gvk.Group
+	matches := func(resources []string) bool {
+		return findValue(resources, "*") || findValue(resources, kind) || findValue(resources, kindGroup)
+	}
+	if len(template.IncludedResources) > 0 && !matches(template.IncludedResources) {
+		return false
+	}
+	if matches(template.ExcludedResources) {
+		return false
+	}
+	if template.LabelSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(template.LabelSelector)
+		if err != nil || !selector.Matches(labels.Set(obj.GetLabels())) {
+			return false
+		}
+	}
+	return true
+}
+
+// returns true if the resource is saved by one of the velero schedules
+func isBackedUp(schedules []veleroapi.Schedule, gvk schema.GroupVersionKind, obj metav1.Object) bool {
+	if gvk.GroupKind() == secretGVK.GroupKind() && getCredentialsType(obj.GetLabels()) != "" {
+		// the credentials may be saved as encrypted copies
+		return true
+	}
+	for i := range schedules {
+		if isSelectedByBackup(&schedules[i].Spec.Template, gvk, obj) {
+			return true
+		}
+	}
+	return false
+}
+
+// walks the resources saved by the velero schedules and returns the references
+// to resources which are missing on the hub or not backed up
+func analyzeDependencies(
+	ctx context.Context,
+	c client.Client,
+	schedules []veleroapi.Schedule,
+) (*v1beta1.DependencyReport, error) {
+	report := &v1beta1.DependencyReport{}
+	targets := map[objectRef]string{}
+	for _, rule := range referenceRules {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(rule.gvk.GroupVersion().WithKind(rule.gvk.Kind + "List"))
+		if err := c.List(ctx, list); err != nil {
+			if apimeta.IsNoMatchError(err) {
+				// the resource is not installed on the hub
+				continue
+			}
+			return nil, err
+		}
+		for i := range list.Items {
+			source := &list.Items[i]
+			if !isBackedUp(schedules, rule.gvk, source) {
+				continue
+			}
+			report.Resources++
+			sourceRef := objectRef{gvk: rule.gvk, namespace: source.GetNamespace(), name: source.GetName()}
+			for _, target := range rule.getRefs(source) {
+				report.References++
+				reason, ok := targets[target]
+				if !ok {
+					var err error
+					if reason, err = getDanglingReason(ctx, c, schedules, target); err != nil {
+						return nil, err
+					}
+					targets[target] = reason
+				}
+				if reason != "" {
+					report.DanglingReferences = append(report.DanglingReferences, v1beta1.DanglingReference{
+						Source: sourceRef.String(),
+						Target: target.String(),
+						Reason: reason,
+					})
+				}
+			}
+		}
+	}
+	sort.Slice(report.DanglingReferences, func(i, j int) bool {
+		if report.DanglingReferences[i].Source != report.DanglingReferences[j].Source {
+			return report.DanglingReferences[i].Source < report.DanglingReferences[j].Source
+		}
+		return report.DanglingReferences[i].Target < report.DanglingReferences[j].Target
+	})
+	return report, nil
+}
+
+// returns why the reference is dangling, empty if the referenced resource is backed up
+func getDanglingReason(
+	ctx context.Context,
+	c client.Client,
+	schedules []veleroapi.Schedule,
+	target objectRef,
+) (string, error) {
+	gvk := target.gvk
+	if gvk.Version == "" {
+		// the reference doesn't set the version, use the preferred version of the kind
+		mapping, err := c.RESTMapper().RESTMapping(gvk.GroupKind())
+		if apimeta.IsNoMatchError(err) {
+			return danglingReasonNotFound, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		gvk = mapping.GroupVersionKind
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	err := c.Get(ctx, types.NamespacedName{Namespace: target.namespace, Name: target.name}, obj)
+	if k8serr.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+		return danglingReasonNotFound, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !isBackedUp(schedules, target.gvk, obj) {
+		return danglingReasonNotBackedUp, nil
+	}
+	return "", nil
+}
+
+// reports in the BackupSchedule status the references from the backed up resources which would be
+// broken after a restore, with a warning event for each new dangling reference;
+// the references are analyzed again each time a new set of backups completes
+func (r *BackupScheduleReconciler) updateDependencyReport(
+	ctx context.Context,
+	backupSchedule *v1beta1.BackupSchedule,
+	schedules []veleroapi.Schedule,
+) error {
+	timestamp, err := r.getLatestBackupSetTimestamp(ctx, backupSchedule)
+	if err != nil {
+		return err
+	}
+	if timestamp == "" || (backupSchedule.Status.DependencyReport != nil &&
+		backupSchedule.Status.DependencyReport.BackupTimestamp == timestamp) {
+		// no new completed backups
+		return nil
+	}
+
+	report, err := analyzeDependencies(ctx, r.Client, schedules)
+	if err != nil {
+		return err
+	}
+	now := metav1.Now()
+	report.AnalysisTime = &now
+	report.BackupTimestamp = timestamp
+
+	reported := map[v1beta1.DanglingReference]bool{}
+	if backupSchedule.Status.DependencyReport != nil {
+		for _, dangling := range backupSchedule.Status.DependencyReport.DanglingReferences {
+			reported[dangling] = true
+		}
+	}
+	if r.Recorder != nil {
+		for _, dangling := range report.DanglingReferences {
+			if !reported[dangling] {
+				r.Recorder.Event(
+					backupSchedule,
+					corev1.EventTypeWarning,
+					"Dangling reference:",
+					fmt.Sprintf("%s references %s: %s", dangling.Source, dangling.Target, dangling.Reason),
+				)
+			}
+		}
+	}
+	backupSchedule.Status.DependencyReport = report
+	return nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	chnv1 "github.com/open-cluster-management/multicloud-operators-channel/pkg/apis/apps/v1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// returns velero schedules for the credentials and the resources backups
+func newDependencySchedules(c *fake.ClientBuilder) []veleroapi.Schedule {
+	credentials := veleroapi.Schedule{ObjectMeta: metav1.ObjectMeta{Name: veleroScheduleNames[Credentials]}}
+	setCredsBackupInfo(context.Background(), &credentials.Spec.Template, c.Build(), string(UserSecret))
+	resources := veleroapi.Schedule{ObjectMeta: metav1.ObjectMeta{Name: veleroScheduleNames[Resources]}}
+	setResourcesBackupInfo(context.Background(), &resources.Spec.Template, []string{
+		"channel.apps.open-cluster-management.io",
+		"subscription.apps.open-cluster-management.io",
+	}, c.Build())
+	return []veleroapi.Schedule{credentials, resources}
+}
+
+func Test_isSelectedByBackup(t *testing.T) {
+	schedules := newDependencySchedules(fake.NewClientBuilder())
+	newObject := func(namespace string, labels map[string]string) metav1.Object {
+		return &metav1.ObjectMeta{Name: "name", Namespace: namespace, Labels: labels}
+	}
+
+	if !isSelectedByBackup(&schedules[1].Spec.Template, channelGVK, newObject("ns1", nil)) {
+		t.Errorf("isSelectedByBackup() = false for a channel")
+	}
+	if isSelectedByBackup(&schedules[1].Spec.Template, channelGVK, newObject("local-cluster", nil)) {
+		t.Errorf("isSelectedByBackup() = true for a local-cluster channel")
+	}
+	if isSelectedByBackup(&schedules[1].Spec.Template, secretGVK, newObject("ns1", nil)) {
+		t.Errorf("isSelectedByBackup() = true for a secret in the resources backup")
+	}
+	if isSelectedByBackup(&schedules[0].Spec.Template, secretGVK, newObject("ns1", nil)) {
+		t.Errorf("isSelectedByBackup() = true for an unlabeled secret")
+	}
+	labeled := newObject("ns1", map[string]string{backupCredsUserLabel: "aws"})
+	if !isSelectedByBackup(&schedules[0].Spec.Template, secretGVK, labeled) {
+		t.Errorf("isSelectedByBackup() = false for a labeled secret")
+	}
+}
+
+func Test_updateDependencyReport(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(testScheme)
+	_ = chnv1.AddToScheme(testScheme)
+	_ = veleroapi.AddToScheme(testScheme)
+
+	subscription := &unstructured.Unstructured{}
+	subscription.SetGroupVersionKind(referenceRules[0].gvk)
+	subscription.SetNamespace("ns2")
+	subscription.SetName("app")
+	_ = unstructured.SetNestedField(subscription.Object, "ns1/git", "spec", "channel")
+	_ = unstructured.SetNestedField(subscription.Object, "ns1/missing", "spec", "secondaryChannel")
+
+	builder := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		subscription,
+		&chnv1.Channel{
+			ObjectMeta: metav1.ObjectMeta{Name: "git", Namespace: "ns1"},
+			Spec:       chnv1.ChannelSpec{SecretRef: &corev1.ObjectReference{Name: "git-auth"}},
+		},
+		&chnv1.Channel{
+			ObjectMeta: metav1.ObjectMeta{Name: "helm", Namespace: "ns1"},
+			Spec:       chnv1.ChannelSpec{SecretRef: &corev1.ObjectReference{Name: "helm-auth"}},
+		},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "ns1"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      "helm-auth",
+			Namespace: "ns1",
+			Labels:    map[string]string{backupCredsUserLabel: "channel"},
+		}},
+	)
+	recorder := record.NewFakeRecorder(10)
+	c := builder.Build()
+	r := &BackupScheduleReconciler{Client: c, Recorder: recorder}
+	addBackupSet := func(timestamp string) {
+		for _, scheduleName := range veleroScheduleNames {
+			backup := newScheduledBackup(scheduleName, timestamp, veleroapi.BackupPhaseCompleted)
+			if err := c.Create(context.Background(), &backup); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// the references are not analyzed before a set of backups completes
+	backupSchedule := &v1beta1.BackupSchedule{ObjectMeta: metav1.ObjectMeta{Name: "schedule", Namespace: "velero"}}
+	if err := r.updateDependencyReport(context.Background(), backupSchedule, newDependencySchedules(builder)); err != nil {
+		t.Fatalf("updateDependencyReport() error = %v", err)
+	}
+	if backupSchedule.Status.DependencyReport != nil {
+		t.Fatalf("updateDependencyReport() report = %v, want none", backupSchedule.Status.DependencyReport)
+	}
+
+	addBackupSet("20211019100000")
+	if err := r.updateDependencyReport(context.Background(), backupSchedule, newDependencySchedules(builder)); err != nil {
+		t.Fatalf("updateDependencyReport() error = %v", err)
+	}
+	report := backupSchedule.Status.DependencyReport
+	if report == nil || report.AnalysisTime == nil || report.BackupTimestamp != "20211019100000" {
+		t.Fatalf("updateDependencyReport() report = %v", report)
+	}
+	if report.Resources != 3 || report.References != 4 {
+		t.Errorf("updateDependencyReport() resources = %d, references = %d, want 3, 4",
+			report.Resources, report.References)
+	}
+	want := []v1beta1.DanglingReference{
+		{
+			Source: "Channel.apps.open-cluster-management.io ns1/git",
+			Target: "Secret ns1/git-auth",
+			Reason: danglingReasonNotBackedUp,
+		},
+		{
+			Source: "Subscription.apps.open-cluster-management.io ns2/app",
+			Target: "Channel.apps.open-cluster-management.io ns1/missing",
+			Reason: danglingReasonNotFound,
+		},
+	}
+	if !reflect.DeepEqual(report.DanglingReferences, want) {
+		t.Errorf("updateDependencyReport() dangling = %v, want %v", report.DanglingReferences, want)
+	}
+	if len(recorder.Events) != 2 {
+		t.Errorf("updateDependencyReport() reported %d events, want 2", len(recorder.Events))
+	}
+
+	// the references are analyzed once per set of backups
+	if err := r.updateDependencyReport(context.Background(), backupSchedule, newDependencySchedules(builder)); err != nil {
+		t.Fatalf("updateDependencyReport() error = %v", err)
+	}
+	if backupSchedule.Status.DependencyReport != report {
+		t.Errorf("updateDependencyReport() analyzed the same backups again")
+	}
+
+	// the dangling references are reported once
+	addBackupSet("20211019110000")
+	if err := r.updateDependencyReport(context.Background(), backupSchedule, newDependencySchedules(builder)); err != nil {
+		t.Fatalf("updateDependencyReport() error = %v", err)
+	}
+	if backupSchedule.Status.DependencyReport.BackupTimestamp != "20211019110000" {
+		t.Errorf("updateDependencyReport() report = %v", backupSchedule.Status.DependencyReport)
+	}
+	if len(recorder.Events) != 2 {
+		t.Errorf("updateDependencyReport() reported %d events, want 2", len(recorder.Events))
+	}
+}
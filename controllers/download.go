@@ -0,0 +1,120 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// time to wait for velero to process a download request
+	downloadRequestTimeout = time.Minute * 1
+	// time to wait before checking again a download request not processed yet
+	downloadRequestInterval = time.Second * 5
+)
+
+// errDownloadNotReady is returned while velero has not processed a download request
+var errDownloadNotReady = errors.New("velero download request not processed yet")
+
+// downloadVeleroFile asks velero for a file kept in the backup storage location,
+// such as the restore results or a backup resource list, and passes the uncompressed content to read.
+// Processed download requests are reused until they expire and are removed by velero.
+// Returns errDownloadNotReady if velero hasn't processed the download request yet
+func downloadVeleroFile(
+	ctx context.Context,
+	c client.Client,
+	namespace string,
+	name string,
+	kind veleroapi.DownloadTargetKind,
+	read func(io.Reader) error,
+) error {
+	downloadRequest := &veleroapi.DownloadRequest{}
+	downloadRequestIdentity := types.NamespacedName{
+		Name:      getValidKsRestoreName(name, strings.ToLower(string(kind))),
+		Namespace: namespace,
+	}
+
+	err := c.Get(ctx, downloadRequestIdentity, downloadRequest)
+	if err == nil && downloadRequest.Status.Expiration != nil &&
+		downloadRequest.Status.Expiration.Time.Before(time.Now()) {
+		// the download URL is no longer valid, a new request is created on the next call
+		if err := c.Delete(ctx, downloadRequest); err != nil && !k8serr.IsNotFound(err) {
+			return err
+		}
+		return errDownloadNotReady
+	}
+	if err != nil {
+		if !k8serr.IsNotFound(err) {
+			return err
+		}
+		downloadRequest.Name = downloadRequestIdentity.Name
+		downloadRequest.Namespace = downloadRequestIdentity.Namespace
+		downloadRequest.Spec.Target.Kind = kind
+		downloadRequest.Spec.Target.Name = name
+		if err := c.Create(ctx, downloadRequest, &client.CreateOptions{}); err != nil {
+			return err
+		}
+		return errDownloadNotReady
+	}
+
+	if downloadRequest.Status.DownloadURL == "" {
+		if time.Since(downloadRequest.CreationTimestamp.Time) < downloadRequestTimeout {
+			return errDownloadNotReady
+		}
+		_ = c.Delete(ctx, downloadRequest)
+		return fmt.Errorf("velero did not process download request %s", downloadRequest.Name)
+	}
+
+	httpClient := &http.Client{Timeout: downloadRequestTimeout}
+	resp, err := httpClient.Get(downloadRequest.Status.DownloadURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to download %s for %s: %s", kind, name, resp.Status)
+	}
+
+	gzipReader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	return read(gzipReader)
+}
+
+// decodeJSON returns a function reading JSON content into out
+func decodeJSON(out interface{}) func(io.Reader) error {
+	return func(reader io.Reader) error {
+		return json.NewDecoder(reader).Decode(out)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_downloadVeleroFile(t *testing.T) {
+	results := map[string]veleroRestoreResult{
+		"warnings": {Velero: []string{"some warning"}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gzipWriter := gzip.NewWriter(w)
+		_ = json.NewEncoder(gzipWriter).Encode(results)
+		gzipWriter.Close()
+	}))
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	if err := veleroapi.AddToScheme(scheme); err != nil {
+		t.Fatalf("unable to add velero types to scheme: %v", err)
+	}
+
+	processedRequest := &veleroapi.DownloadRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "restore-processed-restoreresults",
+			Namespace: "velero",
+		},
+		Status: veleroapi.DownloadRequestStatus{
+			DownloadURL: server.URL,
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(processedRequest).Build()
+
+	got := map[string]veleroRestoreResult{}
+	if err := downloadVeleroFile(
+		context.Background(),
+		c,
+		"velero",
+		"restore-new",
+		veleroapi.DownloadTargetKindRestoreResults,
+		decodeJSON(&got),
+	); !errors.Is(err, errDownloadNotReady) {
+		t.Errorf("downloadVeleroFile() error = %v, want %v", err, errDownloadNotReady)
+	}
+
+	if err := downloadVeleroFile(
+		context.Background(),
+		c,
+		"velero",
+		"restore-processed",
+		veleroapi.DownloadTargetKindRestoreResults,
+		decodeJSON(&got),
+	); err != nil {
+		t.Errorf("downloadVeleroFile() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, results) {
+		t.Errorf("downloadVeleroFile() = %v, want %v", got, results)
+	}
+}
@@ -0,0 +1,400 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	clusterv1 "github.com/open-cluster-management/api/cluster/v1"
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// interval used to check the progress of a running failover step
+	failoverCheckInterval = 10 * time.Second
+	// how long to wait for the restored managed clusters when the failover doesn't set it
+	defaultManagedClustersTimeout = 1 * time.Hour
+	// key of the kubeconfig in the old hub kubeconfig secret
+	oldHubKubeconfigKey = "kubeconfig"
+)
+
+// hubFailoverSteps lists the failover steps, in the order they are run
+var hubFailoverSteps = []v1beta1.HubFailoverStepName{
+	v1beta1.HubFailoverStepStopOldHubBackupSchedule,
+	v1beta1.HubFailoverStepPassiveRestore,
+	v1beta1.HubFailoverStepActivationRestore,
+	v1beta1.HubFailoverStepWaitManagedClustersAvailable,
+	v1beta1.HubFailoverStepCreateBackupSchedule,
+}
+
+// newOldHubClient returns a client connecting to the old hub with this kubeconfig
+var newOldHubClient = func(kubeconfig []byte, scheme *runtime.Scheme) (client.Client, error) {
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(restConfig, client.Options{Scheme: scheme})
+}
+
+// HubFailoverReconciler reconciles a HubFailover object
+type HubFailoverReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=hubfailovers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=hubfailovers/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=hubfailovers/finalizers,verbs=update
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=restores,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=backupschedules,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=managedclusters,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// Reconcile runs the failover steps in order, one step at a time,
+// recording the progress of each step in the HubFailover status
+func (r *HubFailoverReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	failoverLogger := log.FromContext(ctx)
+	failover := &v1beta1.HubFailover{}
+
+	if err := r.Get(ctx, req.NamespacedName, failover); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if failover.Status.Phase == v1beta1.HubFailoverPhaseCompleted ||
+		failover.Status.Phase == v1beta1.HubFailoverPhaseFailed {
+		// the failover runs once
+		return ctrl.Result{}, nil
+	}
+
+	if len(failover.Status.Steps) == 0 {
+		for _, name := range hubFailoverSteps {
+			failover.Status.Steps = append(failover.Status.Steps, v1beta1.HubFailoverStep{
+				Name:  name,
+				Phase: v1beta1.HubFailoverStepPhasePending,
+			})
+		}
+		failover.Status.Phase = v1beta1.HubFailoverPhaseRunning
+	}
+
+	result := ctrl.Result{}
+	completed := true
+	for i := range failover.Status.Steps {
+		step := &failover.Status.Steps[i]
+		if step.Phase == v1beta1.HubFailoverStepPhaseCompleted ||
+			step.Phase == v1beta1.HubFailoverStepPhaseSkipped {
+			continue
+		}
+		completed = false
+
+		now := metav1.Now()
+		if step.StartTime == nil {
+			step.StartTime = &now
+		}
+
+		phase, msg, err := r.runFailoverStep(ctx, failover, step)
+		if err != nil {
+			// retry the step after failureInterval
+			failoverLogger.Error(err, "failover step error", "step", step.Name)
+			step.Phase = v1beta1.HubFailoverStepPhaseRunning
+			step.Message = err.Error()
+			failover.Status.LastMessage = fmt.Sprintf("Failover step %s: %v", step.Name, err)
+			result.RequeueAfter = failureInterval
+			break
+		}
+
+		step.Phase = phase
+		step.Message = msg
+		if phase == v1beta1.HubFailoverStepPhaseRunning {
+			failover.Status.LastMessage = fmt.Sprintf("Failover step %s: %s", step.Name, msg)
+			result.RequeueAfter = failoverCheckInterval
+			break
+		}
+
+		step.CompletionTime = &now
+		r.Recorder.Event(
+			failover,
+			corev1.EventTypeNormal,
+			"Hub failover step "+strings.ToLower(string(phase))+":",
+			fmt.Sprintf("%s: %s", step.Name, msg),
+		)
+		if phase == v1beta1.HubFailoverStepPhaseFailed {
+			failover.Status.Phase = v1beta1.HubFailoverPhaseFailed
+			failover.Status.LastMessage = fmt.Sprintf("Failover step %s failed: %s", step.Name, msg)
+			break
+		}
+		completed = i == len(failover.Status.Steps)-1
+	}
+
+	if completed {
+		failover.Status.Phase = v1beta1.HubFailoverPhaseCompleted
+		failover.Status.LastMessage = "Hub failover completed, this hub is the active hub"
+	}
+
+	return result, errors.Wrap(
+		r.Client.Status().Update(ctx, failover),
+		fmt.Sprintf("could not update status for hub failover %s/%s", failover.Namespace, failover.Name),
+	)
+}
+
+// run a failover step and return its phase;
+// an error is returned for transient failures, the step being retried
+func (r *HubFailoverReconciler) runFailoverStep(
+	ctx context.Context,
+	failover *v1beta1.HubFailover,
+	step *v1beta1.HubFailoverStep,
+) (v1beta1.HubFailoverStepPhase, string, error) {
+	switch step.Name {
+	case v1beta1.HubFailoverStepStopOldHubBackupSchedule:
+		return r.stopOldHubBackupSchedule(ctx, failover)
+	case v1beta1.HubFailoverStepPassiveRestore:
+		restore, err := r.ensureFailoverRestore(ctx, failover, "passive", skipRestoreStr, latestBackupStr)
+		if err != nil {
+			return "", "", err
+		}
+		failover.Status.PassiveRestoreName = restore.Name
+		phase, msg := getFailoverRestorePhase(restore)
+		return phase, msg, nil
+	case v1beta1.HubFailoverStepActivationRestore:
+		restore, err := r.ensureFailoverRestore(ctx, failover, "activate", latestBackupStr, skipRestoreStr)
+		if err != nil {
+			return "", "", err
+		}
+		failover.Status.ActivationRestoreName = restore.Name
+		phase, msg := getFailoverRestorePhase(restore)
+		return phase, msg, nil
+	case v1beta1.HubFailoverStepWaitManagedClustersAvailable:
+		managedClusters := &clusterv1.ManagedClusterList{}
+		if err := r.List(ctx, managedClusters); err != nil {
+			return "", "", err
+		}
+		phase, msg := getManagedClustersAvailablePhase(failover, step, managedClusters.Items, time.Now())
+		return phase, msg, nil
+	case v1beta1.HubFailoverStepCreateBackupSchedule:
+		return r.createFailoverBackupSchedule(ctx, failover)
+	}
+	return v1beta1.HubFailoverStepPhaseFailed, fmt.Sprintf("unknown failover step %s", step.Name), nil
+}
+
+// remove the BackupSchedule resources from the old hub, if the old hub kubeconfig is available
+func (r *HubFailoverReconciler) stopOldHubBackupSchedule(
+	ctx context.Context,
+	failover *v1beta1.HubFailover,
+) (v1beta1.HubFailoverStepPhase, string, error) {
+	if failover.Spec.OldHubKubeconfigSecret == "" {
+		return v1beta1.HubFailoverStepPhaseSkipped,
+			"No old hub kubeconfig secret, the BackupSchedule resources must be removed from the old hub",
+			nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(
+		ctx,
+		types.NamespacedName{Namespace: failover.Namespace, Name: failover.Spec.OldHubKubeconfigSecret},
+		secret,
+	); err != nil {
+		if k8serr.IsNotFound(err) {
+			return v1beta1.HubFailoverStepPhaseFailed,
+				fmt.Sprintf("Old hub kubeconfig secret %s not found", failover.Spec.OldHubKubeconfigSecret),
+				nil
+		}
+		return "", "", err
+	}
+	kubeconfig, ok := secret.Data[oldHubKubeconfigKey]
+	if !ok {
+		return v1beta1.HubFailoverStepPhaseFailed,
+			fmt.Sprintf("Secret %s has no %s key", secret.Name, oldHubKubeconfigKey),
+			nil
+	}
+	oldHubClient, err := newOldHubClient(kubeconfig, r.Scheme)
+	if err != nil {
+		return v1beta1.HubFailoverStepPhaseFailed,
+			fmt.Sprintf("Unable to connect to the old hub: %v", err),
+			nil
+	}
+
+	backupSchedules := &v1beta1.BackupScheduleList{}
+	if err := oldHubClient.List(ctx, backupSchedules, client.InNamespace(failover.Namespace)); err != nil {
+		return "", "", fmt.Errorf("unable to list the old hub BackupSchedule resources: %v", err)
+	}
+	for i := range backupSchedules.Items {
+		if err := oldHubClient.Delete(ctx, &backupSchedules.Items[i]); err != nil && !k8serr.IsNotFound(err) {
+			return "", "", fmt.Errorf("unable to remove the old hub BackupSchedule %s: %v",
+				backupSchedules.Items[i].Name, err)
+		}
+	}
+	return v1beta1.HubFailoverStepPhaseCompleted,
+		fmt.Sprintf("Removed %d BackupSchedule resources from the old hub", len(backupSchedules.Items)),
+		nil
+}
+
+// returns the failover restore with this suffix, creating it if it doesn't exist;
+// an existing restore is reused, for instance when the failover is created again
+func (r *HubFailoverReconciler) ensureFailoverRestore(
+	ctx context.Context,
+	failover *v1beta1.HubFailover,
+	suffix string,
+	managedClustersBackupName string,
+	backupName string,
+) (*v1beta1.Restore, error) {
+	restore := &v1beta1.Restore{}
+	name := failover.Name + "-" + suffix
+	err := r.Get(ctx, types.NamespacedName{Namespace: failover.Namespace, Name: name}, restore)
+	if err == nil || !k8serr.IsNotFound(err) {
+		return restore, err
+	}
+
+	credentialsBackupName := backupName
+	resourcesBackupName := backupName
+	restore = &v1beta1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: failover.Namespace,
+		},
+		Spec: v1beta1.RestoreSpec{
+			VeleroManagedClustersBackupName: &managedClustersBackupName,
+			VeleroCredentialsBackupName:     &credentialsBackupName,
+			VeleroResourcesBackupName:       &resourcesBackupName,
+			// the credentials are encrypted with the key of the BackupSchedule moved to this hub
+			CredentialsEncryption: failover.Spec.BackupSchedule.CredentialsEncryption.DeepCopy(),
+		},
+	}
+	if err := ctrl.SetControllerReference(failover, restore, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := r.Create(ctx, restore); err != nil {
+		return nil, err
+	}
+	r.Recorder.Event(failover, corev1.EventTypeNormal, "Restore created:", restore.Name)
+	return restore, nil
+}
+
+// returns the failover step phase for this restore
+func getFailoverRestorePhase(restore *v1beta1.Restore) (v1beta1.HubFailoverStepPhase, string) {
+	switch restore.Status.Phase {
+	case v1beta1.RestorePhaseFinished, v1beta1.RestorePhaseFinishedWithErrors:
+		return v1beta1.HubFailoverStepPhaseCompleted,
+			fmt.Sprintf("Restore %s: %s", restore.Name, restore.Status.LastMessage)
+	case v1beta1.RestorePhaseError:
+		return v1beta1.HubFailoverStepPhaseFailed,
+			fmt.Sprintf("Restore %s: %s", restore.Name, restore.Status.LastMessage)
+	}
+	return v1beta1.HubFailoverStepPhaseRunning, fmt.Sprintf("Waiting for restore %s to finish", restore.Name)
+}
+
+// returns the failover step phase while waiting for the managed clusters to be available
+func getManagedClustersAvailablePhase(
+	failover *v1beta1.HubFailover,
+	step *v1beta1.HubFailoverStep,
+	managedClusters []clusterv1.ManagedCluster,
+	now time.Time,
+) (v1beta1.HubFailoverStepPhase, string) {
+	total := 0
+	notAvailable := []string{}
+	for i := range managedClusters {
+		if managedClusters[i].Name == "local-cluster" {
+			continue
+		}
+		total++
+		if !isManagedClusterAvailable(&managedClusters[i]) {
+			notAvailable = append(notAvailable, managedClusters[i].Name)
+		}
+	}
+	if len(notAvailable) == 0 {
+		return v1beta1.HubFailoverStepPhaseCompleted, fmt.Sprintf("All %d managed clusters are available", total)
+	}
+	sort.Strings(notAvailable)
+
+	timeout := failover.Spec.ManagedClustersTimeout.Duration
+	if timeout == 0 {
+		timeout = defaultManagedClustersTimeout
+	}
+	msg := fmt.Sprintf(
+		"%d of %d managed clusters are available, waiting for %s",
+		total-len(notAvailable),
+		total,
+		strings.Join(notAvailable, ", "),
+	)
+	if step.StartTime != nil && now.Sub(step.StartTime.Time) > timeout {
+		return v1beta1.HubFailoverStepPhaseFailed, fmt.Sprintf("Timeout after %s, %s", timeout, msg)
+	}
+	return v1beta1.HubFailoverStepPhaseRunning, msg
+}
+
+// create the BackupSchedule on this hub and wait for it to be enabled
+func (r *HubFailoverReconciler) createFailoverBackupSchedule(
+	ctx context.Context,
+	failover *v1beta1.HubFailover,
+) (v1beta1.HubFailoverStepPhase, string, error) {
+	backupSchedule := &v1beta1.BackupSchedule{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: failover.Namespace, Name: failover.Name}, backupSchedule)
+	if err != nil {
+		if !k8serr.IsNotFound(err) {
+			return "", "", err
+		}
+		backupSchedule = &v1beta1.BackupSchedule{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      failover.Name,
+				Namespace: failover.Namespace,
+			},
+			Spec: failover.Spec.BackupSchedule,
+		}
+		// not owned by the failover, the schedule must outlive it
+		if err := r.Create(ctx, backupSchedule); err != nil {
+			return "", "", err
+		}
+		r.Recorder.Event(failover, corev1.EventTypeNormal, "BackupSchedule created:", backupSchedule.Name)
+	}
+	failover.Status.BackupScheduleName = backupSchedule.Name
+
+	switch backupSchedule.Status.Phase {
+	case v1beta1.SchedulePhaseEnabled:
+		return v1beta1.HubFailoverStepPhaseCompleted,
+			fmt.Sprintf("BackupSchedule %s is enabled", backupSchedule.Name),
+			nil
+	case v1beta1.SchedulePhaseFailed, v1beta1.SchedulePhaseFailedValidation:
+		return v1beta1.HubFailoverStepPhaseFailed,
+			fmt.Sprintf("BackupSchedule %s: %s", backupSchedule.Name, backupSchedule.Status.LastMessage),
+			nil
+	}
+	return v1beta1.HubFailoverStepPhaseRunning,
+		fmt.Sprintf("Waiting for BackupSchedule %s to be enabled", backupSchedule.Name),
+		nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *HubFailoverReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1beta1.HubFailover{}).
+		Owns(&v1beta1.Restore{}).
+		Complete(r)
+}
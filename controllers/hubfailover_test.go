@@ -0,0 +1,192 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	clusterv1 "github.com/open-cluster-management/api/cluster/v1"
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newAvailableManagedCluster(name string, available bool) clusterv1.ManagedCluster {
+	managedCluster := clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if available {
+		managedCluster.Status.Conditions = []metav1.Condition{{
+			Type:   clusterv1.ManagedClusterConditionAvailable,
+			Status: metav1.ConditionTrue,
+		}}
+	}
+	return managedCluster
+}
+
+func Test_getManagedClustersAvailablePhase(t *testing.T) {
+	now := time.Now()
+	failover := &v1beta1.HubFailover{
+		Spec: v1beta1.HubFailoverSpec{ManagedClustersTimeout: metav1.Duration{Duration: time.Minute}},
+	}
+	tests := []struct {
+		name            string
+		startTime       time.Time
+		managedClusters []clusterv1.ManagedCluster
+		want            v1beta1.HubFailoverStepPhase
+	}{
+		{
+			name:      "all available",
+			startTime: now,
+			managedClusters: []clusterv1.ManagedCluster{
+				newAvailableManagedCluster("local-cluster", false),
+				newAvailableManagedCluster("cluster1", true),
+			},
+			want: v1beta1.HubFailoverStepPhaseCompleted,
+		},
+		{
+			name:      "waiting",
+			startTime: now,
+			managedClusters: []clusterv1.ManagedCluster{
+				newAvailableManagedCluster("cluster1", true),
+				newAvailableManagedCluster("cluster2", false),
+			},
+			want: v1beta1.HubFailoverStepPhaseRunning,
+		},
+		{
+			name:      "timeout",
+			startTime: now.Add(-time.Hour),
+			managedClusters: []clusterv1.ManagedCluster{
+				newAvailableManagedCluster("cluster2", false),
+			},
+			want: v1beta1.HubFailoverStepPhaseFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := &v1beta1.HubFailoverStep{StartTime: &metav1.Time{Time: tt.startTime}}
+			if got, msg := getManagedClustersAvailablePhase(failover, step, tt.managedClusters, now); got != tt.want {
+				t.Errorf("getManagedClustersAvailablePhase() = %v (%s), want %v", got, msg, tt.want)
+			}
+		})
+	}
+}
+
+func Test_HubFailoverReconciler_Reconcile(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(testScheme)
+	_ = clusterv1.AddToScheme(testScheme)
+	_ = v1beta1.AddToScheme(testScheme)
+
+	ctx := context.Background()
+	failover := &v1beta1.HubFailover{
+		ObjectMeta: metav1.ObjectMeta{Name: "failover", Namespace: "velero"},
+		Spec: v1beta1.HubFailoverSpec{
+			OldHubKubeconfigSecret: "old-hub",
+			BackupSchedule:         v1beta1.BackupScheduleSpec{VeleroSchedule: "0 */6 * * *", MaxBackups: 10},
+		},
+	}
+	cluster1 := newAvailableManagedCluster("cluster1", true)
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		failover,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "old-hub", Namespace: "velero"},
+			Data:       map[string][]byte{oldHubKubeconfigKey: []byte("kubeconfig")},
+		},
+		&cluster1,
+	).Build()
+
+	oldHubClient := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		&v1beta1.BackupSchedule{ObjectMeta: metav1.ObjectMeta{Name: "schedule", Namespace: "velero"}},
+	).Build()
+	defer func(f func([]byte, *runtime.Scheme) (client.Client, error)) { newOldHubClient = f }(newOldHubClient)
+	newOldHubClient = func([]byte, *runtime.Scheme) (client.Client, error) { return oldHubClient, nil }
+
+	r := &HubFailoverReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(20)}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "failover", Namespace: "velero"}}
+
+	reconcile := func() *v1beta1.HubFailover {
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		got := &v1beta1.HubFailover{}
+		if err := c.Get(ctx, req.NamespacedName, got); err != nil {
+			t.Fatalf("unable to get the failover: %v", err)
+		}
+		return got
+	}
+	finishRestore := func(name string) {
+		restore := &v1beta1.Restore{}
+		if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: "velero"}, restore); err != nil {
+			t.Fatalf("restore %s not created: %v", name, err)
+		}
+		restore.Status.Phase = v1beta1.RestorePhaseFinished
+		if err := c.Status().Update(ctx, restore); err != nil {
+			t.Fatalf("unable to update restore %s: %v", name, err)
+		}
+	}
+
+	got := reconcile()
+	if got.Status.Steps[0].Phase != v1beta1.HubFailoverStepPhaseCompleted ||
+		got.Status.Steps[1].Phase != v1beta1.HubFailoverStepPhaseRunning {
+		t.Fatalf("unexpected steps after the first reconcile: %v", got.Status.Steps)
+	}
+	if err := oldHubClient.Get(
+		ctx,
+		types.NamespacedName{Name: "schedule", Namespace: "velero"},
+		&v1beta1.BackupSchedule{},
+	); !k8serr.IsNotFound(err) {
+		t.Errorf("old hub BackupSchedule not removed: %v", err)
+	}
+
+	finishRestore(got.Status.PassiveRestoreName)
+	got = reconcile()
+	if got.Status.Steps[2].Phase != v1beta1.HubFailoverStepPhaseRunning {
+		t.Fatalf("activation restore not running: %v", got.Status.Steps)
+	}
+
+	finishRestore(got.Status.ActivationRestoreName)
+	got = reconcile()
+	if got.Status.Steps[3].Phase != v1beta1.HubFailoverStepPhaseCompleted ||
+		got.Status.Steps[4].Phase != v1beta1.HubFailoverStepPhaseRunning {
+		t.Fatalf("unexpected steps after the activation: %v", got.Status.Steps)
+	}
+
+	backupSchedule := &v1beta1.BackupSchedule{}
+	if err := c.Get(ctx, types.NamespacedName{Name: got.Status.BackupScheduleName, Namespace: "velero"},
+		backupSchedule); err != nil {
+		t.Fatalf("BackupSchedule not created: %v", err)
+	}
+	backupSchedule.Status.Phase = v1beta1.SchedulePhaseEnabled
+	if err := c.Status().Update(ctx, backupSchedule); err != nil {
+		t.Fatalf("unable to update the BackupSchedule: %v", err)
+	}
+
+	got = reconcile()
+	if got.Status.Phase != v1beta1.HubFailoverPhaseCompleted {
+		t.Errorf("failover phase = %v, want %v: %v", got.Status.Phase, v1beta1.HubFailoverPhaseCompleted,
+			got.Status.LastMessage)
+	}
+}
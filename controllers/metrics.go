@@ -0,0 +1,49 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// number of resources of a kind saved by the latest verified backups, and found on the hub
+	backupVerificationResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cluster_backup_verification_resources",
+			Help: "Number of resources of a kind saved by the latest verified backup (source=backup) " +
+				"and found on the hub (source=hub)",
+		},
+		[]string{"schedule", "kind", "source"},
+	)
+	// number of kinds with much less backed up resources than found on the hub
+	backupVerificationDrops = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cluster_backup_verification_drops",
+			Help: "Number of kinds with much less resources saved by the latest verified backup than found on the hub",
+		},
+		[]string{"schedule"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		backupVerificationResources,
+		backupVerificationDrops,
+	)
+}
@@ -0,0 +1,336 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	authv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// name of the velero deployment created by the OADP operator
+	veleroDeploymentName = "velero"
+	// wait time before running again the pre-flight checks after a failure
+	preflightCheckInterval = time.Minute
+)
+
+// names of the pre-flight checks
+const (
+	preflightVeleroCRDs         = "VeleroCRDs"
+	preflightVeleroDeployment   = "VeleroDeployment"
+	preflightStorageCredentials = "StorageLocationCredentials"
+	preflightHubCRDs            = "HubCRDs"
+	preflightPermissions        = "Permissions"
+)
+
+// accessRequirement is an action the operator must be allowed to perform in the velero namespace
+type accessRequirement struct {
+	group    string
+	resource string
+	verb     string
+}
+
+var (
+	// velero resources used by the operator
+	veleroRequiredResources = []string{
+		"backups",
+		"backupstoragelocations",
+		"deletebackuprequests",
+		"downloadrequests",
+		"restores",
+		"schedules",
+	}
+
+	// hub resources backed up by the operator, by group version;
+	// the check fails if the required resources are missing
+	hubRequiredResources = map[string][]string{
+		"apps.open-cluster-management.io/v1":    {"channels"},
+		"cluster.open-cluster-management.io/v1": {"managedclusters"},
+	}
+	// the check reports a warning if the optional resources are missing
+	hubOptionalResources = map[string][]string{
+		"hive.openshift.io/v1": {"clusterdeployments", "clusterpools"},
+	}
+
+	// actions the BackupSchedule controller must be allowed to perform
+	schedulePermissions = []accessRequirement{
+		{group: veleroapi.SchemeGroupVersion.Group, resource: "schedules", verb: "create"},
+		{group: veleroapi.SchemeGroupVersion.Group, resource: "schedules", verb: "delete"},
+		{group: veleroapi.SchemeGroupVersion.Group, resource: "backups", verb: "list"},
+		{group: veleroapi.SchemeGroupVersion.Group, resource: "deletebackuprequests", verb: "create"},
+	}
+	// actions the Restore controller must be allowed to perform
+	restorePermissions = []accessRequirement{
+		{group: veleroapi.SchemeGroupVersion.Group, resource: "restores", verb: "create"},
+		{group: veleroapi.SchemeGroupVersion.Group, resource: "backups", verb: "list"},
+		{group: veleroapi.SchemeGroupVersion.Group, resource: "downloadrequests", verb: "create"},
+	}
+)
+
+// reviewAccess returns true if the operator is allowed to perform the action in the namespace
+var reviewAccess = func(
+	ctx context.Context,
+	c client.Client,
+	namespace string,
+	requirement accessRequirement,
+) (bool, error) {
+	review := &authv1.SelfSubjectAccessReview{
+		Spec: authv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authv1.ResourceAttributes{
+				Namespace: namespace,
+				Group:     requirement.group,
+				Resource:  requirement.resource,
+				Verb:      requirement.verb,
+			},
+		},
+	}
+	if err := c.Create(ctx, review); err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
+
+// runs the checks validating velero can create the backups or restores
+// using the storage location, before creating the velero resources
+func runPreflightChecks(
+	ctx context.Context,
+	c client.Client,
+	dc discovery.DiscoveryInterface,
+	namespace string,
+	storageLocation string,
+	permissions []accessRequirement,
+) []v1beta1.PreflightCheck {
+	return []v1beta1.PreflightCheck{
+		checkVeleroCRDs(dc),
+		checkVeleroDeployment(ctx, c, namespace),
+		checkStorageLocationCredentials(ctx, c, namespace, storageLocation),
+		checkHubCRDs(dc),
+		checkPermissions(ctx, c, namespace, permissions),
+	}
+}
+
+// returns the messages of the failed checks
+func getFailedPreflightChecks(checks []v1beta1.PreflightCheck) []string {
+	failed := []string{}
+	for _, check := range checks {
+		if check.Status == v1beta1.PreflightCheckFailed {
+			failed = append(failed, check.Name+": "+check.Message)
+		}
+	}
+	return failed
+}
+
+func newPreflightCheck(
+	name string,
+	status v1beta1.PreflightCheckStatus,
+	format string,
+	args ...interface{},
+) v1beta1.PreflightCheck {
+	return v1beta1.PreflightCheck{
+		Name:    name,
+		Status:  status,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// returns the resources of the group version not found on the hub
+func findMissingResources(
+	dc discovery.DiscoveryInterface,
+	groupVersion string,
+	resources []string,
+) ([]string, error) {
+	resourceList, err := dc.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		return nil, err
+	}
+	missing := []string{}
+	for _, resource := range resources {
+		found := false
+		for _, apiResource := range resourceList.APIResources {
+			if apiResource.Name == resource {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, resource)
+		}
+	}
+	return missing, nil
+}
+
+// checks the velero CRDs are installed
+func checkVeleroCRDs(dc discovery.DiscoveryInterface) v1beta1.PreflightCheck {
+	groupVersion := veleroapi.SchemeGroupVersion.String()
+	missing, err := findMissingResources(dc, groupVersion, veleroRequiredResources)
+	if err != nil {
+		return newPreflightCheck(preflightVeleroCRDs, v1beta1.PreflightCheckFailed,
+			"velero CRDs not found, install the OADP operator: %v", err)
+	}
+	if len(missing) > 0 {
+		return newPreflightCheck(preflightVeleroCRDs, v1beta1.PreflightCheckFailed,
+			"velero resources %s not found in %s", strings.Join(missing, ", "), groupVersion)
+	}
+	return newPreflightCheck(preflightVeleroCRDs, v1beta1.PreflightCheckPassed,
+		"velero CRDs are installed")
+}
+
+// checks the velero deployment from the namespace has ready replicas
+func checkVeleroDeployment(ctx context.Context, c client.Client, namespace string) v1beta1.PreflightCheck {
+	deployment := &unstructured.Unstructured{}
+	deployment.SetGroupVersionKind(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: veleroDeploymentName}, deployment); err != nil {
+		return newPreflightCheck(preflightVeleroDeployment, v1beta1.PreflightCheckFailed,
+			"velero deployment not found in namespace %s, check the OADP DataProtectionApplication: %v",
+			namespace, err)
+	}
+	readyReplicas, _, _ := unstructured.NestedInt64(deployment.Object, "status", "readyReplicas")
+	if readyReplicas < 1 {
+		return newPreflightCheck(preflightVeleroDeployment, v1beta1.PreflightCheckFailed,
+			"velero deployment %s/%s has no ready replicas", namespace, veleroDeploymentName)
+	}
+	return newPreflightCheck(preflightVeleroDeployment, v1beta1.PreflightCheckPassed,
+		"velero deployment %s/%s is ready", namespace, veleroDeploymentName)
+}
+
+// checks velero validated the storage location and the credentials secret exists
+func checkStorageLocationCredentials(
+	ctx context.Context,
+	c client.Client,
+	namespace string,
+	selectedName string,
+) v1beta1.PreflightCheck {
+	locations := &veleroapi.BackupStorageLocationList{}
+	if err := c.List(ctx, locations, client.InNamespace(namespace)); err != nil {
+		return newPreflightCheck(preflightStorageCredentials, v1beta1.PreflightCheckFailed,
+			"unable to list storage locations: %v", err)
+	}
+	var location *veleroapi.BackupStorageLocation
+	for i := range locations.Items {
+		if isValidStorageLocation(&locations.Items[i], selectedName) {
+			location = &locations.Items[i]
+			break
+		}
+	}
+	if location == nil {
+		location = findStorageLocation(locations, namespace, selectedName)
+	}
+	if location == nil {
+		return newPreflightCheck(preflightStorageCredentials, v1beta1.PreflightCheckFailed,
+			"no storage location found in namespace %s", namespace)
+	}
+	if location.Status.Phase != veleroapi.BackupStorageLocationPhaseAvailable {
+		return newPreflightCheck(preflightStorageCredentials, v1beta1.PreflightCheckFailed,
+			"velero can't access storage location %s, check the %s credentials and bucket",
+			location.Name, location.Spec.Provider)
+	}
+	if !isValidStorageLocation(location, selectedName) {
+		return newPreflightCheck(preflightStorageCredentials, v1beta1.PreflightCheckFailed,
+			"storage location %s was not created by the OADP operator, "+
+				"set the storageLocation property to use it", location.Name)
+	}
+	if credential := location.Spec.Credential; credential != nil {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: credential.Name}, secret); err != nil {
+			return newPreflightCheck(preflightStorageCredentials, v1beta1.PreflightCheckFailed,
+				"credentials secret %s/%s of storage location %s not found: %v",
+				namespace, credential.Name, location.Name, err)
+		}
+		if _, ok := secret.Data[credential.Key]; !ok {
+			return newPreflightCheck(preflightStorageCredentials, v1beta1.PreflightCheckFailed,
+				"credentials secret %s/%s of storage location %s has no %s key",
+				namespace, credential.Name, location.Name, credential.Key)
+		}
+	}
+	return newPreflightCheck(preflightStorageCredentials, v1beta1.PreflightCheckPassed,
+		"velero validated the credentials of storage location %s", location.Name)
+}
+
+// checks the hub resources backed up by the operator are installed
+func checkHubCRDs(dc discovery.DiscoveryInterface) v1beta1.PreflightCheck {
+	missingRequired := findMissingHubResources(dc, hubRequiredResources)
+	if len(missingRequired) > 0 {
+		return newPreflightCheck(preflightHubCRDs, v1beta1.PreflightCheckFailed,
+			"hub resources not found: %s", strings.Join(missingRequired, ", "))
+	}
+	missingOptional := findMissingHubResources(dc, hubOptionalResources)
+	if len(missingOptional) > 0 {
+		return newPreflightCheck(preflightHubCRDs, v1beta1.PreflightCheckWarning,
+			"hub resources not found, they are not backed up: %s", strings.Join(missingOptional, ", "))
+	}
+	return newPreflightCheck(preflightHubCRDs, v1beta1.PreflightCheckPassed,
+		"hub CRDs are installed")
+}
+
+// returns the sorted list of hub resources not found, as resource.group
+func findMissingHubResources(dc discovery.DiscoveryInterface, resources map[string][]string) []string {
+	missing := []string{}
+	for groupVersion, names := range resources {
+		gv, err := schema.ParseGroupVersion(groupVersion)
+		if err != nil {
+			continue
+		}
+		missingNames, err := findMissingResources(dc, groupVersion, names)
+		if err != nil {
+			missingNames = names
+		}
+		for _, name := range missingNames {
+			missing = append(missing, name+"."+gv.Group)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// checks the operator is allowed to manage the velero resources in the namespace
+func checkPermissions(
+	ctx context.Context,
+	c client.Client,
+	namespace string,
+	permissions []accessRequirement,
+) v1beta1.PreflightCheck {
+	denied := []string{}
+	for _, permission := range permissions {
+		allowed, err := reviewAccess(ctx, c, namespace, permission)
+		if err != nil {
+			return newPreflightCheck(preflightPermissions, v1beta1.PreflightCheckWarning,
+				"unable to review the operator permissions: %v", err)
+		}
+		if !allowed {
+			denied = append(denied, permission.verb+" "+permission.resource+"."+permission.group)
+		}
+	}
+	if len(denied) > 0 {
+		return newPreflightCheck(preflightPermissions, v1beta1.PreflightCheckFailed,
+			"operator not allowed to %s in namespace %s", strings.Join(denied, ", "), namespace)
+	}
+	return newPreflightCheck(preflightPermissions, v1beta1.PreflightCheckPassed,
+		"operator permissions verified")
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newPreflightDiscovery(resources map[string][]string) *fakediscovery.FakeDiscovery {
+	fakeDiscovery := fakeclientset.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+	for groupVersion, names := range resources {
+		resourceList := &metav1.APIResourceList{GroupVersion: groupVersion}
+		for _, name := range names {
+			resourceList.APIResources = append(resourceList.APIResources, metav1.APIResource{Name: name})
+		}
+		fakeDiscovery.Resources = append(fakeDiscovery.Resources, resourceList)
+	}
+	return fakeDiscovery
+}
+
+func Test_runPreflightChecks(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(testScheme)
+	_ = veleroapi.AddToScheme(testScheme)
+
+	available := newStorageLocation("default", true, veleroapi.BackupStorageLocationPhaseAvailable)
+	available.Spec.Credential = &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "cloud-credentials"},
+		Key:                  "cloud",
+	}
+	notOwned := newStorageLocation("default", false, veleroapi.BackupStorageLocationPhaseAvailable)
+	unavailable := newStorageLocation("dr", false, veleroapi.BackupStorageLocationPhaseUnavailable)
+	unavailable.Spec.Provider = "aws"
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cloud-credentials", Namespace: "velero"},
+		Data:       map[string][]byte{"cloud": []byte("secret")},
+	}
+	readyDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: veleroDeploymentName, Namespace: "velero"},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+	}
+	notReadyDeployment := readyDeployment.DeepCopy()
+	notReadyDeployment.Status.ReadyReplicas = 0
+
+	allResources := map[string][]string{
+		"velero.io/v1":                          veleroRequiredResources,
+		"apps.open-cluster-management.io/v1":    {"channels"},
+		"cluster.open-cluster-management.io/v1": {"managedclusters"},
+		"hive.openshift.io/v1":                  {"clusterdeployments", "clusterpools"},
+	}
+	noHiveResources := map[string][]string{
+		"velero.io/v1":                          veleroRequiredResources,
+		"apps.open-cluster-management.io/v1":    {"channels"},
+		"cluster.open-cluster-management.io/v1": {"managedclusters"},
+	}
+
+	defer func(f func(context.Context, client.Client, string, accessRequirement) (bool, error)) {
+		reviewAccess = f
+	}(reviewAccess)
+
+	tests := []struct {
+		name            string
+		resources       map[string][]string
+		objects         []client.Object
+		storageLocation string
+		denied          string
+		want            map[string]v1beta1.PreflightCheckStatus
+		wantFailed      int
+	}{
+		{
+			name:      "all checks pass",
+			resources: allResources,
+			objects:   []client.Object{&available, credentials, readyDeployment},
+			want: map[string]v1beta1.PreflightCheckStatus{
+				preflightVeleroCRDs:         v1beta1.PreflightCheckPassed,
+				preflightVeleroDeployment:   v1beta1.PreflightCheckPassed,
+				preflightStorageCredentials: v1beta1.PreflightCheckPassed,
+				preflightHubCRDs:            v1beta1.PreflightCheckPassed,
+				preflightPermissions:        v1beta1.PreflightCheckPassed,
+			},
+		},
+		{
+			name:      "velero not installed, hive not installed",
+			resources: map[string][]string{"cluster.open-cluster-management.io/v1": {"managedclusters"}},
+			want: map[string]v1beta1.PreflightCheckStatus{
+				preflightVeleroCRDs:         v1beta1.PreflightCheckFailed,
+				preflightVeleroDeployment:   v1beta1.PreflightCheckFailed,
+				preflightStorageCredentials: v1beta1.PreflightCheckFailed,
+				preflightHubCRDs:            v1beta1.PreflightCheckFailed,
+				preflightPermissions:        v1beta1.PreflightCheckPassed,
+			},
+			wantFailed: 4,
+		},
+		{
+			name:      "velero not ready, missing credentials secret, hive not installed",
+			resources: noHiveResources,
+			objects:   []client.Object{&available, notReadyDeployment},
+			want: map[string]v1beta1.PreflightCheckStatus{
+				preflightVeleroCRDs:         v1beta1.PreflightCheckPassed,
+				preflightVeleroDeployment:   v1beta1.PreflightCheckFailed,
+				preflightStorageCredentials: v1beta1.PreflightCheckFailed,
+				preflightHubCRDs:            v1beta1.PreflightCheckWarning,
+				preflightPermissions:        v1beta1.PreflightCheckPassed,
+			},
+			wantFailed: 2,
+		},
+		{
+			name:      "storage location without owner",
+			resources: allResources,
+			objects:   []client.Object{&notOwned, readyDeployment},
+			want: map[string]v1beta1.PreflightCheckStatus{
+				preflightVeleroCRDs:         v1beta1.PreflightCheckPassed,
+				preflightVeleroDeployment:   v1beta1.PreflightCheckPassed,
+				preflightStorageCredentials: v1beta1.PreflightCheckFailed,
+				preflightHubCRDs:            v1beta1.PreflightCheckPassed,
+				preflightPermissions:        v1beta1.PreflightCheckPassed,
+			},
+			wantFailed: 1,
+		},
+		{
+			name:            "selected location unavailable, permission denied",
+			resources:       allResources,
+			objects:         []client.Object{&available, &unavailable, credentials, readyDeployment},
+			storageLocation: "dr",
+			denied:          "schedules",
+			want: map[string]v1beta1.PreflightCheckStatus{
+				preflightVeleroCRDs:         v1beta1.PreflightCheckPassed,
+				preflightVeleroDeployment:   v1beta1.PreflightCheckPassed,
+				preflightStorageCredentials: v1beta1.PreflightCheckFailed,
+				preflightHubCRDs:            v1beta1.PreflightCheckPassed,
+				preflightPermissions:        v1beta1.PreflightCheckFailed,
+			},
+			wantFailed: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reviewAccess = func(_ context.Context, _ client.Client, _ string, req accessRequirement) (bool, error) {
+				return req.resource != tt.denied, nil
+			}
+			c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(tt.objects...).Build()
+			checks := runPreflightChecks(
+				context.Background(),
+				c,
+				newPreflightDiscovery(tt.resources),
+				"velero",
+				tt.storageLocation,
+				schedulePermissions,
+			)
+			got := make(map[string]v1beta1.PreflightCheckStatus, len(checks))
+			for _, check := range checks {
+				got[check.Name] = check.Status
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("runPreflightChecks() = %v, want %v", checks, tt.want)
+			}
+			if failed := getFailedPreflightChecks(checks); len(failed) != tt.wantFailed {
+				t.Errorf("getFailedPreflightChecks() = %v, want %d failures", failed, tt.wantFailed)
+			}
+		})
+	}
+}
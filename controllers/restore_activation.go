@@ -0,0 +1,265 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	clusterv1 "github.com/open-cluster-management/api/cluster/v1"
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	ocinfrav1 "github.com/openshift/api/config/v1"
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/label"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// interval used to check the connection of the restored managed clusters
+	activationCheckInterval = 1 * time.Minute
+	// restored managed clusters not connected after this period are reported as failed,
+	// unless the restore sets managedClusterActivationTimeout
+	defaultActivationTimeout = 1 * time.Hour
+	// name of the OpenShift infrastructure resource holding the hub API server URL
+	infrastructureName = "cluster"
+	// secret holding the managed cluster credentials used by the import controller to import the cluster
+	autoImportSecretName = "auto-import-secret"
+)
+
+// returns the public API server URL of the hub, read from the OpenShift infrastructure resource
+// unless PublicAPIServerURL is set; PublicAPIServerURL is never updated by the controllers
+func getPublicAPIServerURL(ctx context.Context, c client.Client) (string, error) {
+	if PublicAPIServerURL != "" {
+		return PublicAPIServerURL, nil
+	}
+	infra := &ocinfrav1.Infrastructure{}
+	if err := c.Get(ctx, types.NamespacedName{Name: infrastructureName}, infra); err != nil {
+		return "", fmt.Errorf("unable to get the hub API server URL: %v", err)
+	}
+	if infra.Status.APIServerURL == "" {
+		return "", fmt.Errorf("the hub API server URL is not set on infrastructure %s", infrastructureName)
+	}
+	return infra.Status.APIServerURL, nil
+}
+
+// returns the time the restored managed clusters have to connect to the hub
+func getActivationTimeout(restore *v1beta1.Restore) time.Duration {
+	if restore.Spec.ManagedClusterActivationTimeout == nil {
+		return defaultActivationTimeout
+	}
+	return restore.Spec.ManagedClusterActivationTimeout.Duration
+}
+
+// returns true if the managed cluster is connected to the hub
+func isManagedClusterAvailable(managedCluster *clusterv1.ManagedCluster) bool {
+	return apimeta.IsStatusConditionTrue(
+		managedCluster.Status.Conditions,
+		clusterv1.ManagedClusterConditionAvailable,
+	)
+}
+
+// returns the name of the secret holding the import manifests of a managed cluster
+func getImportSecretName(clusterName string) string {
+	return clusterName + "-import"
+}
+
+// removes the restored import secret of an imported managed cluster, so that the import controller
+// generates it for this hub
+func (r *RestoreReconciler) regenerateImportSecret(ctx context.Context, clusterName string) error {
+	err := r.KubeClient.CoreV1().Secrets(clusterName).Delete(
+		ctx,
+		getImportSecretName(clusterName),
+		metav1.DeleteOptions{},
+	)
+	if err != nil && !k8serr.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// returns true if the managed cluster namespace has an auto-import-secret, used by the import controller
+// to import the managed cluster with the regenerated import secret
+func (r *RestoreReconciler) hasAutoImportSecret(ctx context.Context, clusterName string) (bool, error) {
+	_, err := r.KubeClient.CoreV1().Secrets(clusterName).Get(ctx, autoImportSecretName, metav1.GetOptions{})
+	if k8serr.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// returns the activation status of the managed cluster recorded in the restore status
+func findManagedClusterActivation(restore *v1beta1.Restore, name string) v1beta1.ManagedClusterActivation {
+	for _, activation := range restore.Status.ManagedClusterActivations {
+		if activation.Name == name {
+			return activation
+		}
+	}
+	return v1beta1.ManagedClusterActivation{Name: name}
+}
+
+// returns the completed velero restore of the managed clusters backup, if any
+func getManagedClustersVeleroRestore(veleroRestoreList *veleroapi.RestoreList) *veleroapi.Restore {
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		if !strings.HasPrefix(veleroRestore.Spec.BackupName, veleroScheduleNames[ManagedClusters]+"-") {
+			continue
+		}
+		if veleroRestore.Status.Phase == veleroapi.RestorePhaseCompleted ||
+			veleroRestore.Status.Phase == veleroapi.RestorePhasePartiallyFailed {
+			return veleroRestore
+		}
+	}
+	return nil
+}
+
+// reconnect the managed clusters restored by the managed clusters velero restore to this hub
+// and report their status; returns true while some managed clusters are not connected
+func (r *RestoreReconciler) activateManagedClusters(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+) (bool, error) {
+	restoreLogger := log.FromContext(ctx)
+
+	veleroRestore := getManagedClustersVeleroRestore(veleroRestoreList)
+	if veleroRestore == nil {
+		return false, nil
+	}
+	if r.KubeClient == nil {
+		restoreLogger.Info("no kube client, skipping the activation of the restored managed clusters")
+		return false, nil
+	}
+
+	apiServerURL, err := getPublicAPIServerURL(ctx, r.Client)
+	if err != nil {
+		return false, err
+	}
+	restore.Status.HubAPIServerURL = apiServerURL
+
+	managedClusters := &clusterv1.ManagedClusterList{}
+	if err := r.List(
+		ctx,
+		managedClusters,
+		client.MatchingLabels{veleroapi.RestoreNameLabel: label.GetValidName(veleroRestore.Name)},
+	); err != nil {
+		return false, err
+	}
+
+	activationTimeout := getActivationTimeout(restore)
+	timedOut := veleroRestore.Status.CompletionTimestamp != nil &&
+		time.Since(veleroRestore.Status.CompletionTimestamp.Time) > activationTimeout
+
+	pending := false
+	activations := []v1beta1.ManagedClusterActivation{}
+	for i := range managedClusters.Items {
+		managedCluster := &managedClusters.Items[i]
+		if managedCluster.Name == "local-cluster" {
+			continue
+		}
+		activation := findManagedClusterActivation(restore, managedCluster.Name)
+
+		switch {
+		case isManagedClusterAvailable(managedCluster):
+			activation.Phase = v1beta1.ManagedClusterActivationAvailable
+			activation.Message = "Managed cluster is connected to the hub"
+		case activation.Phase == v1beta1.ManagedClusterActivationFailed:
+			// keep reporting the failure
+		default:
+			if err := r.activateManagedCluster(ctx, restore, &activation); err != nil {
+				return false, err
+			}
+			if timedOut {
+				activation.Phase = v1beta1.ManagedClusterActivationFailed
+				activation.Message = fmt.Sprintf(
+					"Managed cluster did not connect to the hub %s after the restore. %s",
+					activationTimeout,
+					activation.Message,
+				)
+			} else {
+				activation.Phase = v1beta1.ManagedClusterActivationPending
+				pending = true
+			}
+		}
+		activations = append(activations, activation)
+	}
+	restore.Status.ManagedClusterActivations = activations
+	return pending, nil
+}
+
+// run the activation step of a managed cluster not connected to the hub
+func (r *RestoreReconciler) activateManagedCluster(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	activation *v1beta1.ManagedClusterActivation,
+) error {
+	clusterDeployment := &hivev1.ClusterDeployment{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: activation.Name, Name: activation.Name}, clusterDeployment)
+	if err == nil {
+		activation.HiveProvisioned = true
+		activation.Message = "Waiting for hive to reconnect the managed cluster"
+		return nil
+	}
+	if !k8serr.IsNotFound(err) && !apimeta.IsNoMatchError(err) {
+		return err
+	}
+
+	if !activation.ImportSecretRegenerated {
+		if err := r.regenerateImportSecret(ctx, activation.Name); err != nil {
+			return err
+		}
+		activation.ImportSecretRegenerated = true
+		r.Recorder.Event(
+			restore,
+			corev1.EventTypeNormal,
+			"Managed cluster import secret regenerated:",
+			activation.Name,
+		)
+	}
+
+	autoImport, err := r.hasAutoImportSecret(ctx, activation.Name)
+	if err != nil {
+		return err
+	}
+	if autoImport {
+		activation.Message = fmt.Sprintf(
+			"Import secret regenerated, waiting for the import controller to import the managed cluster "+
+				"using secret %s/%s",
+			activation.Name,
+			autoImportSecretName,
+		)
+		return nil
+	}
+	activation.Message = fmt.Sprintf(
+		"Import secret regenerated, import the managed cluster manually: apply the crds.yaml and import.yaml "+
+			"manifests from secret %s/%s on the managed cluster, or create secret %s/%s "+
+			"with the managed cluster kubeconfig",
+		activation.Name,
+		getImportSecretName(activation.Name),
+		activation.Name,
+		autoImportSecretName,
+	)
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	clusterv1 "github.com/open-cluster-management/api/cluster/v1"
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	ocinfrav1 "github.com/openshift/api/config/v1"
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newImportSecrets(clusterName string, autoImport bool) []runtime.Object {
+	objs := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: getImportSecretName(clusterName), Namespace: clusterName},
+		},
+	}
+	if autoImport {
+		objs = append(objs, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: autoImportSecretName, Namespace: clusterName},
+		})
+	}
+	return objs
+}
+
+func Test_regenerateImportSecret(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset(newImportSecrets("cluster1", false)...)
+	r := &RestoreReconciler{KubeClient: kubeClient}
+
+	if err := r.regenerateImportSecret(context.Background(), "cluster2"); err != nil {
+		t.Errorf("regenerateImportSecret() error = %v", err)
+	}
+	if err := r.regenerateImportSecret(context.Background(), "cluster1"); err != nil {
+		t.Fatalf("regenerateImportSecret() error = %v", err)
+	}
+	secrets, err := kubeClient.CoreV1().Secrets("cluster1").List(context.Background(), metav1.ListOptions{})
+	if err != nil || len(secrets.Items) != 0 {
+		t.Errorf("regenerateImportSecret() secrets = %v, %v, want the import secret removed", secrets, err)
+	}
+}
+
+func Test_activateManagedClusters(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(testScheme)
+	_ = clusterv1.AddToScheme(testScheme)
+	_ = hivev1.AddToScheme(testScheme)
+	_ = ocinfrav1.AddToScheme(testScheme)
+
+	veleroRestoreName := "restore-acm-managed-clusters-schedule-20210910181336"
+	newManagedCluster := func(name string, restored bool) *clusterv1.ManagedCluster {
+		managedCluster := &clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if restored {
+			managedCluster.Labels = map[string]string{veleroapi.RestoreNameLabel: veleroRestoreName}
+		}
+		return managedCluster
+	}
+	available := newManagedCluster("available", true)
+	available.Status.Conditions = []metav1.Condition{{
+		Type:   clusterv1.ManagedClusterConditionAvailable,
+		Status: metav1.ConditionTrue,
+	}}
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		&ocinfrav1.Infrastructure{
+			ObjectMeta: metav1.ObjectMeta{Name: infrastructureName},
+			Status:     ocinfrav1.InfrastructureStatus{APIServerURL: "https://api.hub:6443"},
+		},
+		available,
+		newManagedCluster("local-cluster", false),
+		newManagedCluster("hive", true),
+		&hivev1.ClusterDeployment{ObjectMeta: metav1.ObjectMeta{Name: "hive", Namespace: "hive"}},
+		newManagedCluster("imported", true),
+		newManagedCluster("auto-imported", true),
+		newManagedCluster("not-restored", false),
+	).Build()
+
+	kubeClient := kubefake.NewSimpleClientset(
+		append(newImportSecrets("imported", false), newImportSecrets("auto-imported", true)...)...,
+	)
+	r := &RestoreReconciler{
+		Client:     c,
+		KubeClient: kubeClient,
+		Recorder:   record.NewFakeRecorder(10),
+	}
+	PublicAPIServerURL = ""
+
+	restore := &v1beta1.Restore{}
+	veleroRestoreList := &veleroapi.RestoreList{Items: []veleroapi.Restore{{
+		ObjectMeta: metav1.ObjectMeta{Name: veleroRestoreName},
+		Spec:       veleroapi.RestoreSpec{BackupName: "acm-managed-clusters-schedule-20210910181336"},
+		Status:     veleroapi.RestoreStatus{Phase: veleroapi.RestorePhaseCompleted},
+	}}}
+
+	pending, err := r.activateManagedClusters(context.Background(), restore, veleroRestoreList)
+	if err != nil {
+		t.Fatalf("activateManagedClusters() error = %v", err)
+	}
+	if !pending {
+		t.Errorf("activateManagedClusters() pending = false, want true")
+	}
+	if restore.Status.HubAPIServerURL != "https://api.hub:6443" {
+		t.Errorf("HubAPIServerURL = %v", restore.Status.HubAPIServerURL)
+	}
+
+	want := map[string]v1beta1.ManagedClusterActivation{
+		"available": {Name: "available", Phase: v1beta1.ManagedClusterActivationAvailable},
+		"hive":      {Name: "hive", HiveProvisioned: true, Phase: v1beta1.ManagedClusterActivationPending},
+		"imported": {
+			Name:                    "imported",
+			ImportSecretRegenerated: true,
+			Phase:                   v1beta1.ManagedClusterActivationPending,
+		},
+		"auto-imported": {
+			Name:                    "auto-imported",
+			ImportSecretRegenerated: true,
+			Phase:                   v1beta1.ManagedClusterActivationPending,
+		},
+	}
+	if len(restore.Status.ManagedClusterActivations) != len(want) {
+		t.Fatalf("ManagedClusterActivations = %v", restore.Status.ManagedClusterActivations)
+	}
+	for _, activation := range restore.Status.ManagedClusterActivations {
+		if activation.Name == "imported" && !strings.Contains(activation.Message, "manually") ||
+			activation.Name == "auto-imported" && !strings.Contains(activation.Message, autoImportSecretName) {
+			t.Errorf("activation %s message = %v", activation.Name, activation.Message)
+		}
+		activation.Message = ""
+		if activation != want[activation.Name] {
+			t.Errorf("activation = %v, want %v", activation, want[activation.Name])
+		}
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// hub resources with this label are never removed by the restore cleanup
+	skipRestoreCleanupLabel = "cluster.open-cluster-management.io/skip-restore-cleanup"
+	// maximum number of resources listed in the restore cleanup preview
+	maxCleanupPreview = 100
+)
+
+// hive kinds owning the cloud infrastructure of the managed clusters; hive deprovisions the cluster
+// or its machines when they are deleted, so the restore cleanup never removes them
+var cleanupExcludedHiveKinds = []string{
+	"ClusterDeployment",
+	"ClusterDeprovision",
+	"ClusterPool",
+	"ClusterClaim",
+	"ClusterProvision",
+	"DNSZone",
+	"MachinePool",
+}
+
+// returns true if the restore cleanup must never remove resources of this kind
+func isCleanupExcludedKind(gvk schema.GroupVersionKind) bool {
+	return gvk.Group == "hive.openshift.io" && findValue(cleanupExcludedHiveKinds, gvk.Kind)
+}
+
+// returns the kinds of the resources saved by the resources backup from the restored api groups,
+// using the preferred version of each api group; the operator has no access to the other kinds
+func getResourcesToBackupKinds(
+	ctx context.Context,
+	dc discovery.DiscoveryInterface,
+) ([]schema.GroupVersionKind, error) {
+	backupLogger := log.FromContext(ctx)
+
+	resourcesToBackup, err := getResourcesToBackup(ctx, dc)
+	if err != nil {
+		return nil, err
+	}
+
+	groupList, err := dc.ServerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server groups: %v", err)
+	}
+
+	kinds := []schema.GroupVersionKind{}
+	for _, group := range groupList.Groups {
+		if !isRestoredAPIGroup(group.Name) {
+			continue
+		}
+		resourceList, err := dc.ServerResourcesForGroupVersion(group.PreferredVersion.GroupVersion)
+		if err != nil {
+			backupLogger.Error(err, "failed to get server resources")
+			continue
+		}
+		for _, resource := range resourceList.APIResources {
+			if strings.Contains(resource.Name, "/") {
+				// ignore subresources
+				continue
+			}
+			if !findValue(resourcesToBackup, strings.ToLower(resource.Kind)+"."+group.Name) {
+				continue
+			}
+			kinds = append(kinds, schema.GroupVersionKind{
+				Group:   group.Name,
+				Version: group.PreferredVersion.Version,
+				Kind:    resource.Kind,
+			})
+		}
+	}
+	return kinds, nil
+}
+
+// returns true if the velero backup collects resources from this namespace
+func isNamespaceBackedUp(backup *veleroapi.Backup, namespace string) bool {
+	if namespace == "" {
+		return backup.Spec.IncludeClusterResources == nil || *backup.Spec.IncludeClusterResources
+	}
+	if isRestoreTestNamespace(namespace) || findValue(backup.Spec.ExcludedNamespaces, namespace) {
+		return false
+	}
+	return len(backup.Spec.IncludedNamespaces) == 0 ||
+		findValue(backup.Spec.IncludedNamespaces, "*") ||
+		findValue(backup.Spec.IncludedNamespaces, namespace)
+}
+
+// returns the hub resources which could have been saved by the velero backup but are not in the backed up resources;
+// resources outside the restored api groups, of the hive infrastructure kinds, with the skip label,
+// owned by other resources or being deleted are ignored
+func getResourcesToCleanup(
+	hubResources []unstructured.Unstructured,
+	backedUpResources []backedUpResource,
+	backup *veleroapi.Backup,
+) []backedUpResource {
+	// the version is ignored, resources may be backed up using another api version
+	backedUp := make(map[backedUpResource]bool, len(backedUpResources))
+	for _, res := range backedUpResources {
+		res.gvk.Version = ""
+		backedUp[res] = true
+	}
+
+	toCleanup := []backedUpResource{}
+	for i := range hubResources {
+		obj := &hubResources[i]
+		if _, ok := obj.GetLabels()[skipRestoreCleanupLabel]; ok ||
+			!isRestoredAPIGroup(obj.GroupVersionKind().Group) ||
+			isCleanupExcludedKind(obj.GroupVersionKind()) ||
+			len(obj.GetOwnerReferences()) > 0 ||
+			obj.GetDeletionTimestamp() != nil ||
+			!isNamespaceBackedUp(backup, obj.GetNamespace()) {
+			continue
+		}
+		res := backedUpResource{
+			gvk:       obj.GroupVersionKind(),
+			namespace: obj.GetNamespace(),
+			name:      obj.GetName(),
+		}
+		key := res
+		key.gvk.Version = ""
+		if !backedUp[key] {
+			toCleanup = append(toCleanup, res)
+		}
+	}
+	return toCleanup
+}
+
+// find the hub resources not saved by the restored resources backup
+// and remove them if the restore cleanup type is Delete
+func (r *RestoreReconciler) cleanupBeforeRestore(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	veleroRestores map[ResourceType]*veleroapi.Restore,
+	backedUpResources map[ResourceType][]backedUpResource,
+) error {
+	if restore.Spec.CleanupBeforeRestore == "" ||
+		restore.Spec.CleanupBeforeRestore == v1beta1.CleanupTypeNone {
+		return nil
+	}
+	restoreLogger := log.FromContext(ctx)
+
+	restore.Status.CleanupPreview = nil
+	resourcesRestore, ok := veleroRestores[Resources]
+	if !ok {
+		// resources are not restored, keep the hub resources
+		return nil
+	}
+	if r.DiscoveryClient == nil {
+		return fmt.Errorf("unable to find the resources to clean up, no discovery client")
+	}
+
+	kinds, err := getResourcesToBackupKinds(ctx, r.DiscoveryClient)
+	if err != nil {
+		return err
+	}
+
+	backup := &veleroapi.Backup{}
+	if err := r.Get(
+		ctx,
+		types.NamespacedName{Namespace: restore.Namespace, Name: resourcesRestore.Spec.BackupName},
+		backup,
+	); err != nil {
+		return err
+	}
+
+	// resources saved by any of the restored backups are kept
+	allBackedUp := []backedUpResource{}
+	for key := range backedUpResources {
+		allBackedUp = append(allBackedUp, backedUpResources[key]...)
+	}
+
+	toCleanup := []backedUpResource{}
+	for _, gvk := range kinds {
+		hubResources := &unstructured.UnstructuredList{}
+		hubResources.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := r.List(ctx, hubResources); err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return err
+		}
+		toCleanup = append(toCleanup, getResourcesToCleanup(hubResources.Items, allBackedUp, backup)...)
+	}
+
+	for _, res := range toCleanup {
+		if len(restore.Status.CleanupPreview) == maxCleanupPreview {
+			restore.Status.CleanupPreview = append(
+				restore.Status.CleanupPreview,
+				fmt.Sprintf("... and %d more", len(toCleanup)-maxCleanupPreview),
+			)
+			break
+		}
+		restore.Status.CleanupPreview = append(restore.Status.CleanupPreview, res.String())
+	}
+
+	if restore.Spec.CleanupBeforeRestore != v1beta1.CleanupTypeDelete || len(toCleanup) == 0 {
+		return nil
+	}
+
+	for _, res := range toCleanup {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(res.gvk)
+		obj.SetNamespace(res.namespace)
+		obj.SetName(res.name)
+		if err := r.Delete(ctx, obj); err != nil && !k8serr.IsNotFound(err) {
+			return fmt.Errorf("unable to remove %s: %v", res, err)
+		}
+	}
+	restoreLogger.Info(
+		"removed hub resources not in the restored backup",
+		"backup", resourcesRestore.Spec.BackupName,
+		"count", len(toCleanup),
+	)
+	r.Recorder.Event(
+		restore,
+		v1.EventTypeNormal,
+		"Hub resources removed before restore:",
+		fmt.Sprintf("%d resources not in backup %s", len(toCleanup), resourcesRestore.Spec.BackupName),
+	)
+	return nil
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_isNamespaceBackedUp(t *testing.T) {
+	includeClusterResources := false
+	tests := []struct {
+		name      string
+		spec      veleroapi.BackupSpec
+		namespace string
+		want      bool
+	}{
+		{
+			name:      "all namespaces",
+			spec:      veleroapi.BackupSpec{},
+			namespace: "ns1",
+			want:      true,
+		},
+		{
+			name:      "excluded namespace",
+			spec:      veleroapi.BackupSpec{ExcludedNamespaces: []string{"local-cluster"}},
+			namespace: "local-cluster",
+			want:      false,
+		},
+		{
+			name:      "sandbox namespace of the test restores",
+			spec:      veleroapi.BackupSpec{ExcludedNamespaces: []string{restoreTestNamespacePattern}},
+			namespace: "acm-restore-test-ns1",
+			want:      false,
+		},
+		{
+			name:      "not included namespace",
+			spec:      veleroapi.BackupSpec{IncludedNamespaces: []string{"ns2"}},
+			namespace: "ns1",
+			want:      false,
+		},
+		{
+			name:      "cluster scoped resources",
+			spec:      veleroapi.BackupSpec{},
+			namespace: "",
+			want:      true,
+		},
+		{
+			name:      "cluster scoped resources not backed up",
+			spec:      veleroapi.BackupSpec{IncludeClusterResources: &includeClusterResources},
+			namespace: "",
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backup := &veleroapi.Backup{Spec: tt.spec}
+			if got := isNamespaceBackedUp(backup, tt.namespace); got != tt.want {
+				t.Errorf("isNamespaceBackedUp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getResourcesToCleanup(t *testing.T) {
+	channelGVK := schema.GroupVersionKind{
+		Group:   "apps.open-cluster-management.io",
+		Version: "v1",
+		Kind:    "Channel",
+	}
+	newChannel := func(namespace, name string) unstructured.Unstructured {
+		obj := unstructured.Unstructured{}
+		obj.SetGroupVersionKind(channelGVK)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+
+	inBackup := newChannel("ns1", "in-backup")
+	notInBackup := newChannel("ns1", "not-in-backup")
+	skipped := newChannel("ns1", "skipped")
+	skipped.SetLabels(map[string]string{skipRestoreCleanupLabel: "true"})
+	owned := newChannel("ns1", "owned")
+	owned.SetOwnerReferences([]metav1.OwnerReference{{Name: "owner"}})
+	deleted := newChannel("ns1", "deleted")
+	now := metav1.Now()
+	deleted.SetDeletionTimestamp(&now)
+	excluded := newChannel("local-cluster", "excluded")
+	notRestored := unstructured.Unstructured{}
+	notRestored.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "work.open-cluster-management.io",
+		Version: "v1",
+		Kind:    "ManifestWork",
+	})
+	notRestored.SetNamespace("ns1")
+	notRestored.SetName("not-restored")
+	clusterDeployment := unstructured.Unstructured{}
+	clusterDeployment.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "hive.openshift.io",
+		Version: "v1",
+		Kind:    "ClusterDeployment",
+	})
+	clusterDeployment.SetNamespace("ns1")
+	clusterDeployment.SetName("cluster1")
+
+	backedUp := []backedUpResource{
+		{
+			gvk:       schema.GroupVersionKind{Group: channelGVK.Group, Version: "v1beta1", Kind: "Channel"},
+			namespace: "ns1",
+			name:      "in-backup",
+		},
+	}
+	backup := &veleroapi.Backup{
+		Spec: veleroapi.BackupSpec{ExcludedNamespaces: []string{"local-cluster"}},
+	}
+
+	got := getResourcesToCleanup(
+		[]unstructured.Unstructured{
+			inBackup, notInBackup, skipped, owned, deleted, excluded, notRestored, clusterDeployment,
+		},
+		backedUp,
+		backup,
+	)
+	want := []backedUpResource{{gvk: channelGVK, namespace: "ns1", name: "not-in-backup"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getResourcesToCleanup() = %v, want %v", got, want)
+	}
+}
+
+func Test_cleanupBeforeRestore(t *testing.T) {
+	channelGVK := schema.GroupVersionKind{Group: "apps.open-cluster-management.io", Version: "v1", Kind: "Channel"}
+	// an ACM api group without RBAC rule for the restore
+	proxyGVK := schema.GroupVersionKind{
+		Group:   "proxy.open-cluster-management.io",
+		Version: "v1alpha1",
+		Kind:    "ManagedProxyConfiguration",
+	}
+
+	testScheme := runtime.NewScheme()
+	_ = veleroapi.AddToScheme(testScheme)
+	for _, gvk := range []schema.GroupVersionKind{channelGVK, proxyGVK} {
+		testScheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		testScheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+	}
+	newHubResource := func(gvk schema.GroupVersionKind, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetNamespace("ns1")
+		obj.SetName(name)
+		return obj
+	}
+	backupName := veleroScheduleNames[Resources] + "-20210910181336"
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		&veleroapi.Backup{ObjectMeta: metav1.ObjectMeta{Name: backupName, Namespace: "velero-ns"}},
+		newHubResource(channelGVK, "channel"),
+		newHubResource(proxyGVK, "proxy"),
+	).Build()
+
+	fakeDiscovery := fakeclientset.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+	for _, gvk := range []schema.GroupVersionKind{channelGVK, proxyGVK} {
+		fakeDiscovery.Resources = append(fakeDiscovery.Resources, &metav1.APIResourceList{
+			GroupVersion: gvk.GroupVersion().String(),
+			APIResources: []metav1.APIResource{{Name: strings.ToLower(gvk.Kind) + "s", Kind: gvk.Kind, Namespaced: true}},
+		})
+	}
+	r := &RestoreReconciler{Client: c, DiscoveryClient: fakeDiscovery, Recorder: record.NewFakeRecorder(10)}
+
+	restore := &v1beta1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "velero-ns"},
+		Spec:       v1beta1.RestoreSpec{CleanupBeforeRestore: v1beta1.CleanupTypeDelete},
+	}
+	veleroRestores := map[ResourceType]*veleroapi.Restore{
+		Resources: {Spec: veleroapi.RestoreSpec{BackupName: backupName}},
+	}
+	if err := r.cleanupBeforeRestore(
+		context.Background(),
+		restore,
+		veleroRestores,
+		map[ResourceType][]backedUpResource{},
+	); err != nil {
+		t.Fatalf("cleanupBeforeRestore() error = %v", err)
+	}
+
+	// the channel is removed, the resource outside the restored api groups is never removed
+	for name, gvk := range map[string]schema.GroupVersionKind{"channel": channelGVK, "proxy": proxyGVK} {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		err := c.Get(context.Background(), types.NamespacedName{Namespace: "ns1", Name: name}, obj)
+		if wantDeleted := gvk == channelGVK; wantDeleted != k8serr.IsNotFound(err) {
+			t.Errorf("%s want deleted %v, error = %v", gvk.Kind, wantDeleted, err)
+		}
+	}
+	if len(restore.Status.CleanupPreview) != 1 {
+		t.Errorf("cleanupBeforeRestore() preview = %v", restore.Status.CleanupPreview)
+	}
+}
@@ -0,0 +1,345 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// maximum number of conflicting resources listed in the restore status
+const maxConflictingResources = 100
+
+// errConflictingResources is returned when backed up resources exist on the hub and the conflict policy is fail
+var errConflictingResources = errors.New("backed up resources already exist on the hub")
+
+// backedUpResource identifies a resource saved by a velero backup
+type backedUpResource struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+	name      string
+}
+
+func (res backedUpResource) String() string {
+	if res.namespace == "" {
+		return fmt.Sprintf("%s %s", res.gvk.Kind, res.name)
+	}
+	return fmt.Sprintf("%s %s/%s", res.gvk.Kind, res.namespace, res.name)
+}
+
+// parseBackupResourceList returns the resources from a velero backup resource list,
+// which maps each group/version/kind to the namespace/name of the backed up items
+func parseBackupResourceList(resourceList map[string][]string) []backedUpResource {
+	resources := []backedUpResource{}
+
+	keys := make([]string, 0, len(resourceList))
+	for key := range resourceList {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		separator := strings.LastIndex(key, "/")
+		if separator == -1 {
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(key[:separator])
+		if err != nil {
+			continue
+		}
+		gvk := gv.WithKind(key[separator+1:])
+
+		for _, item := range resourceList[key] {
+			res := backedUpResource{gvk: gvk, name: item}
+			if separator := strings.Index(item, "/"); separator != -1 {
+				res.namespace = item[:separator]
+				res.name = item[separator+1:]
+			}
+			resources = append(resources, res)
+		}
+	}
+	return resources
+}
+
+// returns true for the kinds of resources backed up by the operator which the restore can overwrite:
+// secrets and resources from the restored api groups
+func isManagedResourceKind(gvk schema.GroupVersionKind) bool {
+	if gvk.Group == "" {
+		return findValue(backupCredsResources, strings.ToLower(gvk.Kind))
+	}
+	return isRestoredAPIGroup(gvk.Group)
+}
+
+// returns the managed resources from this list that already exist on the hub
+func getExistingResources(
+	ctx context.Context,
+	c client.Client,
+	resources []backedUpResource,
+) ([]backedUpResource, error) {
+	existing := []backedUpResource{}
+
+	for _, res := range resources {
+		if !isManagedResourceKind(res.gvk) {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(res.gvk)
+		err := c.Get(ctx, types.NamespacedName{Namespace: res.namespace, Name: res.name}, obj)
+		if err == nil {
+			existing = append(existing, res)
+			continue
+		}
+		if !k8serr.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return nil, err
+		}
+	}
+	return existing, nil
+}
+
+// readBackupContents returns a function reading the velero backup tarball
+// and keeping the backed up objects from the resources list
+func readBackupContents(
+	resources []backedUpResource,
+	objects map[backedUpResource]*unstructured.Unstructured,
+) func(io.Reader) error {
+	wanted := make(map[backedUpResource]bool, len(resources))
+	for _, res := range resources {
+		wanted[res] = true
+	}
+
+	return func(reader io.Reader) error {
+		tarReader := tar.NewReader(reader)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if header.Typeflag != tar.TypeReg ||
+				!strings.HasPrefix(header.Name, "resources/") ||
+				!strings.HasSuffix(header.Name, ".json") {
+				continue
+			}
+
+			obj := &unstructured.Unstructured{}
+			if err := json.NewDecoder(tarReader).Decode(&obj.Object); err != nil {
+				return fmt.Errorf("unable to decode %s: %v", header.Name, err)
+			}
+			res := backedUpResource{
+				gvk:       obj.GroupVersionKind(),
+				namespace: obj.GetNamespace(),
+				name:      obj.GetName(),
+			}
+			if wanted[res] {
+				objects[res] = obj
+			}
+		}
+	}
+}
+
+// prepareForUpdate returns the backed up object with the metadata
+// needed to update the existing hub object
+func prepareForUpdate(backedUp *unstructured.Unstructured, existing *unstructured.Unstructured) *unstructured.Unstructured {
+	obj := backedUp.DeepCopy()
+	unstructured.RemoveNestedField(obj.Object, "status")
+
+	backedUpMetadata, _ := backedUp.Object["metadata"].(map[string]interface{})
+	metadata := map[string]interface{}{}
+	for _, field := range []string{"name", "namespace", "labels", "annotations"} {
+		if value, ok := backedUpMetadata[field]; ok {
+			metadata[field] = value
+		}
+	}
+	obj.Object["metadata"] = metadata
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	obj.SetFinalizers(existing.GetFinalizers())
+	obj.SetOwnerReferences(existing.GetOwnerReferences())
+
+	return obj
+}
+
+// overwrite the existing hub resources with the version from the velero backup
+func overwriteResources(
+	ctx context.Context,
+	c client.Client,
+	namespace string,
+	backupName string,
+	resources []backedUpResource,
+) error {
+	objects := map[backedUpResource]*unstructured.Unstructured{}
+	if err := downloadVeleroFile(
+		ctx,
+		c,
+		namespace,
+		backupName,
+		veleroapi.DownloadTargetKindBackupContents,
+		readBackupContents(resources, objects),
+	); err != nil {
+		return err
+	}
+
+	for _, res := range resources {
+		backedUp, ok := objects[res]
+		if !ok {
+			continue
+		}
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(res.gvk)
+		if err := c.Get(ctx, types.NamespacedName{Namespace: res.namespace, Name: res.name}, existing); err != nil {
+			if k8serr.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if err := c.Update(ctx, prepareForUpdate(backedUp, existing)); err != nil {
+			return fmt.Errorf("unable to overwrite %s: %v", res, err)
+		}
+	}
+	return nil
+}
+
+// returns the resources saved by the backups of each velero restore
+// or errDownloadNotReady while velero hasn't provided all backup resource lists
+func getBackedUpResources(
+	ctx context.Context,
+	c client.Client,
+	namespace string,
+	veleroRestores map[ResourceType]*veleroapi.Restore,
+) (map[ResourceType][]backedUpResource, error) {
+	backedUpResources := make(map[ResourceType][]backedUpResource, len(veleroRestores))
+	waitingForBackups := false
+	for key := range veleroRestores {
+		resourceList := map[string][]string{}
+		err := downloadVeleroFile(
+			ctx,
+			c,
+			namespace,
+			veleroRestores[key].Spec.BackupName,
+			veleroapi.DownloadTargetKindBackupResourceList,
+			decodeJSON(&resourceList),
+		)
+		if errors.Is(err, errDownloadNotReady) {
+			// keep going, to request all resource lists at once
+			waitingForBackups = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		backedUpResources[key] = parseBackupResourceList(resourceList)
+	}
+	if waitingForBackups {
+		return nil, errDownloadNotReady
+	}
+	return backedUpResources, nil
+}
+
+// find the backed up resources already existing on the hub and apply the restore conflict policy
+// returns errConflictingResources if the policy doesn't allow existing resources
+func (r *RestoreReconciler) applyConflictPolicy(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	veleroRestores map[ResourceType]*veleroapi.Restore,
+	backedUpResources map[ResourceType][]backedUpResource,
+) error {
+	if restore.Spec.ConflictPolicy == "" {
+		return nil
+	}
+	restoreLogger := log.FromContext(ctx)
+
+	keys := make([]ResourceType, 0, len(veleroRestores))
+	for key := range veleroRestores {
+		keys = append(keys, key)
+	}
+	sort.Sort(SortResourceType(keys))
+
+	action := v1beta1.ConflictActionSkipped
+	switch restore.Spec.ConflictPolicy {
+	case v1beta1.ConflictPolicyUpdate:
+		action = v1beta1.ConflictActionOverwritten
+	case v1beta1.ConflictPolicyFail:
+		action = v1beta1.ConflictActionFailed
+	}
+
+	conflicts := 0
+	restore.Status.ConflictingResources = nil
+	for _, key := range keys {
+		existing, err := getExistingResources(ctx, r.Client, backedUpResources[key])
+		if err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			continue
+		}
+
+		if action == v1beta1.ConflictActionOverwritten {
+			if err := overwriteResources(
+				ctx,
+				r.Client,
+				restore.Namespace,
+				veleroRestores[key].Spec.BackupName,
+				existing,
+			); err != nil {
+				return err
+			}
+		}
+
+		restoreLogger.Info(
+			"backed up resources already exist on the hub",
+			"backup", veleroRestores[key].Spec.BackupName,
+			"count", len(existing),
+			"action", action,
+		)
+		for _, res := range existing {
+			conflicts++
+			if len(restore.Status.ConflictingResources) < maxConflictingResources {
+				restore.Status.ConflictingResources = append(
+					restore.Status.ConflictingResources,
+					v1beta1.ConflictingResource{
+						Kind:      res.gvk.GroupVersion().String() + "/" + res.gvk.Kind,
+						Namespace: res.namespace,
+						Name:      res.name,
+						Action:    action,
+					},
+				)
+			}
+		}
+	}
+
+	if conflicts > 0 && action == v1beta1.ConflictActionFailed {
+		return fmt.Errorf("%w: %d resources", errConflictingResources, conflicts)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var (
+	managedClusterGVK = schema.GroupVersionKind{
+		Group:   "cluster.open-cluster-management.io",
+		Version: "v1",
+		Kind:    "ManagedCluster",
+	}
+)
+
+func Test_parseBackupResourceList(t *testing.T) {
+	resourceList := map[string][]string{
+		"v1/Secret": {"ns1/secret1", "ns2/secret2"},
+		"cluster.open-cluster-management.io/v1/ManagedCluster": {"cluster1"},
+		"invalid": {"ns/name"},
+	}
+	want := []backedUpResource{
+		{gvk: managedClusterGVK, name: "cluster1"},
+		{gvk: secretGVK, namespace: "ns1", name: "secret1"},
+		{gvk: secretGVK, namespace: "ns2", name: "secret2"},
+	}
+	if got := parseBackupResourceList(resourceList); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBackupResourceList() = %v, want %v", got, want)
+	}
+}
+
+func Test_isManagedResourceKind(t *testing.T) {
+	tests := []struct {
+		name string
+		gvk  schema.GroupVersionKind
+		want bool
+	}{
+		{
+			name: "secret",
+			gvk:  secretGVK,
+			want: true,
+		},
+		{
+			name: "config map",
+			gvk:  schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			want: false,
+		},
+		{
+			name: "managed cluster",
+			gvk:  managedClusterGVK,
+			want: true,
+		},
+		{
+			name: "excluded api group",
+			gvk: schema.GroupVersionKind{
+				Group:   "work.open-cluster-management.io",
+				Version: "v1",
+				Kind:    "ManifestWork",
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isManagedResourceKind(tt.gvk); got != tt.want {
+				t.Errorf("isManagedResourceKind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getExistingResources(t *testing.T) {
+	existingSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret1", Namespace: "ns1"},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(existingSecret).Build()
+
+	resources := []backedUpResource{
+		{gvk: secretGVK, namespace: "ns1", name: "secret1"},
+		{gvk: secretGVK, namespace: "ns1", name: "secret2"},
+		{gvk: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, namespace: "ns1", name: "secret1"},
+	}
+	got, err := getExistingResources(context.Background(), c, resources)
+	if err != nil {
+		t.Fatalf("getExistingResources() error = %v", err)
+	}
+	want := []backedUpResource{resources[0]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getExistingResources() = %v, want %v", got, want)
+	}
+}
+
+func Test_readBackupContents(t *testing.T) {
+	backedUp := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":      "secret1",
+			"namespace": "ns1",
+		},
+	}
+	content, _ := json.Marshal(backedUp)
+
+	buf := &bytes.Buffer{}
+	tarWriter := tar.NewWriter(buf)
+	for _, name := range []string{
+		"metadata/version",
+		"resources/secrets/namespaces/ns1/secret1.json",
+		"resources/secrets/namespaces/ns1/secret2.json",
+	} {
+		_ = tarWriter.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0600,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		})
+		_, _ = tarWriter.Write(content)
+	}
+	tarWriter.Close()
+
+	res := backedUpResource{gvk: secretGVK, namespace: "ns1", name: "secret1"}
+	objects := map[backedUpResource]*unstructured.Unstructured{}
+	if err := readBackupContents([]backedUpResource{res}, objects)(buf); err != nil {
+		t.Fatalf("readBackupContents() error = %v", err)
+	}
+	if len(objects) != 1 || objects[res] == nil ||
+		!reflect.DeepEqual(objects[res].Object, backedUp) {
+		t.Errorf("readBackupContents() = %v, want %v", objects, backedUp)
+	}
+}
+
+func Test_prepareForUpdate(t *testing.T) {
+	backedUp := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":            "secret1",
+			"namespace":       "ns1",
+			"labels":          map[string]interface{}{"a": "b"},
+			"uid":             "old-uid",
+			"resourceVersion": "1",
+		},
+		"data":   map[string]interface{}{"key": "dmFsdWU="},
+		"status": map[string]interface{}{"phase": "old"},
+	}}
+	existing := &unstructured.Unstructured{}
+	existing.SetResourceVersion("42")
+	existing.SetFinalizers([]string{"finalizer"})
+
+	want := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":            "secret1",
+			"namespace":       "ns1",
+			"labels":          map[string]interface{}{"a": "b"},
+			"resourceVersion": "42",
+			"finalizers":      []interface{}{"finalizer"},
+		},
+		"data": map[string]interface{}{"key": "dmFsdWU="},
+	}
+	if got := prepareForUpdate(backedUp, existing); !reflect.DeepEqual(got.Object, want) {
+		t.Errorf("prepareForUpdate() = %v, want %v", got.Object, want)
+	}
+}
@@ -21,18 +21,26 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
 	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
@@ -40,7 +48,7 @@ import (
 
 var (
 	apiGVStr = v1beta1.GroupVersion.String()
-	// PublicAPIServerURL the public URL for the APIServer
+	// PublicAPIServerURL the public URL for the APIServer, overrides the URL read from the infrastructure resource
 	PublicAPIServerURL = ""
 )
 
@@ -53,18 +61,48 @@ const (
 // RestoreReconciler reconciles a Restore object
 type RestoreReconciler struct {
 	client.Client
-	KubeClient kubernetes.Interface
-	Scheme     *runtime.Scheme
-	Recorder   record.EventRecorder
+	KubeClient      kubernetes.Interface
+	DiscoveryClient discovery.DiscoveryInterface
+	Scheme          *runtime.Scheme
+	Recorder        record.EventRecorder
+	// PreflightChecks enables the checks run before creating the velero restores
+	PreflightChecks bool
 }
 
 //+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=restores,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=restores/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=restores/finalizers,verbs=update
 //+kubebuilder:rbac:groups=velero.io,resources=backups,verbs=get;list
-//+kubebuilder:rbac:groups=velero.io,resources=restores,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups=velero.io,resources=restores,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups=velero.io,resources=downloadrequests,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=action.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=addon.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=agent.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=app.k8s.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=apps.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=argoproj.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=core.observatorium.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=discovery.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=hive.openshift.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=imageregistry.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=inventory.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=observability.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=search.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=submarineraddon.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=view.open-cluster-management.io,resources=*,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list;patch
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;update;patch
+//+kubebuilder:rbac:groups=hive.openshift.io,resources=clusterdeployments,verbs=get;list;watch
+//+kubebuilder:rbac:groups=config.openshift.io,resources=infrastructures,verbs=get;list;watch
 //+kubebuilder:rbac:groups=velero.io,resources=backupstoragelocations,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=selfsubjectaccessreviews,verbs=create
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -76,65 +114,46 @@ func (r *RestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// don't create restores if backup storage location doesn't exist or is not avaialble
-	veleroStorageLocations := &veleroapi.BackupStorageLocationList{}
-	if err := r.Client.List(ctx, veleroStorageLocations, &client.ListOptions{}); err != nil ||
-		veleroStorageLocations == nil || len(veleroStorageLocations.Items) == 0 {
+	// a spec update or a new rerun annotation value starts a new run of the restore
+	r.startRestoreRun(ctx, restore)
+
+	// a restore stopped by the deletion of its timed out velero restores is not resumed
+	if isRestoreTimedOut(restore) {
+		return ctrl.Result{}, nil
+	}
 
-		msg := "velero.io.BackupStorageLocation resources not found. " +
-			"Verify you have created a konveyor.openshift.io.Velero or oadp.openshift.io.DataProtectionApplications resource."
+	if err := validateRestoreHooks(restore); err != nil {
+		msg := err.Error()
 		updateRestoreStatus(restoreLogger, v1beta1.RestorePhaseError, msg, restore)
-		// retry after failureInterval
-		return ctrl.Result{RequeueAfter: failureInterval}, errors.Wrap(
+		return ctrl.Result{}, errors.Wrap(
 			r.Client.Status().Update(ctx, restore),
 			msg,
 		)
 	}
 
-	// look for available VeleroStorageLocation
-	// and keep track of the velero oadp namespace
-	veleroNamespace := ""
-	isValidStorageLocation := false
-	for i := range veleroStorageLocations.Items {
-		if veleroStorageLocations.Items[i].OwnerReferences != nil &&
-			veleroStorageLocations.Items[i].Status.Phase == veleroapi.BackupStorageLocationPhaseAvailable {
-			for _, ref := range veleroStorageLocations.Items[i].OwnerReferences {
-				if ref.Kind != "" {
-					isValidStorageLocation = true
-					veleroNamespace = veleroStorageLocations.Items[i].Namespace
-					break
-				}
-			}
-		}
-		if isValidStorageLocation {
-			break
-		}
-	}
-
-	// if no valid storage location found wait for valid value
-	if !isValidStorageLocation {
-		msg := "Backup storage location not available in namespace " + req.Namespace +
-			". Check velero.io.BackupStorageLocation and validate storage credentials."
+	if err := validateRestoreSyncOptions(restore); err != nil {
+		msg := err.Error()
 		updateRestoreStatus(restoreLogger, v1beta1.RestorePhaseError, msg, restore)
-
-		// retry after failureInterval
-		return ctrl.Result{RequeueAfter: failureInterval}, errors.Wrap(
+		return ctrl.Result{}, errors.Wrap(
 			r.Client.Status().Update(ctx, restore),
 			msg,
 		)
 	}
 
-	// return error if the cluster restore file is not in the same namespace with velero
-	if veleroNamespace != req.Namespace {
-		msg := fmt.Sprintf(
-			"Restore resource [%s/%s] must be created in the velero namespace [%s]",
-			req.Namespace,
-			req.Name,
-			veleroNamespace,
-		)
+	// don't create restores if backup storage location doesn't exist or is not avaialble
+	_, storageLocationStatus, msg := validateStorageLocation(
+		ctx,
+		r.Client,
+		"Restore",
+		req.NamespacedName,
+		restore.Spec.StorageLocation,
+	)
+	restore.Status.StorageLocation = storageLocationStatus
+	if msg != "" {
 		updateRestoreStatus(restoreLogger, v1beta1.RestorePhaseError, msg, restore)
-
-		return ctrl.Result{}, errors.Wrap(
+		// the storage locations watch triggers a new reconcile when a storage location becomes available,
+		// retry after failureInterval in case the storage locations couldn't be listed
+		return ctrl.Result{RequeueAfter: failureInterval}, errors.Wrap(
 			r.Client.Status().Update(ctx, restore),
 			msg,
 		)
@@ -160,8 +179,72 @@ func (r *RestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, err
 	}
 
-	if len(veleroRestoreList.Items) == 0 {
-		if err := r.initVeleroRestores(ctx, restore); err != nil {
+	// keep the velero restores of the current run, the previous runs velero restores are history
+	currentVeleroRestores, err := r.pruneRestoreRuns(ctx, restore, &veleroRestoreList)
+	if err != nil {
+		restoreLogger.Error(err, "unable to delete the velero restores of the previous runs")
+		return ctrl.Result{}, err
+	}
+	veleroRestoreList = *currentVeleroRestores
+
+	// a restore syncing with new backups keeps the velero restores of the latest backups
+	latestVeleroRestores, err := r.pruneSyncedVeleroRestores(ctx, restore, &veleroRestoreList)
+	if err != nil {
+		restoreLogger.Error(err, "unable to delete the velero restores replaced by new backups")
+		return ctrl.Result{}, err
+	}
+	veleroRestoreList = *latestVeleroRestores
+
+	result := ctrl.Result{}
+	syncWithNewBackups, syncDelay := shouldSyncWithNewBackups(restore, &veleroRestoreList, time.Now())
+	result.RequeueAfter = syncDelay
+
+	if len(veleroRestoreList.Items) == 0 && r.PreflightChecks {
+		restore.Status.PreflightChecks = runPreflightChecks(
+			ctx,
+			r.Client,
+			r.DiscoveryClient,
+			req.Namespace,
+			restore.Spec.StorageLocation,
+			restorePermissions,
+		)
+		if failed := getFailedPreflightChecks(restore.Status.PreflightChecks); len(failed) > 0 {
+			updateRestoreStatus(
+				restoreLogger,
+				v1beta1.RestorePhaseError,
+				"Pre-flight checks failed: "+strings.Join(failed, "; "),
+				restore,
+			)
+			return ctrl.Result{RequeueAfter: preflightCheckInterval}, errors.Wrap(
+				r.Client.Status().Update(ctx, restore),
+				updateStatusFailedMsg,
+			)
+		}
+	}
+
+	if len(veleroRestoreList.Items) == 0 || syncWithNewBackups {
+		if err := r.initVeleroRestores(ctx, restore, &veleroRestoreList); err != nil {
+			if errors.Is(err, errRestoreHooksPending) {
+				// the hook jobs trigger a new reconcile when they complete
+				restoreLogger.Info(restore.Status.LastMessage)
+				return ctrl.Result{RequeueAfter: restoreHookCheckInterval}, errors.Wrap(
+					r.Client.Status().Update(ctx, restore),
+					updateStatusFailedMsg,
+				)
+			}
+			if errors.Is(err, errDownloadNotReady) {
+				// wait for velero to provide the backed up resources
+				updateRestoreStatus(
+					restoreLogger,
+					v1beta1.RestorePhaseStarted,
+					"Looking for backed up resources already existing on the hub",
+					restore,
+				)
+				return ctrl.Result{RequeueAfter: downloadRequestInterval}, errors.Wrap(
+					r.Client.Status().Update(ctx, restore),
+					updateStatusFailedMsg,
+				)
+			}
 			msg := fmt.Sprintf(
 				"unable to initialize Velero restores for restore %s/%s: %v",
 				req.Namespace,
@@ -178,12 +261,119 @@ func (r *RestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 				msg,
 			)
 		}
+		if syncWithNewBackups {
+			// the velero restores for the new backups, if any, report their phase on the next reconcile
+			return result, errors.Wrap(
+				r.Client.Status().Update(ctx, restore),
+				updateStatusFailedMsg,
+			)
+		}
+	}
+
+	// create again the failed velero restores, according to the retry policy
+	activeVeleroRestores, retrying, retryDelay, err := r.retryFailedVeleroRestores(ctx, restore, &veleroRestoreList)
+	if err != nil {
+		restoreLogger.Error(err, "unable to retry the failed velero restores")
+		result.RequeueAfter = failureInterval
 	}
+	veleroRestoreList = *activeVeleroRestores
 
 	setRestorePhase(&veleroRestoreList, restore)
 
-	err := r.Client.Status().Update(ctx, restore)
-	return ctrl.Result{}, errors.Wrap(
+	if r.reportRestoreProgress(restore, &veleroRestoreList) {
+		if restore.Status.Phase == v1beta1.RestorePhaseRunning {
+			restore.Status.LastMessage += ": " + getRestoreProgressMessage(restore.Status.Progress)
+		}
+		// report the progress again even if velero does not update the velero restores
+		if result.RequeueAfter == 0 || result.RequeueAfter > progressReportInterval {
+			result.RequeueAfter = progressReportInterval
+		}
+	}
+
+	if len(retrying) > 0 && restore.Status.Phase != v1beta1.RestorePhaseError {
+		restore.Status.Phase = v1beta1.RestorePhaseRunning
+		restore.Status.LastMessage = fmt.Sprintf("Retrying the failed Velero restores: %s", strings.Join(retrying, ", "))
+		if retryDelay > 0 && (result.RequeueAfter == 0 || retryDelay < result.RequeueAfter) {
+			result.RequeueAfter = retryDelay
+		}
+	}
+
+	timedOut, timeLeft, err := r.checkStuckVeleroRestores(ctx, restore, &veleroRestoreList)
+	if err != nil {
+		restoreLogger.Error(err, "unable to check the velero restores timeout")
+		result.RequeueAfter = failureInterval
+	} else if len(timedOut) > 0 {
+		updateRestoreStatus(
+			restoreLogger,
+			v1beta1.RestorePhaseError,
+			fmt.Sprintf(
+				"Velero restores have been running for more than %s: %s",
+				restore.Spec.VeleroRestoreTimeout.Duration,
+				strings.Join(timedOut, ", "),
+			),
+			restore,
+		)
+		return ctrl.Result{}, errors.Wrap(
+			r.Client.Status().Update(ctx, restore),
+			updateStatusFailedMsg,
+		)
+	} else if timeLeft > 0 && (result.RequeueAfter == 0 || timeLeft < result.RequeueAfter) {
+		// check again when the next velero restore times out
+		result.RequeueAfter = timeLeft
+	}
+
+	// replace the values specific to the hub where the backups were taken
+	if err := r.applyRestoreTransforms(ctx, restore, &veleroRestoreList); err != nil {
+		restoreLogger.Error(err, "unable to transform the restored resources")
+		result.RequeueAfter = failureInterval
+	}
+
+	if restore.Status.Phase == v1beta1.RestorePhaseFinished ||
+		restore.Status.Phase == v1beta1.RestorePhaseFinishedWithErrors {
+		// the credentials must be decrypted before the managed clusters are activated
+		if err := r.unsealCredentials(ctx, restore, &veleroRestoreList); err != nil {
+			updateRestoreStatus(
+				restoreLogger,
+				v1beta1.RestorePhaseError,
+				fmt.Sprintf("Unable to decrypt the restored credentials: %v", err),
+				restore,
+			)
+			return ctrl.Result{RequeueAfter: failureInterval}, errors.Wrap(
+				r.Client.Status().Update(ctx, restore),
+				updateStatusFailedMsg,
+			)
+		}
+
+		pending, err := r.activateManagedClusters(ctx, restore, &veleroRestoreList)
+		if err != nil {
+			restoreLogger.Error(err, "unable to activate the restored managed clusters")
+			result.RequeueAfter = failureInterval
+		} else if pending {
+			// check again the connection of the restored managed clusters
+			result.RequeueAfter = activationCheckInterval
+		}
+	}
+
+	running, failed, err := r.runPostRestoreHooks(ctx, restore, &veleroRestoreList)
+	if err != nil {
+		restoreLogger.Error(err, "unable to run the post-restore hooks")
+		result.RequeueAfter = failureInterval
+	} else if len(running) > 0 {
+		restore.Status.Phase = v1beta1.RestorePhaseRunning
+		restore.Status.LastMessage = fmt.Sprintf("Waiting for the post-restore hooks: %s", strings.Join(running, ", "))
+		result.RequeueAfter = restoreHookCheckInterval
+	} else if len(failed) > 0 && restore.Status.Phase != v1beta1.RestorePhaseError {
+		restore.Status.Phase = v1beta1.RestorePhaseFinishedWithErrors
+		restore.Status.LastMessage = fmt.Sprintf("Post-restore hooks failed: %s", strings.Join(failed, ", "))
+	}
+
+	if r.setRestoreResults(ctx, restore, &veleroRestoreList) {
+		// detailed velero restore results not available yet
+		result.RequeueAfter = downloadRequestInterval
+	}
+
+	err = r.Client.Status().Update(ctx, restore)
+	return result, errors.Wrap(
 		err,
 		fmt.Sprintf("could not update status for restore %s/%s", restore.Namespace, restore.Name),
 	)
@@ -194,9 +384,16 @@ func setRestorePhase(
 	veleroRestoreList *veleroapi.RestoreList,
 	restore *v1beta1.Restore,
 ) {
-	// get all velero restores and check status for each
-	for i := range veleroRestoreList.Items {
-		veleroRestore := veleroRestoreList.Items[i].DeepCopy()
+	if veleroRestoreList == nil || len(veleroRestoreList.Items) == 0 {
+		// no velero restores created, keep the phase set on initialization
+		return
+	}
+
+	// check the status of the latest velero restore of each type,
+	// the older velero restores were replaced by the restores of new backups
+	latestVeleroRestores, _ := getLatestVeleroRestores(veleroRestoreList)
+	for i := range latestVeleroRestores.Items {
+		veleroRestore := latestVeleroRestores.Items[i].DeepCopy()
 
 		if veleroRestore.Status.Phase == "" {
 			restore.Status.Phase = v1beta1.RestorePhaseUnknown
@@ -234,14 +431,24 @@ func setRestorePhase(
 		if veleroRestore.Status.Phase == veleroapi.RestorePhasePartiallyFailed {
 			restore.Status.Phase = v1beta1.RestorePhaseFinishedWithErrors
 			restore.Status.LastMessage = fmt.Sprintf(
-				"Velero restore %s has run to completion but encountered 1+ errors",
+				"Velero restore %s has run to completion but encountered %d errors and %d warnings",
 				veleroRestore.Name,
+				veleroRestore.Status.Errors,
+				veleroRestore.Status.Warnings,
 			)
 			return
 		}
 	}
 
 	// if no velero restore with error, new or inprogress status, they are all completed
+	if isRestoreSyncActive(restore) {
+		restore.Status.Phase = v1beta1.RestorePhaseEnabled
+		restore.Status.LastMessage = fmt.Sprintf(
+			"Velero restores have run to completion, restore will continue to sync with new backups every %s",
+			getRestoreSyncInterval(restore),
+		)
+		return
+	}
 	restore.Status.Phase = v1beta1.RestorePhaseFinished
 	restore.Status.LastMessage = "All Velero restores have run successfully"
 }
@@ -270,10 +477,35 @@ func (r *RestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1beta1.Restore{}).
 		Owns(&veleroapi.Restore{}).
+		Owns(&batchv1.Job{}).
+		Watches(
+			&source.Kind{Type: &veleroapi.BackupStorageLocation{}},
+			handler.EnqueueRequestsFromMapFunc(r.getRestoresForStorageLocation),
+			builder.WithPredicates(storageLocationChanged),
+		).
 		//WithOptions(controller.Options{MaxConcurrentReconciles: 3}). TODO: enable parallelism as soon attaching works
 		Complete(r)
 }
 
+// returns the restores waiting for a storage location, to reconcile when a storage location changes
+func (r *RestoreReconciler) getRestoresForStorageLocation(client.Object) []reconcile.Request {
+	restores := &v1beta1.RestoreList{}
+	if err := r.List(context.Background(), restores); err != nil {
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for i := range restores.Items {
+		if restores.Items[i].Status.Phase != "" && restores.Items[i].Status.Phase != v1beta1.RestorePhaseError {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      restores.Items[i].Name,
+			Namespace: restores.Items[i].Namespace,
+		}})
+	}
+	return requests
+}
+
 // mostRecentWithLessErrors defines type and code to sort velero backups
 // according to number of errors and start timestamp
 type mostRecentWithLessErrors []veleroapi.Backup
@@ -301,21 +533,25 @@ func (r *RestoreReconciler) getVeleroBackupName(
 	backupName string,
 ) (string, error) {
 
-	var computedName string
+	var computedName, backupTimestamp string
 
 	if backupName == latestBackupStr {
 		// backup name not available, find a proper backup
 		veleroBackups := &veleroapi.BackupList{}
-		if err := r.Client.List(ctx, veleroBackups, client.InNamespace(restore.Namespace)); err != nil {
+		if err := r.Client.List(ctx, veleroBackups, getRestoreBackupListOptions(restore)...); err != nil {
 			return "", fmt.Errorf("unable to list velero backups: %v", err)
 		}
 		if len(veleroBackups.Items) == 0 {
+			if restore.Spec.SourceHub != "" {
+				return "", fmt.Errorf("no backups found for source hub %s", restore.Spec.SourceHub)
+			}
 			return "", fmt.Errorf("no backups found")
 		}
 		// filter available backups to get only the ones related to this resource type
 		relatedBackups := filterBackups(veleroBackups.Items, func(bkp veleroapi.Backup) bool {
 			return strings.Contains(bkp.Name, veleroScheduleNames[resourceType]) &&
-				bkp.Status.Phase == veleroapi.BackupPhaseCompleted
+				bkp.Status.Phase == veleroapi.BackupPhaseCompleted &&
+				isLatestBackupCandidate(restore, &bkp)
 		})
 		if len(relatedBackups) == 0 {
 			return "", fmt.Errorf("no backups found")
@@ -323,10 +559,11 @@ func (r *RestoreReconciler) getVeleroBackupName(
 		sort.Sort(mostRecentWithLessErrors(relatedBackups))
 		return relatedBackups[0].Name, nil
 	} else {
-		// get the backup name for this type of resource, based on the requested resource timestamp
-		backupTimestamp := strings.LastIndex(backupName, "-")
-		if backupTimestamp != -1 {
-			computedName = veleroScheduleNames[resourceType] + backupName[backupTimestamp:]
+		// get the backup name for this type of resource, based on the requested resource timestamp,
+		// from the same set of velero schedules as the requested backup
+		if timestampIndex := strings.LastIndex(backupName, "-"); timestampIndex != -1 {
+			backupTimestamp = backupName[timestampIndex:]
+			computedName = veleroScheduleNames[resourceType] + getBackupScheduleSuffix(backupName) + backupTimestamp
 		}
 	}
 
@@ -336,20 +573,51 @@ func (r *RestoreReconciler) getVeleroBackupName(
 		types.NamespacedName{Name: computedName, Namespace: restore.Namespace},
 		&veleroBackup,
 	)
-	if err == nil {
-		return computedName, nil
+	if backupTimestamp != "" && restore.Spec.StorageLocation != "" &&
+		(k8serr.IsNotFound(err) || (err == nil && !isBackupInStorageLocation(restore, &veleroBackup))) {
+		// look for the backup saved by a velero schedule of a secondary storage location
+		var secondaryBackup *veleroapi.Backup
+		secondaryBackup, err = r.findSecondaryBackup(ctx, restore, resourceType, backupTimestamp)
+		if err == nil {
+			veleroBackup = *secondaryBackup
+			computedName = veleroBackup.Name
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot find %s Velero Backup: %v", computedName, err)
+	}
+	if !isBackupInStorageLocation(restore, &veleroBackup) {
+		return "", fmt.Errorf(
+			"velero Backup %s is not saved in storage location %s",
+			computedName,
+			restore.Spec.StorageLocation,
+		)
+	}
+	if !isBackupFromSourceHub(restore, &veleroBackup) {
+		return "", fmt.Errorf(
+			"velero Backup %s was not produced by source hub %s",
+			computedName,
+			restore.Spec.SourceHub,
+		)
 	}
-	return "", fmt.Errorf("cannot find %s Velero Backup: %v", computedName, err)
+	return computedName, nil
 }
 
 // create velero.io.Restore resource for each resource type
+// skipping the backups already restored by the existing velero restores
 func (r *RestoreReconciler) initVeleroRestores(
 	ctx context.Context,
 	restore *v1beta1.Restore,
+	existingRestores *veleroapi.RestoreList,
 ) error {
 	restoreLogger := log.FromContext(ctx)
 
+	if err := r.setSourceHubs(ctx, restore); err != nil {
+		return err
+	}
+
 	veleroRestoresToCreate := make(map[ResourceType]*veleroapi.Restore, len(veleroScheduleNames))
+	missingBackups := []string{}
 
 	// loop through resourceTypes to create a Velero restore per type
 	for key := range veleroScheduleNames {
@@ -389,24 +657,27 @@ func (r *RestoreReconciler) initVeleroRestores(
 				"namespace", restore.Namespace,
 				"type", key,
 			)
-			restore.Status.Phase = v1beta1.RestorePhaseError
-			restore.Status.LastMessage = fmt.Sprintf(
-				"Backup %s Not found for resource type: %s",
-				backupName,
-				key,
-			)
-
+			// ignore missing hive or cluster key backup files
+			// for the case when the backups were created with an older controller version
 			if key != CredentialsHive && key != CredentialsCluster && key != ResourcesGeneric {
-				// ignore missing hive or cluster key backup files
-				// for the case when the backups were created with an older controller version
-				return err
+				// look for all the missing backups before stopping the restore
+				missingBackups = append(missingBackups, fmt.Sprintf(
+					"Backup %s Not found for resource type: %s",
+					backupName,
+					key,
+				))
 			}
 		} else {
 
-			veleroRestore.Name = getValidKsRestoreName(restore.Name, veleroBackupName)
+			veleroRestore.Name = getValidKsRestoreName(getRestoreRunName(restore), veleroBackupName)
+			if isVeleroRestoreCreated(existingRestores, veleroRestore.Name) {
+				// this backup was already restored
+				continue
+			}
 
 			veleroRestore.Namespace = restore.Namespace
 			veleroRestore.Spec.BackupName = veleroBackupName
+			setVeleroRestoreRun(restore, veleroRestore)
 
 			if err := ctrl.SetControllerReference(restore, veleroRestore, r.Scheme); err != nil {
 				return err
@@ -415,13 +686,66 @@ func (r *RestoreReconciler) initVeleroRestores(
 		}
 	}
 
+	if len(missingBackups) > 0 {
+		sort.Strings(missingBackups)
+		restore.Status.Phase = v1beta1.RestorePhaseError
+		restore.Status.LastMessage = strings.Join(missingBackups, "; ")
+		return errors.New(restore.Status.LastMessage)
+	}
+
 	if len(veleroRestoresToCreate) == 0 {
+		if len(existingRestores.Items) > 0 {
+			// no new backup to restore, keep the current phase
+			return nil
+		}
 		restore.Status.Phase = v1beta1.RestorePhaseFinished
 		restore.Status.LastMessage = fmt.Sprintf("Nothing to do for restore %s", restore.Name)
 		return nil
 	}
 
+	if err := r.runPreRestoreHooks(ctx, restore, veleroRestoresToCreate); err != nil {
+		if errors.Is(err, errRestoreHooksPending) {
+			restore.Status.Phase = v1beta1.RestorePhaseStarted
+			restore.Status.LastMessage = fmt.Sprintf("Waiting for the pre-restore hooks of restore %s", restore.Name)
+			return err
+		}
+		if !errors.Is(err, errRestoreHookFailed) {
+			return err
+		}
+		// don't create any velero restore
+		restore.Status.Phase = v1beta1.RestorePhaseError
+		restore.Status.LastMessage = fmt.Sprintf("Restore %s stopped, %v", restore.Name, err)
+		return nil
+	}
+
+	if restore.Spec.ConflictPolicy != "" ||
+		(restore.Spec.CleanupBeforeRestore != "" && restore.Spec.CleanupBeforeRestore != v1beta1.CleanupTypeNone) {
+		backedUpResources, err := getBackedUpResources(ctx, r.Client, restore.Namespace, veleroRestoresToCreate)
+		if err != nil {
+			return err
+		}
+
+		if err := r.applyConflictPolicy(ctx, restore, veleroRestoresToCreate, backedUpResources); err != nil {
+			if !errors.Is(err, errConflictingResources) {
+				return err
+			}
+			// conflict policy is fail, don't create any velero restore
+			restore.Status.Phase = v1beta1.RestorePhaseError
+			restore.Status.LastMessage = fmt.Sprintf(
+				"Restore %s stopped, %v. Check the conflicting resources in the restore status",
+				restore.Name,
+				err,
+			)
+			return nil
+		}
+
+		if err := r.cleanupBeforeRestore(ctx, restore, veleroRestoresToCreate, backedUpResources); err != nil {
+			return err
+		}
+	}
+
 	for key := range veleroRestoresToCreate {
+		veleroHooks := setVeleroRestoreHooks(restore, key, veleroRestoresToCreate[key])
 		if err := r.Create(ctx, veleroRestoresToCreate[key], &client.CreateOptions{}); err != nil {
 			restoreLogger.Error(
 				err,
@@ -445,6 +769,7 @@ func (r *RestoreReconciler) initVeleroRestores(
 			"Velero restore created:",
 			veleroRestoresToCreate[key].Name,
 		)
+		setVeleroRestoreHooksStatus(restore, veleroHooks, veleroRestoresToCreate[key].Name)
 
 		switch key {
 		case ManagedClusters:
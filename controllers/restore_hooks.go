@@ -0,0 +1,377 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// interval used to check the hook jobs still running
+	restoreHookCheckInterval = 30 * time.Second
+	// label set on the hook jobs, with the name of the hook
+	restoreHookLabel = "cluster.open-cluster-management.io/restore-hook"
+	// max length of a job name, the job name is used as a pod label value
+	maxJobNameLength = 63
+	// service account running the hook jobs in the restore namespace, created by the admin with
+	// the permissions needed by the hooks; the hook jobs can't use the velero service accounts
+	restoreHookServiceAccount = "restore-hooks"
+)
+
+// errRestoreHooksPending is returned while pre-restore hooks are running
+var errRestoreHooksPending = errors.New("pre-restore hooks not completed yet")
+
+// errRestoreHookFailed is returned when a pre-restore hook failed
+var errRestoreHookFailed = errors.New("pre-restore hook failed")
+
+// returns an error if the restore hooks are not valid
+func validateRestoreHooks(restore *v1beta1.Restore) error {
+	if restore.Spec.Hooks == nil {
+		return nil
+	}
+	names := map[string]bool{}
+	for stage, hooks := range map[v1beta1.RestoreHookStage][]v1beta1.RestoreHook{
+		v1beta1.RestoreHookStagePre:  restore.Spec.Hooks.PreRestore,
+		v1beta1.RestoreHookStagePost: restore.Spec.Hooks.PostRestore,
+	} {
+		for _, hook := range hooks {
+			if hook.Name == "" {
+				return fmt.Errorf("restore hooks must have a name")
+			}
+			if names[hook.Name] {
+				return fmt.Errorf("restore hook name %s is used by more than one hook", hook.Name)
+			}
+			names[hook.Name] = true
+
+			if (hook.Job == nil) == (hook.VeleroHook == nil) {
+				return fmt.Errorf("restore hook %s must set exactly one of job or veleroHook", hook.Name)
+			}
+			if hook.Job != nil && !isRestoreHookServiceAccount(&hook.Job.Spec.Template.Spec) {
+				return fmt.Errorf(
+					"restore hook %s: the job must run with the %s service account",
+					hook.Name,
+					restoreHookServiceAccount,
+				)
+			}
+			if hook.VeleroHook != nil && stage == v1beta1.RestoreHookStagePre {
+				return fmt.Errorf(
+					"restore hook %s: veleroHook runs on the restored pods and is only allowed for postRestore hooks",
+					hook.Name,
+				)
+			}
+			for _, resourceType := range hook.ResourceTypes {
+				if _, ok := veleroScheduleNames[ResourceType(resourceType)]; !ok {
+					return fmt.Errorf("restore hook %s: unknown resource type %s", hook.Name, resourceType)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// returns true if the pod template doesn't set a service account other than the restore hooks service account
+func isRestoreHookServiceAccount(podSpec *corev1.PodSpec) bool {
+	for _, name := range []string{podSpec.ServiceAccountName, podSpec.DeprecatedServiceAccount} {
+		if name != "" && name != restoreHookServiceAccount {
+			return false
+		}
+	}
+	return true
+}
+
+// returns true if the hook applies to the velero restore of this resource type
+func isRestoreHookForType(hook *v1beta1.RestoreHook, key ResourceType) bool {
+	if len(hook.ResourceTypes) == 0 {
+		return true
+	}
+	for _, resourceType := range hook.ResourceTypes {
+		if ResourceType(resourceType) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the resource type of the backup restored by the velero restore
+func getVeleroRestoreResourceType(veleroRestore *veleroapi.Restore) (ResourceType, bool) {
+	for key, scheduleName := range veleroScheduleNames {
+		if strings.HasPrefix(veleroRestore.Spec.BackupName, scheduleName+"-") {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// returns the name of the job run by the hook for the velero restore,
+// the velero restore is hashed to keep the name short
+func getRestoreHookJobName(restore *v1beta1.Restore, hookName string, veleroRestoreName string) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(veleroRestoreName))
+	suffix := fmt.Sprintf("-%08x", hash.Sum32())
+
+	prefix := restore.Name + "-" + hookName
+	if len(prefix) > maxJobNameLength-len(suffix) {
+		prefix = strings.TrimRight(prefix[:maxJobNameLength-len(suffix)], "-.")
+	}
+	return prefix + suffix
+}
+
+// returns the status of the hook for the velero restore, adding it to the restore status if not found
+func findRestoreHookStatus(
+	restore *v1beta1.Restore,
+	hookName string,
+	stage v1beta1.RestoreHookStage,
+	veleroRestoreName string,
+) *v1beta1.RestoreHookStatus {
+	for i := range restore.Status.Hooks {
+		status := &restore.Status.Hooks[i]
+		if status.Name == hookName && status.Stage == stage && status.VeleroRestoreName == veleroRestoreName {
+			return status
+		}
+	}
+	restore.Status.Hooks = append(restore.Status.Hooks, v1beta1.RestoreHookStatus{
+		Name:              hookName,
+		Stage:             stage,
+		VeleroRestoreName: veleroRestoreName,
+	})
+	return &restore.Status.Hooks[len(restore.Status.Hooks)-1]
+}
+
+// returns the phase of a hook job and its completion time, if finished
+func getHookJobPhase(job *batchv1.Job) (v1beta1.RestoreHookPhase, *metav1.Time, string) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			time := condition.LastTransitionTime
+			return v1beta1.RestoreHookPhaseSucceeded, &time, "Job completed"
+		case batchv1.JobFailed:
+			time := condition.LastTransitionTime
+			return v1beta1.RestoreHookPhaseFailed, &time, fmt.Sprintf("Job failed: %s", condition.Message)
+		}
+	}
+	return v1beta1.RestoreHookPhaseRunning, nil, "Job running"
+}
+
+// creates the job of the hook for the velero restore, if not created yet, and reports its phase
+func (r *RestoreReconciler) runRestoreHookJob(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	hook *v1beta1.RestoreHook,
+	stage v1beta1.RestoreHookStage,
+	veleroRestoreName string,
+) (v1beta1.RestoreHookPhase, error) {
+	restoreLogger := log.FromContext(ctx)
+
+	status := findRestoreHookStatus(restore, hook.Name, stage, veleroRestoreName)
+	if status.Phase == v1beta1.RestoreHookPhaseSucceeded || status.Phase == v1beta1.RestoreHookPhaseFailed {
+		// the outcome of the hook is known, the job is not run again
+		return status.Phase, nil
+	}
+	status.JobName = getRestoreHookJobName(restore, hook.Name, veleroRestoreName)
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: restore.Namespace, Name: status.JobName}, job)
+	if client.IgnoreNotFound(err) != nil {
+		return "", err
+	}
+	if err != nil {
+		err := r.Get(
+			ctx,
+			types.NamespacedName{Namespace: restore.Namespace, Name: restoreHookServiceAccount},
+			&corev1.ServiceAccount{},
+		)
+		if client.IgnoreNotFound(err) != nil {
+			return "", err
+		}
+		if err != nil {
+			now := metav1.Now()
+			status.JobName = ""
+			status.Phase = v1beta1.RestoreHookPhaseFailed
+			status.CompletionTime = &now
+			status.Message = fmt.Sprintf(
+				"Service account %s/%s running the hook jobs not found",
+				restore.Namespace,
+				restoreHookServiceAccount,
+			)
+			r.Recorder.Event(
+				restore,
+				corev1.EventTypeWarning,
+				"Restore hook failed:",
+				fmt.Sprintf("%s %s", hook.Name, status.Message),
+			)
+			return status.Phase, nil
+		}
+
+		job = &batchv1.Job{
+			ObjectMeta: *hook.Job.ObjectMeta.DeepCopy(),
+			Spec:       *hook.Job.Spec.DeepCopy(),
+		}
+		job.Name = status.JobName
+		job.Namespace = restore.Namespace
+		// the hook jobs run in the velero namespace, never with the velero service accounts
+		job.Spec.Template.Spec.ServiceAccountName = restoreHookServiceAccount
+		job.Spec.Template.Spec.DeprecatedServiceAccount = ""
+		if job.Labels == nil {
+			job.Labels = map[string]string{}
+		}
+		job.Labels[restoreHookLabel] = hook.Name
+		if err := ctrl.SetControllerReference(restore, job, r.Scheme); err != nil {
+			return "", err
+		}
+		if err := r.Create(ctx, job); err != nil {
+			return "", err
+		}
+		restoreLogger.Info("restore hook job created", "hook", hook.Name, "job", job.Name)
+		r.Recorder.Event(restore, corev1.EventTypeNormal, "Restore hook job created:", job.Name)
+	}
+
+	status.Phase, status.CompletionTime, status.Message = getHookJobPhase(job)
+	if status.Phase == v1beta1.RestoreHookPhaseFailed {
+		r.Recorder.Event(
+			restore,
+			corev1.EventTypeWarning,
+			"Restore hook failed:",
+			fmt.Sprintf("%s %s", hook.Name, status.Message),
+		)
+	}
+	return status.Phase, nil
+}
+
+// runs the pre-restore hook jobs for the velero restores to create;
+// returns errRestoreHooksPending until all of them succeeded
+func (r *RestoreReconciler) runPreRestoreHooks(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	veleroRestores map[ResourceType]*veleroapi.Restore,
+) error {
+	if restore.Spec.Hooks == nil {
+		return nil
+	}
+	pending := false
+	for key, veleroRestore := range veleroRestores {
+		for i := range restore.Spec.Hooks.PreRestore {
+			hook := &restore.Spec.Hooks.PreRestore[i]
+			if !isRestoreHookForType(hook, key) {
+				continue
+			}
+			phase, err := r.runRestoreHookJob(ctx, restore, hook, v1beta1.RestoreHookStagePre, veleroRestore.Name)
+			if err != nil {
+				return err
+			}
+			switch phase {
+			case v1beta1.RestoreHookPhaseFailed:
+				return fmt.Errorf("%w: %s for velero restore %s", errRestoreHookFailed, hook.Name, veleroRestore.Name)
+			case v1beta1.RestoreHookPhaseRunning:
+				pending = true
+			}
+		}
+	}
+	if pending {
+		return errRestoreHooksPending
+	}
+	return nil
+}
+
+// adds the velero hooks of the post-restore hooks to the velero restore of this resource type;
+// returns the names of the added hooks
+func setVeleroRestoreHooks(restore *v1beta1.Restore, key ResourceType, veleroRestore *veleroapi.Restore) []string {
+	if restore.Spec.Hooks == nil {
+		return nil
+	}
+	names := []string{}
+	for i := range restore.Spec.Hooks.PostRestore {
+		hook := &restore.Spec.Hooks.PostRestore[i]
+		if hook.VeleroHook == nil || !isRestoreHookForType(hook, key) {
+			continue
+		}
+		veleroHook := hook.VeleroHook.DeepCopy()
+		if veleroHook.Name == "" {
+			veleroHook.Name = hook.Name
+		}
+		veleroRestore.Spec.Hooks.Resources = append(veleroRestore.Spec.Hooks.Resources, *veleroHook)
+		names = append(names, hook.Name)
+	}
+	return names
+}
+
+// reports the velero hooks added to the created velero restore
+func setVeleroRestoreHooksStatus(restore *v1beta1.Restore, hookNames []string, veleroRestoreName string) {
+	for _, name := range hookNames {
+		status := findRestoreHookStatus(restore, name, v1beta1.RestoreHookStagePost, veleroRestoreName)
+		status.Phase = v1beta1.RestoreHookPhaseAttached
+		status.Message = "Hook added to the velero restore"
+	}
+}
+
+// runs the post-restore hook jobs for the velero restores run to completion;
+// returns the names of the running and failed hooks
+func (r *RestoreReconciler) runPostRestoreHooks(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+) ([]string, []string, error) {
+	if restore.Spec.Hooks == nil {
+		return nil, nil, nil
+	}
+	running, failed := []string{}, []string{}
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		if veleroRestore.Status.Phase != veleroapi.RestorePhaseCompleted &&
+			veleroRestore.Status.Phase != veleroapi.RestorePhasePartiallyFailed {
+			continue
+		}
+		key, ok := getVeleroRestoreResourceType(veleroRestore)
+		if !ok {
+			continue
+		}
+		for j := range restore.Spec.Hooks.PostRestore {
+			hook := &restore.Spec.Hooks.PostRestore[j]
+			if hook.Job == nil || !isRestoreHookForType(hook, key) {
+				continue
+			}
+			phase, err := r.runRestoreHookJob(ctx, restore, hook, v1beta1.RestoreHookStagePost, veleroRestore.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch phase {
+			case v1beta1.RestoreHookPhaseFailed:
+				failed = append(failed, hook.Name)
+			case v1beta1.RestoreHookPhaseRunning:
+				running = append(running, hook.Name)
+			}
+		}
+	}
+	return running, failed, nil
+}
@@ -0,0 +1,284 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newHooksRestore(hooks *v1beta1.RestoreHooks) *v1beta1.Restore {
+	return &v1beta1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "velero-ns"},
+		Spec:       v1beta1.RestoreSpec{Hooks: hooks},
+	}
+}
+
+func Test_validateRestoreHooks(t *testing.T) {
+	job := &batchv1.JobTemplateSpec{}
+	veleroHook := &veleroapi.RestoreResourceHookSpec{}
+	tests := []struct {
+		name    string
+		hooks   *v1beta1.RestoreHooks
+		wantErr bool
+	}{
+		{
+			name:    "no hooks",
+			wantErr: false,
+		},
+		{
+			name: "job and velero hooks",
+			hooks: &v1beta1.RestoreHooks{
+				PreRestore:  []v1beta1.RestoreHook{{Name: "pre", Job: job, ResourceTypes: []string{"credentials"}}},
+				PostRestore: []v1beta1.RestoreHook{{Name: "post", VeleroHook: veleroHook}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "duplicate names",
+			hooks: &v1beta1.RestoreHooks{
+				PreRestore:  []v1beta1.RestoreHook{{Name: "hook", Job: job}},
+				PostRestore: []v1beta1.RestoreHook{{Name: "hook", Job: job}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "job and velero hook set",
+			hooks: &v1beta1.RestoreHooks{
+				PostRestore: []v1beta1.RestoreHook{{Name: "post", Job: job, VeleroHook: veleroHook}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "pre-restore velero hook",
+			hooks: &v1beta1.RestoreHooks{
+				PreRestore: []v1beta1.RestoreHook{{Name: "pre", VeleroHook: veleroHook}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "job with the restore hooks service account",
+			hooks: &v1beta1.RestoreHooks{
+				PreRestore: []v1beta1.RestoreHook{{Name: "pre", Job: &batchv1.JobTemplateSpec{
+					Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+						ServiceAccountName: restoreHookServiceAccount,
+					}}},
+				}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "job with another service account",
+			hooks: &v1beta1.RestoreHooks{
+				PreRestore: []v1beta1.RestoreHook{{Name: "pre", Job: &batchv1.JobTemplateSpec{
+					Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+						ServiceAccountName: "velero",
+					}}},
+				}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown resource type",
+			hooks: &v1beta1.RestoreHooks{
+				PreRestore: []v1beta1.RestoreHook{{Name: "pre", Job: job, ResourceTypes: []string{"secrets"}}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRestoreHooks(newHooksRestore(tt.hooks)); (err != nil) != tt.wantErr {
+				t.Errorf("validateRestoreHooks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_getRestoreHookJobName(t *testing.T) {
+	restore := newHooksRestore(nil)
+	name := getRestoreHookJobName(restore, "hook", "restore-acm-credentials-schedule-20210910181336")
+	if name == getRestoreHookJobName(restore, "hook", "restore-acm-resources-schedule-20210910181336") {
+		t.Errorf("getRestoreHookJobName() = %s for two velero restores", name)
+	}
+	restore.Name = "a-restore-with-a-very-long-name-which-does-not-fit-in-a-job-name"
+	if name := getRestoreHookJobName(restore, "hook", "velero-restore"); len(name) > maxJobNameLength {
+		t.Errorf("getRestoreHookJobName() = %s, longer than %d", name, maxJobNameLength)
+	}
+}
+
+func Test_runPreRestoreHooks(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(testScheme)
+	_ = v1beta1.AddToScheme(testScheme)
+
+	c := fake.NewClientBuilder().WithScheme(testScheme).Build()
+	r := &RestoreReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(10)}
+
+	newRestore := func() *v1beta1.Restore {
+		return newHooksRestore(&v1beta1.RestoreHooks{
+			PreRestore: []v1beta1.RestoreHook{{
+				Name:          "scale-down",
+				ResourceTypes: []string{string(Resources)},
+				Job:           &batchv1.JobTemplateSpec{},
+			}},
+		})
+	}
+	veleroRestores := map[ResourceType]*veleroapi.Restore{
+		Credentials: {ObjectMeta: metav1.ObjectMeta{Name: "restore-acm-credentials-schedule-20210910181336"}},
+		Resources:   {ObjectMeta: metav1.ObjectMeta{Name: "restore-acm-resources-schedule-20210910181336"}},
+	}
+
+	// the hook jobs are not created without the restore hooks service account
+	restore := newRestore()
+	err := r.runPreRestoreHooks(context.Background(), restore, veleroRestores)
+	if !errors.Is(err, errRestoreHookFailed) {
+		t.Fatalf("runPreRestoreHooks() error = %v, want %v", err, errRestoreHookFailed)
+	}
+	jobs := &batchv1.JobList{}
+	if err := c.List(context.Background(), jobs); err != nil || len(jobs.Items) != 0 {
+		t.Fatalf("hook jobs created without the service account: %v, %v", jobs.Items, err)
+	}
+
+	if err := c.Create(context.Background(), &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: restoreHookServiceAccount, Namespace: restore.Namespace},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	restore = newRestore()
+	err = r.runPreRestoreHooks(context.Background(), restore, veleroRestores)
+	if !errors.Is(err, errRestoreHooksPending) {
+		t.Fatalf("runPreRestoreHooks() error = %v, want %v", err, errRestoreHooksPending)
+	}
+	if len(restore.Status.Hooks) != 1 || restore.Status.Hooks[0].Phase != v1beta1.RestoreHookPhaseRunning {
+		t.Fatalf("runPreRestoreHooks() hooks = %v", restore.Status.Hooks)
+	}
+
+	// the hook job is created once, for the resources velero restore
+	job := &batchv1.Job{}
+	name := types.NamespacedName{Namespace: restore.Namespace, Name: restore.Status.Hooks[0].JobName}
+	if err := c.Get(context.Background(), name, job); err != nil {
+		t.Fatalf("hook job not created: %v", err)
+	}
+	if job.Labels[restoreHookLabel] != "scale-down" {
+		t.Errorf("hook job labels = %v", job.Labels)
+	}
+	if job.Spec.Template.Spec.ServiceAccountName != restoreHookServiceAccount {
+		t.Errorf("hook job service account = %v", job.Spec.Template.Spec.ServiceAccountName)
+	}
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	if err := c.Update(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.runPreRestoreHooks(context.Background(), restore, veleroRestores); err != nil {
+		t.Fatalf("runPreRestoreHooks() error = %v", err)
+	}
+	if restore.Status.Hooks[0].Phase != v1beta1.RestoreHookPhaseSucceeded {
+		t.Errorf("runPreRestoreHooks() phase = %v", restore.Status.Hooks[0].Phase)
+	}
+}
+
+func Test_runPostRestoreHooks(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(testScheme)
+	_ = v1beta1.AddToScheme(testScheme)
+
+	restore := newHooksRestore(&v1beta1.RestoreHooks{
+		PostRestore: []v1beta1.RestoreHook{
+			{Name: "check", Job: &batchv1.JobTemplateSpec{}},
+			{Name: "exec", VeleroHook: &veleroapi.RestoreResourceHookSpec{}},
+		},
+	})
+	veleroRestoreList := &veleroapi.RestoreList{Items: []veleroapi.Restore{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "restore-acm-credentials-schedule-20210910181336"},
+			Spec:       veleroapi.RestoreSpec{BackupName: "acm-credentials-schedule-20210910181336"},
+			Status:     veleroapi.RestoreStatus{Phase: veleroapi.RestorePhaseCompleted},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "restore-acm-resources-schedule-20210910181336"},
+			Spec:       veleroapi.RestoreSpec{BackupName: "acm-resources-schedule-20210910181336"},
+			Status:     veleroapi.RestoreStatus{Phase: veleroapi.RestorePhaseInProgress},
+		},
+	}}
+	failedJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getRestoreHookJobName(restore, "check", veleroRestoreList.Items[0].Name),
+			Namespace: restore.Namespace,
+		},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{
+			Type:    batchv1.JobFailed,
+			Status:  corev1.ConditionTrue,
+			Message: "BackoffLimitExceeded",
+		}}},
+	}
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(failedJob).Build()
+	r := &RestoreReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(10)}
+
+	running, failed, err := r.runPostRestoreHooks(context.Background(), restore, veleroRestoreList)
+	if err != nil {
+		t.Fatalf("runPostRestoreHooks() error = %v", err)
+	}
+	if len(running) != 0 || len(failed) != 1 || failed[0] != "check" {
+		t.Errorf("runPostRestoreHooks() running = %v, failed = %v", running, failed)
+	}
+	// the velero restore still running has no post-restore hook
+	if len(restore.Status.Hooks) != 1 || restore.Status.Hooks[0].CompletionTime == nil {
+		t.Errorf("runPostRestoreHooks() hooks = %v", restore.Status.Hooks)
+	}
+}
+
+func Test_setVeleroRestoreHooks(t *testing.T) {
+	restore := newHooksRestore(&v1beta1.RestoreHooks{
+		PostRestore: []v1beta1.RestoreHook{
+			{Name: "job", Job: &batchv1.JobTemplateSpec{}},
+			{
+				Name:          "exec",
+				ResourceTypes: []string{string(Resources)},
+				VeleroHook:    &veleroapi.RestoreResourceHookSpec{IncludedNamespaces: []string{"app"}},
+			},
+		},
+	})
+
+	credentials := &veleroapi.Restore{ObjectMeta: metav1.ObjectMeta{Name: "credentials"}}
+	if names := setVeleroRestoreHooks(restore, Credentials, credentials); len(names) != 0 {
+		t.Errorf("setVeleroRestoreHooks() = %v for the credentials restore", names)
+	}
+
+	resources := &veleroapi.Restore{ObjectMeta: metav1.ObjectMeta{Name: "resources"}}
+	names := setVeleroRestoreHooks(restore, Resources, resources)
+	if len(resources.Spec.Hooks.Resources) != 1 || resources.Spec.Hooks.Resources[0].Name != "exec" {
+		t.Fatalf("setVeleroRestoreHooks() hooks = %v", resources.Spec.Hooks.Resources)
+	}
+	setVeleroRestoreHooksStatus(restore, names, resources.Name)
+	if len(restore.Status.Hooks) != 1 || restore.Status.Hooks[0].Phase != v1beta1.RestoreHookPhaseAttached {
+		t.Errorf("setVeleroRestoreHooksStatus() hooks = %v", restore.Status.Hooks)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// interval between two progress events while the velero restores are running
+const progressReportInterval = 1 * time.Minute
+
+// aggregates the progress of the velero restores into the restore status;
+// returns true if a velero restore is still running
+func setRestoreProgress(
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+	now time.Time,
+) bool {
+	if veleroRestoreList == nil || len(veleroRestoreList.Items) == 0 {
+		return false
+	}
+
+	totalItems, itemsRestored := 0, 0
+	running := false
+	var startTime *metav1.Time
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		if veleroRestore.Status.Phase == veleroapi.RestorePhaseNew ||
+			veleroRestore.Status.Phase == veleroapi.RestorePhaseInProgress {
+			running = true
+		}
+		if veleroRestore.Status.Progress == nil {
+			// the items to restore are not known yet
+			continue
+		}
+		totalItems += veleroRestore.Status.Progress.TotalItems
+		itemsRestored += veleroRestore.Status.Progress.ItemsRestored
+		if veleroRestore.Status.Phase == veleroapi.RestorePhaseInProgress &&
+			veleroRestore.Status.StartTimestamp != nil &&
+			(startTime == nil || veleroRestore.Status.StartTimestamp.Before(startTime)) {
+			startTime = veleroRestore.Status.StartTimestamp
+		}
+	}
+	if itemsRestored > totalItems {
+		// velero plugins may restore additional items before updating the total
+		totalItems = itemsRestored
+	}
+
+	if restore.Status.Progress == nil {
+		restore.Status.Progress = &v1beta1.RestoreProgress{}
+	}
+	progress := restore.Status.Progress
+	progress.TotalItems = totalItems
+	progress.ItemsRestored = itemsRestored
+	progress.Percentage = 0
+	if totalItems > 0 {
+		progress.Percentage = itemsRestored * 100 / totalItems
+	}
+
+	// estimate the time remaining from the rate of the running velero restores
+	progress.EstimatedTimeRemaining = nil
+	if running && startTime != nil && itemsRestored > 0 && itemsRestored < totalItems {
+		elapsed := now.Sub(startTime.Time)
+		remaining := time.Duration(float64(elapsed) * float64(totalItems-itemsRestored) / float64(itemsRestored))
+		progress.EstimatedTimeRemaining = &metav1.Duration{Duration: remaining.Round(time.Second)}
+	}
+	return running
+}
+
+// returns the progress message reported by the restore events
+func getRestoreProgressMessage(progress *v1beta1.RestoreProgress) string {
+	msg := fmt.Sprintf("%d%% restored, %d of %d items", progress.Percentage, progress.ItemsRestored, progress.TotalItems)
+	if progress.EstimatedTimeRemaining != nil {
+		msg += fmt.Sprintf(", estimated time remaining %s", progress.EstimatedTimeRemaining.Duration)
+	}
+	return msg
+}
+
+// updates the restore progress and emits a progress event at each progressReportInterval
+// while the velero restores are running; returns true if a velero restore is still running
+func (r *RestoreReconciler) reportRestoreProgress(
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+) bool {
+	now := time.Now()
+	if !setRestoreProgress(restore, veleroRestoreList, now) {
+		return false
+	}
+
+	progress := restore.Status.Progress
+	if progress.LastReportTime != nil && now.Sub(progress.LastReportTime.Time) < progressReportInterval {
+		return true
+	}
+	progress.LastReportTime = &metav1.Time{Time: now}
+	r.Recorder.Event(
+		restore,
+		corev1.EventTypeNormal,
+		"Restore progress:",
+		getRestoreProgressMessage(progress),
+	)
+	return true
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func newProgressVeleroRestore(
+	phase veleroapi.RestorePhase,
+	startTime *metav1.Time,
+	progress *veleroapi.RestoreProgress,
+) veleroapi.Restore {
+	return veleroapi.Restore{Status: veleroapi.RestoreStatus{
+		Phase:          phase,
+		StartTimestamp: startTime,
+		Progress:       progress,
+	}}
+}
+
+func Test_setRestoreProgress(t *testing.T) {
+	now := time.Now()
+	startTime := &metav1.Time{Time: now.Add(-10 * time.Minute)}
+
+	tests := []struct {
+		name           string
+		veleroRestores []veleroapi.Restore
+		wantRunning    bool
+		wantProgress   v1beta1.RestoreProgress
+		wantRemaining  time.Duration
+	}{
+		{
+			name: "velero restores running",
+			veleroRestores: []veleroapi.Restore{
+				newProgressVeleroRestore(veleroapi.RestorePhaseCompleted, &metav1.Time{Time: now.Add(-time.Hour)},
+					&veleroapi.RestoreProgress{TotalItems: 100, ItemsRestored: 100}),
+				newProgressVeleroRestore(veleroapi.RestorePhaseInProgress, startTime,
+					&veleroapi.RestoreProgress{TotalItems: 300, ItemsRestored: 100}),
+				newProgressVeleroRestore(veleroapi.RestorePhaseNew, nil, nil),
+			},
+			wantRunning:   true,
+			wantProgress:  v1beta1.RestoreProgress{TotalItems: 400, ItemsRestored: 200, Percentage: 50},
+			wantRemaining: 10 * time.Minute,
+		},
+		{
+			name: "velero restores completed",
+			veleroRestores: []veleroapi.Restore{
+				newProgressVeleroRestore(veleroapi.RestorePhaseCompleted, startTime,
+					&veleroapi.RestoreProgress{TotalItems: 100, ItemsRestored: 100}),
+				newProgressVeleroRestore(veleroapi.RestorePhasePartiallyFailed, startTime,
+					&veleroapi.RestoreProgress{TotalItems: 100, ItemsRestored: 90}),
+			},
+			wantRunning:  false,
+			wantProgress: v1beta1.RestoreProgress{TotalItems: 200, ItemsRestored: 190, Percentage: 95},
+		},
+		{
+			name: "items to restore not known yet",
+			veleroRestores: []veleroapi.Restore{
+				newProgressVeleroRestore(veleroapi.RestorePhaseInProgress, startTime, nil),
+			},
+			wantRunning:  true,
+			wantProgress: v1beta1.RestoreProgress{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restore := &v1beta1.Restore{}
+			running := setRestoreProgress(restore, &veleroapi.RestoreList{Items: tt.veleroRestores}, now)
+			if running != tt.wantRunning {
+				t.Errorf("setRestoreProgress() = %v, want %v", running, tt.wantRunning)
+			}
+			progress := restore.Status.Progress
+			if progress.TotalItems != tt.wantProgress.TotalItems ||
+				progress.ItemsRestored != tt.wantProgress.ItemsRestored ||
+				progress.Percentage != tt.wantProgress.Percentage {
+				t.Errorf("setRestoreProgress() progress = %v, want %v", progress, tt.wantProgress)
+			}
+			remaining := time.Duration(0)
+			if progress.EstimatedTimeRemaining != nil {
+				remaining = progress.EstimatedTimeRemaining.Duration
+			}
+			if remaining != tt.wantRemaining {
+				t.Errorf("setRestoreProgress() estimated time remaining = %s, want %s", remaining, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func Test_reportRestoreProgress(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &RestoreReconciler{Recorder: recorder}
+	restore := &v1beta1.Restore{}
+	veleroRestoreList := &veleroapi.RestoreList{Items: []veleroapi.Restore{
+		newProgressVeleroRestore(veleroapi.RestorePhaseInProgress, &metav1.Time{Time: time.Now()},
+			&veleroapi.RestoreProgress{TotalItems: 10, ItemsRestored: 0}),
+	}}
+
+	if !r.reportRestoreProgress(restore, veleroRestoreList) {
+		t.Fatalf("reportRestoreProgress() = false for a running velero restore")
+	}
+	if len(recorder.Events) != 1 || restore.Status.Progress.LastReportTime == nil {
+		t.Fatalf("reportRestoreProgress() events = %d, progress = %v", len(recorder.Events), restore.Status.Progress)
+	}
+
+	// no new event before the report interval
+	r.reportRestoreProgress(restore, veleroRestoreList)
+	if len(recorder.Events) != 1 {
+		t.Errorf("reportRestoreProgress() events = %d, want 1", len(recorder.Events))
+	}
+
+	restore.Status.Progress.LastReportTime.Time = time.Now().Add(-progressReportInterval)
+	r.reportRestoreProgress(restore, veleroRestoreList)
+	if len(recorder.Events) != 2 {
+		t.Errorf("reportRestoreProgress() events = %d, want 2", len(recorder.Events))
+	}
+}
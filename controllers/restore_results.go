@@ -0,0 +1,216 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// maximum number of lines in the summary of a velero restore results
+	maxRestoreResultsSummary = 20
+	// maximum length of a sample message in the summary of a velero restore results
+	maxRestoreResultsMessage = 200
+)
+
+// matches the velero warning reported for resources already existing on the hub
+var alreadyExistsRegexp = regexp.MustCompile(`could not restore, (\S+) "[^"]*" already exists`)
+
+// veleroRestoreResult mirrors the warnings or errors of a velero restore,
+// as stored by velero in the backup storage location
+type veleroRestoreResult struct {
+	Velero     []string            `json:"velero,omitempty"`
+	Cluster    []string            `json:"cluster,omitempty"`
+	Namespaces map[string][]string `json:"namespaces,omitempty"`
+}
+
+// summarizeRestoreResults groups the velero restore warnings and errors
+// by namespace and lists the kinds of resources that already existed on the hub
+func summarizeRestoreResults(results map[string]veleroRestoreResult) []string {
+	summary := []string{}
+
+	for _, resultType := range []string{"errors", "warnings"} {
+		result, ok := results[resultType]
+		if !ok {
+			continue
+		}
+
+		alreadyExists := map[string]int{}
+		scopes := map[string][]string{
+			"velero":  result.Velero,
+			"cluster": result.Cluster,
+		}
+		for namespace, messages := range result.Namespaces {
+			scopes["namespace "+namespace] = messages
+		}
+
+		scopeNames := make([]string, 0, len(scopes))
+		for scope := range scopes {
+			scopeNames = append(scopeNames, scope)
+		}
+		sort.Strings(scopeNames)
+
+		for _, scope := range scopeNames {
+			other := []string{}
+			for _, msg := range scopes[scope] {
+				if match := alreadyExistsRegexp.FindStringSubmatch(msg); match != nil {
+					alreadyExists[match[1]]++
+					continue
+				}
+				other = append(other, msg)
+			}
+			if len(other) == 0 {
+				continue
+			}
+			sample := other[0]
+			if len(sample) > maxRestoreResultsMessage {
+				sample = sample[:maxRestoreResultsMessage] + "..."
+			}
+			summary = append(summary, fmt.Sprintf(
+				"%d %s in %s, first: %s",
+				len(other),
+				resultType,
+				scope,
+				sample,
+			))
+		}
+
+		if len(alreadyExists) > 0 {
+			kinds := make([]string, 0, len(alreadyExists))
+			for kind, count := range alreadyExists {
+				kinds = append(kinds, fmt.Sprintf("%s (%d)", kind, count))
+			}
+			sort.Strings(kinds)
+			summary = append(summary, fmt.Sprintf(
+				"%s for resources that already exist: %s",
+				resultType,
+				strings.Join(kinds, ", "),
+			))
+		}
+	}
+
+	if len(summary) > maxRestoreResultsSummary {
+		more := len(summary) - maxRestoreResultsSummary + 1
+		summary = append(
+			summary[:maxRestoreResultsSummary-1],
+			fmt.Sprintf("... and %d more", more),
+		)
+	}
+	return summary
+}
+
+// returns the result of the velero restore with this name, if set in the restore status
+func findVeleroRestoreResult(restore *v1beta1.Restore, name string) *v1beta1.VeleroRestoreResult {
+	for i := range restore.Status.VeleroRestoreResults {
+		if restore.Status.VeleroRestoreResults[i].VeleroRestoreName == name {
+			return &restore.Status.VeleroRestoreResults[i]
+		}
+	}
+	return nil
+}
+
+// set the warnings and errors of all finished velero restores in the restore status
+// returns true if the detailed results for some velero restore are not yet available
+func (r *RestoreReconciler) setRestoreResults(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+) bool {
+	restoreLogger := log.FromContext(ctx)
+	waitingForResults := false
+
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		if !isVeleroRestoreFinished(veleroRestore) ||
+			findVeleroRestoreResult(restore, veleroRestore.Name) != nil {
+			continue
+		}
+
+		result := v1beta1.VeleroRestoreResult{
+			VeleroRestoreName: veleroRestore.Name,
+			Warnings:          veleroRestore.Status.Warnings,
+			Errors:            veleroRestore.Status.Errors,
+			FailureReason:     veleroRestore.Status.FailureReason,
+		}
+		for _, validationError := range veleroRestore.Status.ValidationErrors {
+			result.Summary = append(result.Summary, "validation error: "+validationError)
+		}
+
+		if result.Warnings > 0 || result.Errors > 0 {
+			results := map[string]veleroRestoreResult{}
+			err := downloadVeleroFile(
+				ctx,
+				r.Client,
+				veleroRestore.Namespace,
+				veleroRestore.Name,
+				veleroapi.DownloadTargetKindRestoreResults,
+				decodeJSON(&results),
+			)
+			if errors.Is(err, errDownloadNotReady) {
+				waitingForResults = true
+				continue
+			}
+			if err != nil {
+				restoreLogger.Error(
+					err,
+					"unable to get velero restore results",
+					"name", veleroRestore.Name,
+					"namespace", veleroRestore.Namespace,
+				)
+				result.Summary = append(
+					result.Summary,
+					fmt.Sprintf("detailed results not available: %v", err),
+				)
+			} else {
+				result.Summary = append(result.Summary, summarizeRestoreResults(results)...)
+			}
+		}
+
+		restore.Status.VeleroRestoreResults = append(restore.Status.VeleroRestoreResults, result)
+
+		if result.Warnings > 0 || result.Errors > 0 || result.FailureReason != "" {
+			details := result.Summary
+			if result.FailureReason != "" {
+				details = append([]string{result.FailureReason}, details...)
+			}
+			r.Recorder.Event(
+				restore,
+				v1.EventTypeWarning,
+				"Velero restore finished with issues:",
+				fmt.Sprintf(
+					"%s: %d errors, %d warnings. %s",
+					veleroRestore.Name,
+					result.Errors,
+					result.Warnings,
+					strings.Join(details, "; "),
+				),
+			)
+		}
+	}
+
+	return waitingForResults
+}
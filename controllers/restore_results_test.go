@@ -0,0 +1,72 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_summarizeRestoreResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		results map[string]veleroRestoreResult
+		want    []string
+	}{
+		{
+			name:    "No results",
+			results: map[string]veleroRestoreResult{},
+			want:    []string{},
+		},
+		{
+			name: "Errors and already existing resources",
+			results: map[string]veleroRestoreResult{
+				"errors": {
+					Namespaces: map[string][]string{
+						"ns2": {"error restoring channels/ns2/c1: forbidden"},
+						"ns1": {"error restoring secrets/ns1/s1: invalid", "error restoring secrets/ns1/s2"},
+					},
+				},
+				"warnings": {
+					Cluster: []string{
+						`could not restore, managedclusters.cluster.open-cluster-management.io "c1" already exists. ` +
+							`Warning: the in-cluster version is different than the backed-up version.`,
+					},
+					Namespaces: map[string][]string{
+						"ns1": {
+							`could not restore, secrets "s3" already exists. Warning: ...`,
+							`could not restore, secrets "s4" already exists. Warning: ...`,
+						},
+					},
+				},
+			},
+			want: []string{
+				"2 errors in namespace ns1, first: error restoring secrets/ns1/s1: invalid",
+				"1 errors in namespace ns2, first: error restoring channels/ns2/c1: forbidden",
+				"warnings for resources that already exist: " +
+					"managedclusters.cluster.open-cluster-management.io (1), secrets (2)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarizeRestoreResults(tt.results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("summarizeRestoreResults() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
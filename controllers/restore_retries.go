@@ -0,0 +1,248 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// annotation set on the velero restores created to retry a failed velero restore, with the attempt number
+	restoreAttemptAnnotation = "cluster.open-cluster-management.io/restore-attempt"
+	// default max number of times a velero restore is run
+	defaultRestoreMaxAttempts = 3
+	// default time to wait before the first retry of a failed velero restore
+	defaultRestoreRetryBackoff = 1 * time.Minute
+	// max time to wait before a retry
+	maxRestoreRetryBackoff = 1 * time.Hour
+)
+
+// returns the max number of times a velero restore is run
+func getRestoreMaxAttempts(policy *v1beta1.RestoreRetryPolicy) int {
+	if policy.MaxAttempts <= 0 {
+		return defaultRestoreMaxAttempts
+	}
+	return policy.MaxAttempts
+}
+
+// returns the time to wait before retrying a velero restore which failed at the attempt,
+// doubled for each attempt
+func getRestoreRetryBackoff(policy *v1beta1.RestoreRetryPolicy, attempt int) time.Duration {
+	backoff := policy.Backoff.Duration
+	if backoff <= 0 {
+		backoff = defaultRestoreRetryBackoff
+	}
+	for i := 1; i < attempt && backoff < maxRestoreRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRestoreRetryBackoff {
+		return maxRestoreRetryBackoff
+	}
+	return backoff
+}
+
+// returns the attempt number of the velero restore, the velero restores created on initialization are the first attempt
+func getVeleroRestoreAttempt(veleroRestore *veleroapi.Restore) int {
+	attempt, err := strconv.Atoi(veleroRestore.Annotations[restoreAttemptAnnotation])
+	if err != nil || attempt < 1 {
+		return 1
+	}
+	return attempt
+}
+
+// returns true if the velero restore failed validation or failed
+func isVeleroRestoreFailed(veleroRestore *veleroapi.Restore) bool {
+	return veleroRestore.Status.Phase == veleroapi.RestorePhaseFailed ||
+		veleroRestore.Status.Phase == veleroapi.RestorePhaseFailedValidation
+}
+
+// returns the name of the velero restore retrying the restore of the backup
+func getRetryVeleroRestoreName(restoreName string, backupName string, attempt int) string {
+	suffix := fmt.Sprintf("-retry-%d", attempt)
+	name := getValidKsRestoreName(restoreName, backupName)
+	if len(name) > 252-len(suffix) {
+		name = name[:252-len(suffix)]
+	}
+	return name + suffix
+}
+
+// returns the reason reported by velero for a failed velero restore
+func getVeleroRestoreFailureReason(veleroRestore *veleroapi.Restore) string {
+	if veleroRestore.Status.FailureReason != "" {
+		return veleroRestore.Status.FailureReason
+	}
+	return strings.Join(veleroRestore.Status.ValidationErrors, "; ")
+}
+
+// returns the attempt of the velero restore in the restore status, nil if not found
+func findVeleroRestoreAttempt(restore *v1beta1.Restore, veleroRestoreName string) *v1beta1.VeleroRestoreAttempt {
+	for i := range restore.Status.VeleroRestoreAttempts {
+		if restore.Status.VeleroRestoreAttempts[i].VeleroRestoreName == veleroRestoreName {
+			return &restore.Status.VeleroRestoreAttempts[i]
+		}
+	}
+	return nil
+}
+
+// records the velero restores attempts in the restore status
+func setVeleroRestoreAttempts(restore *v1beta1.Restore, veleroRestoreList *veleroapi.RestoreList) {
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		attempt := findVeleroRestoreAttempt(restore, veleroRestore.Name)
+		if attempt == nil {
+			restore.Status.VeleroRestoreAttempts = append(restore.Status.VeleroRestoreAttempts,
+				v1beta1.VeleroRestoreAttempt{
+					VeleroRestoreName: veleroRestore.Name,
+					BackupName:        veleroRestore.Spec.BackupName,
+					Attempt:           getVeleroRestoreAttempt(veleroRestore),
+				})
+			attempt = &restore.Status.VeleroRestoreAttempts[len(restore.Status.VeleroRestoreAttempts)-1]
+		}
+		attempt.Phase = veleroRestore.Status.Phase
+		attempt.CompletionTime = veleroRestore.Status.CompletionTimestamp
+		attempt.FailureReason = ""
+		if isVeleroRestoreFailed(veleroRestore) {
+			attempt.FailureReason = getVeleroRestoreFailureReason(veleroRestore)
+		}
+	}
+}
+
+// creates a velero restore running again the failed velero restore
+func (r *RestoreReconciler) createRetryVeleroRestore(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	failedVeleroRestore *veleroapi.Restore,
+	attempt int,
+) error {
+	veleroRestore := &veleroapi.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        getRetryVeleroRestoreName(getRestoreRunName(restore), failedVeleroRestore.Spec.BackupName, attempt),
+			Namespace:   failedVeleroRestore.Namespace,
+			Labels:      failedVeleroRestore.Labels,
+			Annotations: map[string]string{restoreAttemptAnnotation: strconv.Itoa(attempt)},
+		},
+		Spec: *failedVeleroRestore.Spec.DeepCopy(),
+	}
+	veleroRestore.Spec.Hooks = veleroapi.RestoreHooks{}
+	veleroHooks := []string{}
+	if key, ok := getVeleroRestoreResourceType(veleroRestore); ok {
+		veleroHooks = setVeleroRestoreHooks(restore, key, veleroRestore)
+	}
+	if err := ctrl.SetControllerReference(restore, veleroRestore, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, veleroRestore); err != nil {
+		return err
+	}
+
+	r.Recorder.Event(
+		restore,
+		corev1.EventTypeNormal,
+		"Velero restore retried:",
+		fmt.Sprintf("%s failed, created %s for attempt %d", failedVeleroRestore.Name, veleroRestore.Name, attempt),
+	)
+	setVeleroRestoreHooksStatus(restore, veleroHooks, veleroRestore.Name)
+	restore.Status.VeleroRestoreAttempts = append(restore.Status.VeleroRestoreAttempts, v1beta1.VeleroRestoreAttempt{
+		VeleroRestoreName: veleroRestore.Name,
+		BackupName:        veleroRestore.Spec.BackupName,
+		Attempt:           attempt,
+	})
+
+	switch failedVeleroRestore.Name {
+	case restore.Status.VeleroManagedClustersRestoreName:
+		restore.Status.VeleroManagedClustersRestoreName = veleroRestore.Name
+	case restore.Status.VeleroCredentialsRestoreName:
+		restore.Status.VeleroCredentialsRestoreName = veleroRestore.Name
+	case restore.Status.VeleroResourcesRestoreName:
+		restore.Status.VeleroResourcesRestoreName = veleroRestore.Name
+	}
+	return nil
+}
+
+// creates again the failed velero restores according to the retry policy, keeping the velero restores
+// which succeeded. Returns the velero restores reporting the restore phase, without the failed velero
+// restores retried or to be retried, the failed velero restores being retried and the time left
+// before the next retry
+func (r *RestoreReconciler) retryFailedVeleroRestores(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+) (*veleroapi.RestoreList, []string, time.Duration, error) {
+	restoreLogger := log.FromContext(ctx)
+
+	policy := restore.Spec.RetryPolicy
+	if policy == nil {
+		return veleroRestoreList, nil, 0, nil
+	}
+	setVeleroRestoreAttempts(restore, veleroRestoreList)
+
+	// the latest attempt to restore each backup
+	latestAttempts := map[string]*veleroapi.Restore{}
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		latest, ok := latestAttempts[veleroRestore.Spec.BackupName]
+		if !ok || getVeleroRestoreAttempt(veleroRestore) > getVeleroRestoreAttempt(latest) {
+			latestAttempts[veleroRestore.Spec.BackupName] = veleroRestore
+		}
+	}
+
+	now := time.Now()
+	activeVeleroRestores := &veleroapi.RestoreList{}
+	retrying := []string{}
+	nextRetry := time.Duration(0)
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		if latestAttempts[veleroRestore.Spec.BackupName] != veleroRestore {
+			// replaced by a new attempt
+			continue
+		}
+		attempt := getVeleroRestoreAttempt(veleroRestore)
+		if !isVeleroRestoreFailed(veleroRestore) || attempt >= getRestoreMaxAttempts(policy) {
+			activeVeleroRestores.Items = append(activeVeleroRestores.Items, *veleroRestore)
+			continue
+		}
+
+		retrying = append(retrying, veleroRestore.Name)
+		failureTime := veleroRestore.CreationTimestamp.Time
+		if veleroRestore.Status.CompletionTimestamp != nil {
+			failureTime = veleroRestore.Status.CompletionTimestamp.Time
+		}
+		if delay := failureTime.Add(getRestoreRetryBackoff(policy, attempt)).Sub(now); delay > 0 {
+			if nextRetry == 0 || delay < nextRetry {
+				nextRetry = delay
+			}
+			continue
+		}
+
+		restoreLogger.Info("retrying failed velero restore", "name", veleroRestore.Name, "attempt", attempt+1)
+		if err := r.createRetryVeleroRestore(ctx, restore, veleroRestore, attempt+1); err != nil {
+			return veleroRestoreList, nil, 0, err
+		}
+	}
+	return activeVeleroRestores, retrying, nextRetry, nil
+}
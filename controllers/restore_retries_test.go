@@ -0,0 +1,146 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_getRestoreRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  v1beta1.RestoreRetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{
+			name:    "default backoff",
+			attempt: 1,
+			want:    defaultRestoreRetryBackoff,
+		},
+		{
+			name:    "doubled for each attempt",
+			policy:  v1beta1.RestoreRetryPolicy{Backoff: metav1.Duration{Duration: 5 * time.Minute}},
+			attempt: 3,
+			want:    20 * time.Minute,
+		},
+		{
+			name:    "max backoff",
+			policy:  v1beta1.RestoreRetryPolicy{Backoff: metav1.Duration{Duration: 5 * time.Minute}},
+			attempt: 10,
+			want:    maxRestoreRetryBackoff,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getRestoreRetryBackoff(&tt.policy, tt.attempt); got != tt.want {
+				t.Errorf("getRestoreRetryBackoff() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_retryFailedVeleroRestores(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = veleroapi.AddToScheme(testScheme)
+	_ = v1beta1.AddToScheme(testScheme)
+
+	c := fake.NewClientBuilder().WithScheme(testScheme).Build()
+	r := &RestoreReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(10)}
+
+	restore := &v1beta1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "velero-ns"},
+		Spec: v1beta1.RestoreSpec{RetryPolicy: &v1beta1.RestoreRetryPolicy{
+			MaxAttempts: 2,
+			Backoff:     metav1.Duration{Duration: time.Minute},
+		}},
+	}
+	resourcesBackup := veleroScheduleNames[Resources] + "-20210910181336"
+	restore.Status.VeleroResourcesRestoreName = getValidKsRestoreName(restore.Name, resourcesBackup)
+
+	newVeleroRestore := func(backupName string, phase veleroapi.RestorePhase, completionTime time.Time) veleroapi.Restore {
+		return veleroapi.Restore{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              getValidKsRestoreName(restore.Name, backupName),
+				Namespace:         restore.Namespace,
+				CreationTimestamp: metav1.Time{Time: completionTime},
+			},
+			Spec: veleroapi.RestoreSpec{BackupName: backupName},
+			Status: veleroapi.RestoreStatus{
+				Phase:               phase,
+				FailureReason:       "failed",
+				CompletionTimestamp: &metav1.Time{Time: completionTime},
+			},
+		}
+	}
+	now := time.Now()
+	veleroRestoreList := &veleroapi.RestoreList{Items: []veleroapi.Restore{
+		newVeleroRestore(veleroScheduleNames[Credentials]+"-20210910181336", veleroapi.RestorePhaseCompleted, now),
+		newVeleroRestore(resourcesBackup, veleroapi.RestorePhaseFailed, now.Add(-2*time.Minute)),
+		newVeleroRestore(veleroScheduleNames[ManagedClusters]+"-20210910181336", veleroapi.RestorePhaseFailedValidation, now),
+	}}
+
+	active, retrying, nextRetry, err := r.retryFailedVeleroRestores(context.Background(), restore, veleroRestoreList)
+	if err != nil {
+		t.Fatalf("retryFailedVeleroRestores() error = %v", err)
+	}
+	if len(active.Items) != 1 || len(retrying) != 2 {
+		t.Errorf("retryFailedVeleroRestores() active = %d, retrying = %v", len(active.Items), retrying)
+	}
+	if nextRetry <= 0 || nextRetry > time.Minute {
+		t.Errorf("retryFailedVeleroRestores() next retry = %s", nextRetry)
+	}
+
+	// the resources velero restore failed before the backoff and is created again
+	retryName := getRetryVeleroRestoreName(restore.Name, resourcesBackup, 2)
+	retry := &veleroapi.Restore{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: restore.Namespace, Name: retryName}, retry); err != nil {
+		t.Fatalf("velero restore not retried: %v", err)
+	}
+	if retry.Spec.BackupName != resourcesBackup || getVeleroRestoreAttempt(retry) != 2 {
+		t.Errorf("retried velero restore = %v", retry)
+	}
+	if restore.Status.VeleroResourcesRestoreName != retryName {
+		t.Errorf("retryFailedVeleroRestores() resources restore name = %s", restore.Status.VeleroResourcesRestoreName)
+	}
+	if len(restore.Status.VeleroRestoreAttempts) != 4 ||
+		restore.Status.VeleroRestoreAttempts[1].FailureReason != "failed" {
+		t.Errorf("retryFailedVeleroRestores() attempts = %v", restore.Status.VeleroRestoreAttempts)
+	}
+
+	// no retry left once the max attempts are reached
+	retry.Status.Phase = veleroapi.RestorePhaseFailed
+	veleroRestoreList.Items = append(veleroRestoreList.Items, *retry)
+	veleroRestoreList.Items[2].Status.CompletionTimestamp = &metav1.Time{Time: now.Add(-time.Hour)}
+	active, retrying, _, err = r.retryFailedVeleroRestores(context.Background(), restore, veleroRestoreList)
+	if err != nil {
+		t.Fatalf("retryFailedVeleroRestores() error = %v", err)
+	}
+	if len(active.Items) != 2 || active.Items[1].Name != retryName || len(retrying) != 1 {
+		t.Errorf("retryFailedVeleroRestores() active = %v, retrying = %v", active.Items, retrying)
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// annotation set on a restore to run it again, a new run starts each time the value changes
+	rerunAnnotation = "cluster.open-cluster-management.io/rerun"
+	// label set on the velero restores with the number of the restore run which created them
+	restoreRunLabel = "cluster.open-cluster-management.io/restore-run"
+	// default number of previous runs kept for a restore
+	defaultRunHistoryLimit = 3
+)
+
+// returns the number of the current run of the restore
+func getRestoreRun(restore *v1beta1.Restore) int {
+	if restore.Status.Run < 1 {
+		return 1
+	}
+	return restore.Status.Run
+}
+
+// returns the number of previous runs kept for the restore
+func getRunHistoryLimit(restore *v1beta1.Restore) int {
+	if restore.Spec.RunHistoryLimit == nil || *restore.Spec.RunHistoryLimit < 0 {
+		return defaultRunHistoryLimit
+	}
+	return *restore.Spec.RunHistoryLimit
+}
+
+// returns the name used for the velero restores of the current run of the restore;
+// the first run uses the restore name, for compatibility with the existing velero restores
+func getRestoreRunName(restore *v1beta1.Restore) string {
+	if run := getRestoreRun(restore); run > 1 {
+		return fmt.Sprintf("%s-run-%d", restore.Name, run)
+	}
+	return restore.Name
+}
+
+// returns the number of the restore run which created the velero restore,
+// the velero restores created without the run label belong to the first run
+func getVeleroRestoreRun(veleroRestore *veleroapi.Restore) int {
+	run, err := strconv.Atoi(veleroRestore.Labels[restoreRunLabel])
+	if err != nil || run < 1 {
+		return 1
+	}
+	return run
+}
+
+// sets the run label on a velero restore created by the current run of the restore
+func setVeleroRestoreRun(restore *v1beta1.Restore, veleroRestore *veleroapi.Restore) {
+	if veleroRestore.Labels == nil {
+		veleroRestore.Labels = map[string]string{}
+	}
+	veleroRestore.Labels[restoreRunLabel] = strconv.Itoa(getRestoreRun(restore))
+}
+
+// returns the velero restores reported in the restore status for the current run
+func getRestoreRunVeleroRestores(restore *v1beta1.Restore) []string {
+	veleroRestores := []string{}
+	for _, name := range []string{
+		restore.Status.VeleroManagedClustersRestoreName,
+		restore.Status.VeleroCredentialsRestoreName,
+		restore.Status.VeleroResourcesRestoreName,
+	} {
+		if name != "" && !findValue(veleroRestores, name) {
+			veleroRestores = append(veleroRestores, name)
+		}
+	}
+	for i := range restore.Status.VeleroRestoreAttempts {
+		name := restore.Status.VeleroRestoreAttempts[i].VeleroRestoreName
+		if !findValue(veleroRestores, name) {
+			veleroRestores = append(veleroRestores, name)
+		}
+	}
+	return veleroRestores
+}
+
+// returns the reason to start a new run of the restore, empty if the current run goes on.
+// The spec updates of a restore syncing with new backups don't start a new run,
+// the managed clusters of such a restore are activated with a spec update
+func getRestoreRerunReason(restore *v1beta1.Restore) string {
+	if restore.Annotations[rerunAnnotation] != restore.Status.ObservedRerun {
+		return fmt.Sprintf("%s annotation set to %q", rerunAnnotation, restore.Annotations[rerunAnnotation])
+	}
+	if restore.Generation != restore.Status.ObservedGeneration && !restore.Spec.SyncRestoreWithNewBackups {
+		return fmt.Sprintf("spec updated to generation %d", restore.Generation)
+	}
+	return ""
+}
+
+// starts a new run of the restore when the spec is updated or the rerun annotation is set to a new value,
+// keeping the outcome of the current run in the restore status. Returns true if a new run started
+func (r *RestoreReconciler) startRestoreRun(ctx context.Context, restore *v1beta1.Restore) bool {
+	restoreLogger := log.FromContext(ctx)
+
+	if restore.Status.ObservedGeneration == 0 {
+		// first reconcile of the restore, or restore created with an older controller version
+		restore.Status.Run = getRestoreRun(restore)
+		restore.Status.ObservedGeneration = restore.Generation
+		restore.Status.ObservedRerun = restore.Annotations[rerunAnnotation]
+		return false
+	}
+
+	reason := getRestoreRerunReason(restore)
+	if reason == "" {
+		restore.Status.ObservedGeneration = restore.Generation
+		return false
+	}
+
+	endTime := metav1.Now()
+	previousRuns := append(restore.Status.PreviousRuns, v1beta1.RestoreRun{
+		Run:            getRestoreRun(restore),
+		Generation:     restore.Status.ObservedGeneration,
+		Phase:          restore.Status.Phase,
+		LastMessage:    restore.Status.LastMessage,
+		VeleroRestores: getRestoreRunVeleroRestores(restore),
+		EndTime:        &endTime,
+	})
+	if limit := getRunHistoryLimit(restore); len(previousRuns) > limit {
+		previousRuns = previousRuns[len(previousRuns)-limit:]
+	}
+
+	restore.Status = v1beta1.RestoreStatus{
+		Run:                getRestoreRun(restore) + 1,
+		ObservedGeneration: restore.Generation,
+		ObservedRerun:      restore.Annotations[rerunAnnotation],
+		PreviousRuns:       previousRuns,
+	}
+	msg := fmt.Sprintf("run %d started, %s", restore.Status.Run, reason)
+	restoreLogger.Info(msg)
+	r.Recorder.Event(restore, corev1.EventTypeNormal, "Restore run started:", msg)
+	return true
+}
+
+// deletes the velero restores of the runs older than the run history limit and returns
+// the velero restores of the current run of the restore
+func (r *RestoreReconciler) pruneRestoreRuns(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+) (*veleroapi.RestoreList, error) {
+	restoreLogger := log.FromContext(ctx)
+
+	run := getRestoreRun(restore)
+	oldestRun := run - getRunHistoryLimit(restore)
+	currentVeleroRestores := &veleroapi.RestoreList{}
+	deleted := []string{}
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		veleroRestoreRun := getVeleroRestoreRun(veleroRestore)
+		if veleroRestoreRun == run {
+			currentVeleroRestores.Items = append(currentVeleroRestores.Items, *veleroRestore)
+			continue
+		}
+		if veleroRestoreRun >= oldestRun {
+			// kept with the run history
+			continue
+		}
+		restoreLogger.Info("deleting velero restore of a previous run", "name", veleroRestore.Name)
+		if err := r.Delete(ctx, veleroRestore); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		deleted = append(deleted, veleroRestore.Name)
+	}
+	if len(deleted) > 0 {
+		r.Recorder.Event(
+			restore,
+			corev1.EventTypeNormal,
+			"Previous runs pruned:",
+			fmt.Sprintf("deleted velero restores %s", strings.Join(deleted, ", ")),
+		)
+	}
+	return currentVeleroRestores, nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_startRestoreRun(t *testing.T) {
+	newRestore := func(generation int64, rerun string, sync bool) *v1beta1.Restore {
+		return &v1beta1.Restore{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "restore",
+				Namespace:   "velero-ns",
+				Generation:  generation,
+				Annotations: map[string]string{rerunAnnotation: rerun},
+			},
+			Spec: v1beta1.RestoreSpec{SyncRestoreWithNewBackups: sync},
+			Status: v1beta1.RestoreStatus{
+				Run:                        2,
+				ObservedGeneration:         1,
+				ObservedRerun:              "1",
+				Phase:                      v1beta1.RestorePhaseFinished,
+				VeleroResourcesRestoreName: "restore-run-2-acm-resources-schedule-20210910181336",
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		restore *v1beta1.Restore
+		want    bool
+		wantRun int
+	}{
+		{
+			name: "first reconcile",
+			restore: &v1beta1.Restore{ObjectMeta: metav1.ObjectMeta{
+				Name:       "restore",
+				Generation: 4,
+			}},
+			want:    false,
+			wantRun: 1,
+		},
+		{
+			name:    "nothing changed",
+			restore: newRestore(1, "1", false),
+			want:    false,
+			wantRun: 2,
+		},
+		{
+			name:    "spec updated",
+			restore: newRestore(2, "1", false),
+			want:    true,
+			wantRun: 3,
+		},
+		{
+			name:    "rerun annotation updated",
+			restore: newRestore(1, "2", false),
+			want:    true,
+			wantRun: 3,
+		},
+		{
+			name:    "spec of a sync restore updated",
+			restore: newRestore(2, "1", true),
+			want:    false,
+			wantRun: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RestoreReconciler{Recorder: record.NewFakeRecorder(10)}
+			if got := r.startRestoreRun(context.Background(), tt.restore); got != tt.want {
+				t.Errorf("startRestoreRun() = %v, want %v", got, tt.want)
+			}
+			if tt.restore.Status.Run != tt.wantRun {
+				t.Errorf("startRestoreRun() run = %d, want %d", tt.restore.Status.Run, tt.wantRun)
+			}
+			if tt.restore.Status.ObservedGeneration != tt.restore.Generation {
+				t.Errorf("startRestoreRun() observed generation = %d", tt.restore.Status.ObservedGeneration)
+			}
+			if !tt.want {
+				return
+			}
+			if tt.restore.Status.Phase != "" || tt.restore.Status.VeleroResourcesRestoreName != "" {
+				t.Errorf("startRestoreRun() status not reset: %v", tt.restore.Status)
+			}
+			previousRuns := tt.restore.Status.PreviousRuns
+			if len(previousRuns) != 1 || previousRuns[0].Run != 2 ||
+				previousRuns[0].Phase != v1beta1.RestorePhaseFinished || len(previousRuns[0].VeleroRestores) != 1 {
+				t.Errorf("startRestoreRun() previous runs = %v", previousRuns)
+			}
+		})
+	}
+}
+
+func Test_pruneRestoreRuns(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = veleroapi.AddToScheme(testScheme)
+
+	newVeleroRestore := func(name string, run string) *veleroapi.Restore {
+		veleroRestore := &veleroapi.Restore{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "velero-ns"}}
+		if run != "" {
+			veleroRestore.Labels = map[string]string{restoreRunLabel: run}
+		}
+		return veleroRestore
+	}
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		newVeleroRestore("restore-acm-resources-schedule-20210910181336", ""),
+		newVeleroRestore("restore-run-2-acm-resources-schedule-20210910181336", "2"),
+		newVeleroRestore("restore-run-3-acm-resources-schedule-20210910181336", "3"),
+		newVeleroRestore("restore-run-4-acm-resources-schedule-20210910181336", "4"),
+	).Build()
+	veleroRestoreList := &veleroapi.RestoreList{}
+	if err := c.List(context.Background(), veleroRestoreList); err != nil {
+		t.Fatal(err)
+	}
+
+	limit := 1
+	restore := &v1beta1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "velero-ns"},
+		Spec:       v1beta1.RestoreSpec{RunHistoryLimit: &limit},
+		Status:     v1beta1.RestoreStatus{Run: 4},
+	}
+	if name := getRestoreRunName(restore); name != "restore-run-4" {
+		t.Errorf("getRestoreRunName() = %s", name)
+	}
+	r := &RestoreReconciler{Client: c, Recorder: record.NewFakeRecorder(10)}
+
+	current, err := r.pruneRestoreRuns(context.Background(), restore, veleroRestoreList)
+	if err != nil {
+		t.Fatalf("pruneRestoreRuns() error = %v", err)
+	}
+	if len(current.Items) != 1 || current.Items[0].Name != "restore-run-4-acm-resources-schedule-20210910181336" {
+		t.Errorf("pruneRestoreRuns() current velero restores = %v", current.Items)
+	}
+	for name, wantDeleted := range map[string]bool{
+		"restore-acm-resources-schedule-20210910181336":       true,
+		"restore-run-2-acm-resources-schedule-20210910181336": true,
+		"restore-run-3-acm-resources-schedule-20210910181336": false,
+	} {
+		err := c.Get(context.Background(), types.NamespacedName{Namespace: "velero-ns", Name: name}, &veleroapi.Restore{})
+		if wantDeleted != k8serr.IsNotFound(err) {
+			t.Errorf("velero restore %s want deleted %v, error = %v", name, wantDeleted, err)
+		}
+	}
+}
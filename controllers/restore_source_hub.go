@@ -0,0 +1,74 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// returns the options used to list the backups restored by this restore,
+// limited to the backups produced by the restore source hub, if set
+func getRestoreBackupListOptions(restore *v1beta1.Restore) []client.ListOption {
+	opts := []client.ListOption{client.InNamespace(restore.Namespace)}
+	if restore.Spec.SourceHub != "" {
+		opts = append(opts, client.MatchingLabels{BackupScheduleClusterLabel: restore.Spec.SourceHub})
+	}
+	return opts
+}
+
+// returns true if the backup can be restored from the restore source hub
+func isBackupFromSourceHub(restore *v1beta1.Restore, backup *veleroapi.Backup) bool {
+	return restore.Spec.SourceHub == "" ||
+		backup.Labels[BackupScheduleClusterLabel] == restore.Spec.SourceHub
+}
+
+// returns the sorted list of hubs which produced these backups
+func getSourceHubs(backups []veleroapi.Backup) []string {
+	hubs := []string{}
+	found := make(map[string]bool)
+	for i := range backups {
+		hub, ok := backups[i].Labels[BackupScheduleClusterLabel]
+		if !ok || found[hub] {
+			continue
+		}
+		found[hub] = true
+		hubs = append(hubs, hub)
+	}
+	sort.Strings(hubs)
+	return hubs
+}
+
+// set in the restore status the hubs which produced the backups found in the storage location
+func (r *RestoreReconciler) setSourceHubs(ctx context.Context, restore *v1beta1.Restore) error {
+	veleroBackups := &veleroapi.BackupList{}
+	if err := r.List(
+		ctx,
+		veleroBackups,
+		client.InNamespace(restore.Namespace),
+		client.HasLabels{BackupScheduleClusterLabel},
+	); err != nil {
+		return fmt.Errorf("unable to list velero backups: %v", err)
+	}
+	restore.Status.SourceHubs = getSourceHubs(veleroBackups.Items)
+	return nil
+}
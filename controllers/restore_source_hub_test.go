@@ -0,0 +1,118 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newSourceHubBackup(name, hubIdentity string, startTime time.Time) *veleroapi.Backup {
+	backup := newHubBackup(name, hubIdentity, startTime)
+	backup.Namespace = "velero"
+	backup.Status.Phase = veleroapi.BackupPhaseCompleted
+	if hubIdentity == "" {
+		backup.Labels = nil
+	}
+	return &backup
+}
+
+func Test_getSourceHubs(t *testing.T) {
+	now := time.Now()
+	backups := []veleroapi.Backup{
+		*newSourceHubBackup("acm-resources-schedule-1", "hub2", now),
+		*newSourceHubBackup("acm-resources-schedule-2", "", now),
+		*newSourceHubBackup("acm-resources-schedule-3", "hub1", now),
+		*newSourceHubBackup("acm-credentials-schedule-3", "hub1", now),
+	}
+	if got := getSourceHubs(backups); !reflect.DeepEqual(got, []string{"hub1", "hub2"}) {
+		t.Errorf("getSourceHubs() = %v", got)
+	}
+}
+
+func Test_getVeleroBackupName_sourceHub(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = veleroapi.AddToScheme(testScheme)
+
+	now := time.Now()
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		newSourceHubBackup("acm-resources-schedule-20210910181336", "hub1", now.Add(-time.Hour)),
+		newSourceHubBackup("acm-resources-schedule-20210910191336", "hub2", now),
+	).Build()
+	r := &RestoreReconciler{Client: c}
+
+	tests := []struct {
+		name       string
+		sourceHub  string
+		backupName string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "latest from any hub",
+			backupName: latestBackupStr,
+			want:       "acm-resources-schedule-20210910191336",
+		},
+		{
+			name:       "latest from source hub",
+			sourceHub:  "hub1",
+			backupName: latestBackupStr,
+			want:       "acm-resources-schedule-20210910181336",
+		},
+		{
+			name:       "latest from unknown hub",
+			sourceHub:  "hub3",
+			backupName: latestBackupStr,
+			wantErr:    true,
+		},
+		{
+			name:       "name from source hub",
+			sourceHub:  "hub2",
+			backupName: "acm-credentials-schedule-20210910191336",
+			want:       "acm-resources-schedule-20210910191336",
+		},
+		{
+			name:       "name from another hub",
+			sourceHub:  "hub1",
+			backupName: "acm-credentials-schedule-20210910191336",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restore := &v1beta1.Restore{
+				ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "velero"},
+				Spec:       v1beta1.RestoreSpec{SourceHub: tt.sourceHub},
+			}
+			got, err := r.getVeleroBackupName(context.Background(), restore, Resources, tt.backupName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getVeleroBackupName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getVeleroBackupName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// interval used to look for new backups when the restore sync interval is not set
+const defaultRestoreSyncInterval = 30 * time.Minute
+
+// returns the trimmed, lower case backup name or an empty string if not set
+func getBackupNameOption(backupName *string) string {
+	if backupName == nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(*backupName))
+}
+
+// returns an error if the restore options don't allow to sync with new backups
+func validateRestoreSyncOptions(restore *v1beta1.Restore) error {
+	if !restore.Spec.SyncRestoreWithNewBackups {
+		return nil
+	}
+	if getBackupNameOption(restore.Spec.VeleroCredentialsBackupName) != latestBackupStr ||
+		getBackupNameOption(restore.Spec.VeleroResourcesBackupName) != latestBackupStr {
+		return fmt.Errorf(
+			"syncRestoreWithNewBackups requires veleroCredentialsBackupName and veleroResourcesBackupName set to %s",
+			latestBackupStr,
+		)
+	}
+	managedClustersBackupName := getBackupNameOption(restore.Spec.VeleroManagedClustersBackupName)
+	if managedClustersBackupName != skipRestoreStr && managedClustersBackupName != latestBackupStr {
+		return fmt.Errorf(
+			"syncRestoreWithNewBackups requires veleroManagedClustersBackupName set to %s, or %s to activate the managed clusters",
+			skipRestoreStr,
+			latestBackupStr,
+		)
+	}
+	if restore.Spec.RestoreSyncInterval.Duration < 0 {
+		return fmt.Errorf("restoreSyncInterval must be a positive duration")
+	}
+	if restore.Spec.ConflictPolicy == v1beta1.ConflictPolicyFail {
+		// the resources restored by the previous sync already exist on the hub
+		return fmt.Errorf("syncRestoreWithNewBackups can't be used with the %s conflictPolicy", v1beta1.ConflictPolicyFail)
+	}
+	return nil
+}
+
+// returns true while the restore keeps restoring new backups,
+// that is until the managed clusters are activated
+func isRestoreSyncActive(restore *v1beta1.Restore) bool {
+	return restore.Spec.SyncRestoreWithNewBackups &&
+		getBackupNameOption(restore.Spec.VeleroManagedClustersBackupName) == skipRestoreStr
+}
+
+// returns the interval used to look for new backups
+func getRestoreSyncInterval(restore *v1beta1.Restore) time.Duration {
+	if restore.Spec.RestoreSyncInterval.Duration == 0 {
+		return defaultRestoreSyncInterval
+	}
+	return restore.Spec.RestoreSyncInterval.Duration
+}
+
+// returns true if all velero restores have run to completion
+func areVeleroRestoresDone(veleroRestoreList *veleroapi.RestoreList) bool {
+	for i := range veleroRestoreList.Items {
+		switch veleroRestoreList.Items[i].Status.Phase {
+		case veleroapi.RestorePhaseCompleted,
+			veleroapi.RestorePhasePartiallyFailed,
+			veleroapi.RestorePhaseFailed,
+			veleroapi.RestorePhaseFailedValidation:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// returns true if none of the velero restores restored a managed clusters backup
+func isManagedClustersRestoreMissing(veleroRestoreList *veleroapi.RestoreList) bool {
+	for i := range veleroRestoreList.Items {
+		if strings.HasPrefix(
+			veleroRestoreList.Items[i].Spec.BackupName,
+			veleroScheduleNames[ManagedClusters]+"-",
+		) {
+			return false
+		}
+	}
+	return true
+}
+
+// returns true if the velero restore with this name exists
+func isVeleroRestoreCreated(veleroRestoreList *veleroapi.RestoreList, name string) bool {
+	for i := range veleroRestoreList.Items {
+		if veleroRestoreList.Items[i].Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// returns how long to wait before looking for new backups,
+// based on the creation of the last velero restore; zero means now
+func getRestoreSyncDelay(
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+	now time.Time,
+) time.Duration {
+	var lastRestore time.Time
+	for i := range veleroRestoreList.Items {
+		created := veleroRestoreList.Items[i].CreationTimestamp.Time
+		if created.After(lastRestore) {
+			lastRestore = created
+		}
+	}
+	nextSync := lastRestore.Add(getRestoreSyncInterval(restore))
+	if now.Before(nextSync) {
+		return nextSync.Sub(now)
+	}
+	return 0
+}
+
+// returns true if new velero restores must be created for a restore syncing with new backups:
+// when the sync interval elapsed or when the managed clusters are activated;
+// the returned duration is the time to wait before checking again
+func shouldSyncWithNewBackups(
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+	now time.Time,
+) (bool, time.Duration) {
+	if !restore.Spec.SyncRestoreWithNewBackups ||
+		len(veleroRestoreList.Items) == 0 ||
+		!areVeleroRestoresDone(veleroRestoreList) {
+		return false, 0
+	}
+	if !isRestoreSyncActive(restore) {
+		// managed clusters activated, restore them once
+		return isManagedClustersRestoreMissing(veleroRestoreList), 0
+	}
+	if delay := getRestoreSyncDelay(restore, veleroRestoreList, now); delay > 0 {
+		return false, delay
+	}
+	return true, getRestoreSyncInterval(restore)
+}
+
+// returns true if the first velero restore was created after the second one,
+// using the backup name and the attempt when they were created at the same time
+func isVeleroRestoreNewer(veleroRestore *veleroapi.Restore, other *veleroapi.Restore) bool {
+	if !veleroRestore.CreationTimestamp.Equal(&other.CreationTimestamp) {
+		return other.CreationTimestamp.Before(&veleroRestore.CreationTimestamp)
+	}
+	if veleroRestore.Spec.BackupName != other.Spec.BackupName {
+		// the backup names end with the backup timestamp
+		return veleroRestore.Spec.BackupName > other.Spec.BackupName
+	}
+	return getVeleroRestoreAttempt(veleroRestore) > getVeleroRestoreAttempt(other)
+}
+
+// returns the latest velero restore of each resource type, keeping the velero restores of an unknown type,
+// and the older velero restores replaced by a latest one
+func getLatestVeleroRestores(veleroRestoreList *veleroapi.RestoreList) (*veleroapi.RestoreList, []veleroapi.Restore) {
+	latestByType := map[ResourceType]*veleroapi.Restore{}
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		key, ok := getVeleroRestoreResourceType(veleroRestore)
+		if !ok {
+			continue
+		}
+		if latest, found := latestByType[key]; !found || isVeleroRestoreNewer(veleroRestore, latest) {
+			latestByType[key] = veleroRestore
+		}
+	}
+
+	latest := &veleroapi.RestoreList{}
+	older := []veleroapi.Restore{}
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		if key, ok := getVeleroRestoreResourceType(veleroRestore); ok && latestByType[key] != veleroRestore {
+			older = append(older, *veleroRestore)
+			continue
+		}
+		latest.Items = append(latest.Items, *veleroRestore)
+	}
+	return latest, older
+}
+
+// removes the status entries reported for the velero restores
+func removeVeleroRestoresStatus(restore *v1beta1.Restore, veleroRestoreNames []string) {
+	results := []v1beta1.VeleroRestoreResult{}
+	for _, result := range restore.Status.VeleroRestoreResults {
+		if !findValue(veleroRestoreNames, result.VeleroRestoreName) {
+			results = append(results, result)
+		}
+	}
+	restore.Status.VeleroRestoreResults = results
+
+	attempts := []v1beta1.VeleroRestoreAttempt{}
+	for _, attempt := range restore.Status.VeleroRestoreAttempts {
+		if !findValue(veleroRestoreNames, attempt.VeleroRestoreName) {
+			attempts = append(attempts, attempt)
+		}
+	}
+	restore.Status.VeleroRestoreAttempts = attempts
+
+	transformResults := []v1beta1.RestoreTransformResult{}
+	for _, result := range restore.Status.TransformResults {
+		if !findValue(veleroRestoreNames, result.VeleroRestoreName) {
+			transformResults = append(transformResults, result)
+		}
+	}
+	restore.Status.TransformResults = transformResults
+
+	hooks := []v1beta1.RestoreHookStatus{}
+	for _, hook := range restore.Status.Hooks {
+		if !findValue(veleroRestoreNames, hook.VeleroRestoreName) {
+			hooks = append(hooks, hook)
+		}
+	}
+	restore.Status.Hooks = hooks
+}
+
+// keeps the latest velero restore of each resource type for a restore syncing with new backups,
+// deleting the velero restores replaced by the restores of new backups with their status;
+// returns the velero restores kept
+func (r *RestoreReconciler) pruneSyncedVeleroRestores(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+) (*veleroapi.RestoreList, error) {
+	if !restore.Spec.SyncRestoreWithNewBackups {
+		return veleroRestoreList, nil
+	}
+	restoreLogger := log.FromContext(ctx)
+
+	latest, older := getLatestVeleroRestores(veleroRestoreList)
+	deleted := []string{}
+	for i := range older {
+		restoreLogger.Info("deleting velero restore replaced by a new backup restore", "name", older[i].Name)
+		if err := r.Delete(ctx, &older[i]); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		deleted = append(deleted, older[i].Name)
+	}
+	removeVeleroRestoresStatus(restore, deleted)
+	return latest, nil
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newSyncRestore(managedClusters, credentials, resources string) *v1beta1.Restore {
+	return &v1beta1.Restore{
+		Spec: v1beta1.RestoreSpec{
+			VeleroManagedClustersBackupName: &managedClusters,
+			VeleroCredentialsBackupName:     &credentials,
+			VeleroResourcesBackupName:       &resources,
+			SyncRestoreWithNewBackups:       true,
+			RestoreSyncInterval:             metav1.Duration{Duration: 10 * time.Minute},
+		},
+	}
+}
+
+func newVeleroRestore(backupName string, created time.Time, phase veleroapi.RestorePhase) veleroapi.Restore {
+	return veleroapi.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "restore-" + backupName,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec:   veleroapi.RestoreSpec{BackupName: backupName},
+		Status: veleroapi.RestoreStatus{Phase: phase},
+	}
+}
+
+func Test_validateRestoreSyncOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		restore *v1beta1.Restore
+		wantErr bool
+	}{
+		{
+			name:    "passive sync",
+			restore: newSyncRestore(skipRestoreStr, latestBackupStr, latestBackupStr),
+			wantErr: false,
+		},
+		{
+			name:    "activation",
+			restore: newSyncRestore(latestBackupStr, latestBackupStr, latestBackupStr),
+			wantErr: false,
+		},
+		{
+			name:    "credentials skipped",
+			restore: newSyncRestore(skipRestoreStr, skipRestoreStr, latestBackupStr),
+			wantErr: true,
+		},
+		{
+			name:    "managed clusters backup name",
+			restore: newSyncRestore("acm-managed-clusters-schedule-20210910181336", latestBackupStr, latestBackupStr),
+			wantErr: true,
+		},
+		{
+			name: "fail conflict policy",
+			restore: func() *v1beta1.Restore {
+				restore := newSyncRestore(skipRestoreStr, latestBackupStr, latestBackupStr)
+				restore.Spec.ConflictPolicy = v1beta1.ConflictPolicyFail
+				return restore
+			}(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRestoreSyncOptions(tt.restore); (err != nil) != tt.wantErr {
+				t.Errorf("validateRestoreSyncOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_shouldSyncWithNewBackups(t *testing.T) {
+	now := time.Now()
+	lastRestore := now.Add(-4 * time.Minute)
+	tests := []struct {
+		name      string
+		restore   *v1beta1.Restore
+		restores  []veleroapi.Restore
+		wantSync  bool
+		wantDelay time.Duration
+	}{
+		{
+			name:    "velero restores running",
+			restore: newSyncRestore(skipRestoreStr, latestBackupStr, latestBackupStr),
+			restores: []veleroapi.Restore{
+				newVeleroRestore("acm-resources-schedule-1", lastRestore, veleroapi.RestorePhaseInProgress),
+			},
+			wantSync:  false,
+			wantDelay: 0,
+		},
+		{
+			name:    "sync interval not elapsed",
+			restore: newSyncRestore(skipRestoreStr, latestBackupStr, latestBackupStr),
+			restores: []veleroapi.Restore{
+				newVeleroRestore("acm-resources-schedule-1", lastRestore, veleroapi.RestorePhaseCompleted),
+			},
+			wantSync:  false,
+			wantDelay: 6 * time.Minute,
+		},
+		{
+			name:    "sync interval elapsed",
+			restore: newSyncRestore(skipRestoreStr, latestBackupStr, latestBackupStr),
+			restores: []veleroapi.Restore{
+				newVeleroRestore("acm-resources-schedule-1", now.Add(-time.Hour), veleroapi.RestorePhaseCompleted),
+			},
+			wantSync:  true,
+			wantDelay: 10 * time.Minute,
+		},
+		{
+			name:    "managed clusters activated",
+			restore: newSyncRestore(latestBackupStr, latestBackupStr, latestBackupStr),
+			restores: []veleroapi.Restore{
+				newVeleroRestore("acm-resources-schedule-1", lastRestore, veleroapi.RestorePhaseCompleted),
+			},
+			wantSync:  true,
+			wantDelay: 0,
+		},
+		{
+			name:    "managed clusters restored",
+			restore: newSyncRestore(latestBackupStr, latestBackupStr, latestBackupStr),
+			restores: []veleroapi.Restore{
+				newVeleroRestore("acm-managed-clusters-schedule-1", lastRestore, veleroapi.RestorePhaseCompleted),
+			},
+			wantSync:  false,
+			wantDelay: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sync, delay := shouldSyncWithNewBackups(tt.restore, &veleroapi.RestoreList{Items: tt.restores}, now)
+			if sync != tt.wantSync || delay != tt.wantDelay {
+				t.Errorf("shouldSyncWithNewBackups() = %v, %v, want %v, %v",
+					sync, delay, tt.wantSync, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func Test_setRestorePhase_sync(t *testing.T) {
+	restore := newSyncRestore(skipRestoreStr, latestBackupStr, latestBackupStr)
+	veleroRestoreList := &veleroapi.RestoreList{Items: []veleroapi.Restore{
+		newVeleroRestore("acm-resources-schedule-1", time.Now(), veleroapi.RestorePhaseCompleted),
+	}}
+
+	setRestorePhase(veleroRestoreList, restore)
+	if restore.Status.Phase != v1beta1.RestorePhaseEnabled {
+		t.Errorf("setRestorePhase() phase = %v, want %v", restore.Status.Phase, v1beta1.RestorePhaseEnabled)
+	}
+
+	// a partial failure of a previous backup restore doesn't change the phase
+	veleroRestoreList.Items = append(veleroRestoreList.Items,
+		newVeleroRestore("acm-resources-schedule-0", time.Now().Add(-time.Hour), veleroapi.RestorePhasePartiallyFailed))
+	setRestorePhase(veleroRestoreList, restore)
+	if restore.Status.Phase != v1beta1.RestorePhaseEnabled {
+		t.Errorf("setRestorePhase() phase = %v with an older partial failure", restore.Status.Phase)
+	}
+}
+
+func Test_pruneSyncedVeleroRestores(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = veleroapi.AddToScheme(testScheme)
+
+	now := time.Now()
+	oldResources := newVeleroRestore(veleroScheduleNames[Resources]+"-20210910171336", now.Add(-time.Hour),
+		veleroapi.RestorePhasePartiallyFailed)
+	newResources := newVeleroRestore(veleroScheduleNames[Resources]+"-20210910181336", now,
+		veleroapi.RestorePhaseCompleted)
+	credentials := newVeleroRestore(veleroScheduleNames[Credentials]+"-20210910171336", now.Add(-time.Hour),
+		veleroapi.RestorePhaseCompleted)
+	builder := fake.NewClientBuilder().WithScheme(testScheme)
+	for _, veleroRestore := range []veleroapi.Restore{oldResources, newResources, credentials} {
+		veleroRestore.Namespace = "velero-ns"
+		builder = builder.WithObjects(veleroRestore.DeepCopy())
+	}
+	c := builder.Build()
+	veleroRestoreList := &veleroapi.RestoreList{}
+	if err := c.List(context.Background(), veleroRestoreList); err != nil {
+		t.Fatal(err)
+	}
+	r := &RestoreReconciler{Client: c, Recorder: record.NewFakeRecorder(10)}
+
+	restore := newSyncRestore(skipRestoreStr, latestBackupStr, latestBackupStr)
+	restore.Status.VeleroRestoreResults = []v1beta1.VeleroRestoreResult{
+		{VeleroRestoreName: oldResources.Name, Errors: 1},
+		{VeleroRestoreName: newResources.Name},
+	}
+	restore.Status.Hooks = []v1beta1.RestoreHookStatus{
+		{Name: "hook", VeleroRestoreName: "restore-not-created-yet"},
+	}
+
+	latest, err := r.pruneSyncedVeleroRestores(context.Background(), restore, veleroRestoreList)
+	if err != nil {
+		t.Fatalf("pruneSyncedVeleroRestores() error = %v", err)
+	}
+	if len(latest.Items) != 2 || isVeleroRestoreCreated(latest, oldResources.Name) {
+		t.Errorf("pruneSyncedVeleroRestores() latest = %v", latest.Items)
+	}
+	remaining := &veleroapi.RestoreList{}
+	if err := c.List(context.Background(), remaining); err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining.Items) != 2 || isVeleroRestoreCreated(remaining, oldResources.Name) {
+		t.Errorf("velero restore replaced by a new backup restore not deleted: %v", remaining.Items)
+	}
+	if len(restore.Status.VeleroRestoreResults) != 1 ||
+		restore.Status.VeleroRestoreResults[0].VeleroRestoreName != newResources.Name ||
+		len(restore.Status.Hooks) != 1 {
+		t.Errorf("pruneSyncedVeleroRestores() status = %v", restore.Status)
+	}
+
+	// the velero restores of a restore not syncing with new backups are kept
+	restore.Spec.SyncRestoreWithNewBackups = false
+	if kept, _ := r.pruneSyncedVeleroRestores(context.Background(), restore, veleroRestoreList); kept != veleroRestoreList {
+		t.Errorf("pruneSyncedVeleroRestores() = %v without sync", kept.Items)
+	}
+}
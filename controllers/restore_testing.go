@@ -0,0 +1,368 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	"github.com/robfig/cron/v3"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// prefix of the velero restores and sandbox namespaces created by the test restores
+	restoreTestPrefix = "acm-restore-test"
+	// RestoreTestLabel is set on the velero restores and sandbox namespaces of the test restores,
+	// with the name of the backup schedule
+	RestoreTestLabel = "cluster.open-cluster-management.io/restore-test"
+	// time to wait before checking again a running test restore
+	restoreTestInterval = time.Second * 30
+	// a test restore still running after this time fails
+	restoreTestTimeout = time.Hour
+	// max length of a namespace name
+	maxNamespaceNameLength = 63
+	// velero namespace pattern matching the sandbox namespaces, excluded from all the backups
+	restoreTestNamespacePattern = restoreTestPrefix + "-*"
+)
+
+// resources restored by the test restores, by kind: only data no controller acts on is restored,
+// the ACM resources such as policies, placements or subscriptions are reconciled in any namespace
+// and could act on live managed clusters if restored in the sandbox namespaces
+var restoreTestIncludedResources = map[schema.GroupKind]string{
+	{Kind: "ConfigMap"}: "configmaps",
+	{Kind: "Secret"}:    "secrets",
+}
+
+// returns the resources restored by the test restores
+func getRestoreTestIncludedResources() []string {
+	resources := make([]string, 0, len(restoreTestIncludedResources))
+	for _, resource := range restoreTestIncludedResources {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+// returns true if the namespace is a sandbox namespace of the test restores; the restored copies keep
+// the backup labels of the live resources, they must not be backed up, labeled or encrypted
+func isRestoreTestNamespace(namespace string) bool {
+	return strings.HasPrefix(namespace, restoreTestPrefix+"-")
+}
+
+// excludes the sandbox namespaces of the test restores from the velero backup
+func excludeRestoreTestNamespaces(veleroBackupTemplate *veleroapi.BackupSpec) {
+	veleroBackupTemplate.ExcludedNamespaces = appendUnique(
+		veleroBackupTemplate.ExcludedNamespaces,
+		restoreTestNamespacePattern,
+	)
+}
+
+// returns the sandbox namespace receiving the resources restored from this namespace
+func getRestoreTestNamespace(namespace string) string {
+	name := restoreTestPrefix + "-" + namespace
+	if len(name) <= maxNamespaceNameLength {
+		return name
+	}
+	// keep the names unique when trimmed
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(namespace))
+	suffix := fmt.Sprintf("-%08x", hash.Sum32())
+	return strings.TrimRight(name[:maxNamespaceNameLength-len(suffix)], "-") + suffix
+}
+
+// returns the next time a test restore should run, after the previous test or the schedule creation
+func getRestoreTestNextTime(backupSchedule *v1beta1.BackupSchedule) (time.Time, error) {
+	schedule, err := cron.ParseStandard(backupSchedule.Spec.RestoreTest.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	last := backupSchedule.CreationTimestamp.Time
+	if status := backupSchedule.Status.RestoreTest; status != nil && status.StartTime != nil {
+		last = status.StartTime.Time
+	}
+	return schedule.Next(last), nil
+}
+
+// returns the namespaces of the backed up resources restored by the test restores, mapped to sandbox namespaces
+func getRestoreTestNamespaceMapping(resourceList map[string][]string) map[string]string {
+	mapping := make(map[string]string)
+	for _, res := range parseBackupResourceList(resourceList) {
+		if res.namespace == "" || isRestoreTestNamespace(res.namespace) {
+			continue
+		}
+		if _, ok := restoreTestIncludedResources[res.gvk.GroupKind()]; !ok {
+			continue
+		}
+		mapping[res.namespace] = getRestoreTestNamespace(res.namespace)
+	}
+	return mapping
+}
+
+// sets the result of the test restore once all its velero restores are finished
+// or the test timed out; returns false if the test is still running
+func setRestoreTestResult(
+	status *v1beta1.RestoreTestStatus,
+	veleroRestores []veleroapi.Restore,
+	now time.Time,
+) bool {
+	finished := true
+	for i := range veleroRestores {
+		switch veleroRestores[i].Status.Phase {
+		case veleroapi.RestorePhaseCompleted,
+			veleroapi.RestorePhasePartiallyFailed,
+			veleroapi.RestorePhaseFailed,
+			veleroapi.RestorePhaseFailedValidation:
+		default:
+			finished = false
+		}
+	}
+	timedOut := status.StartTime != nil && now.Sub(status.StartTime.Time) > restoreTestTimeout
+	if !finished && !timedOut {
+		return false
+	}
+
+	status.TotalItems, status.ItemsRestored, status.Warnings, status.Errors = 0, 0, 0, 0
+	failed := []string{}
+	for i := range veleroRestores {
+		veleroRestore := &veleroRestores[i]
+		if veleroRestore.Status.Progress != nil {
+			status.TotalItems += veleroRestore.Status.Progress.TotalItems
+			status.ItemsRestored += veleroRestore.Status.Progress.ItemsRestored
+		}
+		status.Warnings += veleroRestore.Status.Warnings
+		status.Errors += veleroRestore.Status.Errors
+		if veleroRestore.Status.Phase != veleroapi.RestorePhaseCompleted {
+			failed = append(failed, fmt.Sprintf("%s %s", veleroRestore.Name, veleroRestore.Status.Phase))
+		}
+	}
+	sort.Strings(failed)
+
+	status.CompletionTime = &metav1.Time{Time: now}
+	if status.StartTime != nil {
+		status.Duration = &metav1.Duration{Duration: now.Sub(status.StartTime.Time).Round(time.Second)}
+	}
+	switch {
+	case len(veleroRestores) == 0:
+		status.Phase = v1beta1.RestoreTestPhaseFailed
+		status.Message = "Velero restores of the test not found"
+	case !finished:
+		status.Phase = v1beta1.RestoreTestPhaseFailed
+		status.Message = fmt.Sprintf("Velero restores did not complete in %s: %s",
+			restoreTestTimeout, strings.Join(failed, ", "))
+	case len(failed) > 0:
+		status.Phase = v1beta1.RestoreTestPhaseFailed
+		status.Message = "Velero restores did not complete: " + strings.Join(failed, ", ")
+	default:
+		status.Phase = v1beta1.RestoreTestPhasePassed
+		status.Message = fmt.Sprintf("Restored %d items from backups %s",
+			status.ItemsRestored, status.BackupTimestamp)
+	}
+	return true
+}
+
+// runs the test restores of the backup schedule: starts a test restore when it is due
+// and records its result once finished; returns the time to wait before the next check
+func (r *BackupScheduleReconciler) runRestoreTest(
+	ctx context.Context,
+	backupSchedule *v1beta1.BackupSchedule,
+) (time.Duration, error) {
+	scheduleLogger := log.FromContext(ctx)
+
+	if status := backupSchedule.Status.RestoreTest; status != nil &&
+		status.Phase == v1beta1.RestoreTestPhaseRunning {
+		veleroRestores := &veleroapi.RestoreList{}
+		if err := r.List(
+			ctx,
+			veleroRestores,
+			client.InNamespace(backupSchedule.Namespace),
+			client.MatchingLabels{RestoreTestLabel: backupSchedule.Name},
+		); err != nil {
+			return failureInterval, fmt.Errorf("unable to list velero restores: %v", err)
+		}
+		if !setRestoreTestResult(status, veleroRestores.Items, time.Now()) {
+			return restoreTestInterval, nil
+		}
+		scheduleLogger.Info("test restore finished", "phase", status.Phase, "message", status.Message)
+		if err := r.cleanupRestoreTest(ctx, backupSchedule, veleroRestores); err != nil {
+			return failureInterval, err
+		}
+	}
+
+	if backupSchedule.Spec.RestoreTest == nil {
+		return deleteBackupRequeueInterval, nil
+	}
+	next, err := getRestoreTestNextTime(backupSchedule)
+	if err != nil {
+		return deleteBackupRequeueInterval, err
+	}
+	if wait := time.Until(next); wait > 0 {
+		return wait, nil
+	}
+
+	veleroBackups := &veleroapi.BackupList{}
+	if err := r.List(ctx, veleroBackups, client.InNamespace(backupSchedule.Namespace)); err != nil {
+		return failureInterval, fmt.Errorf("unable to list velero backups: %v", err)
+	}
+	timestamp, backups := getLatestBackupSet(veleroBackups.Items)
+	if timestamp == "" {
+		// a completed backup triggers a new reconcile
+		return deleteBackupRequeueInterval, nil
+	}
+
+	err = r.startRestoreTest(ctx, backupSchedule, timestamp, backups)
+	if errors.Is(err, errDownloadNotReady) {
+		return downloadRequestInterval, nil
+	}
+	if err != nil {
+		now := metav1.Now()
+		backupSchedule.Status.RestoreTest = &v1beta1.RestoreTestStatus{
+			Phase:           v1beta1.RestoreTestPhaseFailed,
+			BackupTimestamp: timestamp,
+			StartTime:       &now,
+			CompletionTime:  &now,
+			Message:         fmt.Sprintf("Unable to start the test restore: %v", err),
+		}
+		return deleteBackupRequeueInterval, nil
+	}
+	return restoreTestInterval, nil
+}
+
+// restores the configmaps and secrets of the backups into sandbox namespaces, so live resources are not updated
+func (r *BackupScheduleReconciler) startRestoreTest(
+	ctx context.Context,
+	backupSchedule *v1beta1.BackupSchedule,
+	timestamp string,
+	backups map[ResourceType]*veleroapi.Backup,
+) error {
+	keys := make([]ResourceType, 0, len(backups))
+	for key := range backups {
+		keys = append(keys, key)
+	}
+	sort.Sort(SortResourceType(keys))
+
+	mappings := make(map[ResourceType]map[string]string, len(keys))
+	waitingForBackups := false
+	for _, key := range keys {
+		resourceList := map[string][]string{}
+		err := downloadVeleroFile(
+			ctx,
+			r.Client,
+			backupSchedule.Namespace,
+			backups[key].Name,
+			veleroapi.DownloadTargetKindBackupResourceList,
+			decodeJSON(&resourceList),
+		)
+		if errors.Is(err, errDownloadNotReady) {
+			// keep going, to request all resource lists at once
+			waitingForBackups = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		mappings[key] = getRestoreTestNamespaceMapping(resourceList)
+	}
+	if waitingForBackups {
+		return errDownloadNotReady
+	}
+
+	labels := map[string]string{RestoreTestLabel: backupSchedule.Name}
+	includeClusterResources := false
+	restored := 0
+	for _, key := range keys {
+		if len(mappings[key]) == 0 {
+			// no namespaced configmaps or secrets to restore
+			continue
+		}
+		includedNamespaces := make([]string, 0, len(mappings[key]))
+		for namespace, sandbox := range mappings[key] {
+			includedNamespaces = append(includedNamespaces, namespace)
+			if err := r.Create(ctx, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: sandbox, Labels: labels},
+			}); err != nil && !k8serr.IsAlreadyExists(err) {
+				return err
+			}
+		}
+		sort.Strings(includedNamespaces)
+
+		veleroRestore := &veleroapi.Restore{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      getValidKsRestoreName(restoreTestPrefix, backups[key].Name),
+				Namespace: backupSchedule.Namespace,
+				Labels:    labels,
+			},
+			Spec: veleroapi.RestoreSpec{
+				BackupName:              backups[key].Name,
+				IncludedNamespaces:      includedNamespaces,
+				NamespaceMapping:        mappings[key],
+				IncludeClusterResources: &includeClusterResources,
+				IncludedResources:       getRestoreTestIncludedResources(),
+			},
+		}
+		if err := r.Create(ctx, veleroRestore); err != nil && !k8serr.IsAlreadyExists(err) {
+			return err
+		}
+		restored++
+	}
+	if restored == 0 {
+		return fmt.Errorf("backups %s have no namespaced configmaps or secrets to restore", timestamp)
+	}
+
+	backupSchedule.Status.RestoreTest = &v1beta1.RestoreTestStatus{
+		Phase:           v1beta1.RestoreTestPhaseRunning,
+		BackupTimestamp: timestamp,
+		StartTime:       &metav1.Time{Time: time.Now()},
+		Message:         fmt.Sprintf("Restoring backups %s into sandbox namespaces", timestamp),
+	}
+	return nil
+}
+
+// deletes the velero restores and sandbox namespaces of the test restore
+func (r *BackupScheduleReconciler) cleanupRestoreTest(
+	ctx context.Context,
+	backupSchedule *v1beta1.BackupSchedule,
+	veleroRestores *veleroapi.RestoreList,
+) error {
+	for i := range veleroRestores.Items {
+		if err := r.Delete(ctx, &veleroRestores.Items[i]); err != nil && !k8serr.IsNotFound(err) {
+			return err
+		}
+	}
+	namespaces := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaces, client.MatchingLabels{RestoreTestLabel: backupSchedule.Name}); err != nil {
+		return err
+	}
+	for i := range namespaces.Items {
+		if err := r.Delete(ctx, &namespaces.Items[i]); err != nil && !k8serr.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_getRestoreTestNamespace(t *testing.T) {
+	if got := getRestoreTestNamespace("ns1"); got != "acm-restore-test-ns1" {
+		t.Errorf("getRestoreTestNamespace() = %v, want acm-restore-test-ns1", got)
+	}
+
+	long1 := getRestoreTestNamespace(strings.Repeat("a", 60) + "1")
+	long2 := getRestoreTestNamespace(strings.Repeat("a", 60) + "2")
+	if len(long1) > maxNamespaceNameLength || len(long2) > maxNamespaceNameLength {
+		t.Errorf("getRestoreTestNamespace() = %v, %v, longer than %d", long1, long2, maxNamespaceNameLength)
+	}
+	if long1 == long2 {
+		t.Errorf("getRestoreTestNamespace() = %v for different namespaces", long1)
+	}
+}
+
+func Test_excludeRestoreTestNamespaces(t *testing.T) {
+	spec := &veleroapi.BackupSpec{ExcludedNamespaces: []string{"local-cluster"}}
+	excludeRestoreTestNamespaces(spec)
+	excludeRestoreTestNamespaces(spec)
+	want := []string{"local-cluster", restoreTestNamespacePattern}
+	if !reflect.DeepEqual(spec.ExcludedNamespaces, want) {
+		t.Errorf("excludeRestoreTestNamespaces() = %v, want %v", spec.ExcludedNamespaces, want)
+	}
+	// velero matches the excluded namespaces as glob patterns
+	for namespace, want := range map[string]bool{
+		"ns1":                  false,
+		"acm-restore-test":     false,
+		"acm-restore-test-ns1": true,
+		getRestoreTestNamespace(strings.Repeat("a", 70)): true,
+	} {
+		if got, _ := path.Match(restoreTestNamespacePattern, namespace); got != want {
+			t.Errorf("namespace %s excluded = %v, want %v", namespace, got, want)
+		}
+		if got := isRestoreTestNamespace(namespace); got != want {
+			t.Errorf("isRestoreTestNamespace(%s) = %v, want %v", namespace, got, want)
+		}
+	}
+}
+
+func Test_getRestoreTestNamespaceMapping(t *testing.T) {
+	got := getRestoreTestNamespaceMapping(map[string][]string{
+		"v1/Secret":    {"ns1/secret1", "ns2/secret2", "acm-restore-test-ns1/secret1"},
+		"v1/ConfigMap": {"ns3/configmap1"},
+		"cluster.open-cluster-management.io/v1/ManagedCluster": {"cluster1"},
+		"policy.open-cluster-management.io/v1/Policy":          {"ns4/policy1"},
+		"apps.open-cluster-management.io/v1/Subscription":      {"ns4/subscription1"},
+	})
+	want := map[string]string{
+		"ns1": "acm-restore-test-ns1",
+		"ns2": "acm-restore-test-ns2",
+		"ns3": "acm-restore-test-ns3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getRestoreTestNamespaceMapping() = %v, want %v", got, want)
+	}
+}
+
+func Test_getRestoreTestNextTime(t *testing.T) {
+	created := time.Date(2021, 10, 19, 10, 30, 0, 0, time.UTC)
+	backupSchedule := &v1beta1.BackupSchedule{
+		ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+		Spec: v1beta1.BackupScheduleSpec{
+			RestoreTest: &v1beta1.RestoreTestSpec{Schedule: "0 */6 * * *"},
+		},
+	}
+	next, err := getRestoreTestNextTime(backupSchedule)
+	if err != nil {
+		t.Fatalf("getRestoreTestNextTime() error = %v", err)
+	}
+	if want := time.Date(2021, 10, 19, 12, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("getRestoreTestNextTime() = %v, want %v", next, want)
+	}
+
+	lastTest := metav1.NewTime(time.Date(2021, 10, 20, 12, 0, 0, 0, time.UTC))
+	backupSchedule.Status.RestoreTest = &v1beta1.RestoreTestStatus{StartTime: &lastTest}
+	next, _ = getRestoreTestNextTime(backupSchedule)
+	if want := time.Date(2021, 10, 20, 18, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("getRestoreTestNextTime() = %v, want %v", next, want)
+	}
+}
+
+func Test_setRestoreTestResult(t *testing.T) {
+	start := time.Date(2021, 10, 19, 10, 0, 0, 0, time.UTC)
+	newTestRestore := func(name string, phase veleroapi.RestorePhase, items int) veleroapi.Restore {
+		return veleroapi.Restore{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: veleroapi.RestoreStatus{
+				Phase:    phase,
+				Warnings: 1,
+				Progress: &veleroapi.RestoreProgress{TotalItems: items, ItemsRestored: items},
+			},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		restores     []veleroapi.Restore
+		now          time.Time
+		wantFinished bool
+		wantPhase    v1beta1.RestoreTestPhase
+		wantItems    int
+	}{
+		{
+			name: "running",
+			restores: []veleroapi.Restore{
+				newTestRestore("credentials", veleroapi.RestorePhaseCompleted, 3),
+				newTestRestore("resources", veleroapi.RestorePhaseInProgress, 10),
+			},
+			now:       start.Add(time.Minute),
+			wantPhase: v1beta1.RestoreTestPhaseRunning,
+		},
+		{
+			name: "passed",
+			restores: []veleroapi.Restore{
+				newTestRestore("credentials", veleroapi.RestorePhaseCompleted, 3),
+				newTestRestore("resources", veleroapi.RestorePhaseCompleted, 10),
+			},
+			now:          start.Add(time.Minute),
+			wantFinished: true,
+			wantPhase:    v1beta1.RestoreTestPhasePassed,
+			wantItems:    13,
+		},
+		{
+			name: "partially failed",
+			restores: []veleroapi.Restore{
+				newTestRestore("credentials", veleroapi.RestorePhaseCompleted, 3),
+				newTestRestore("resources", veleroapi.RestorePhasePartiallyFailed, 10),
+			},
+			now:          start.Add(time.Minute),
+			wantFinished: true,
+			wantPhase:    v1beta1.RestoreTestPhaseFailed,
+			wantItems:    13,
+		},
+		{
+			name: "timed out",
+			restores: []veleroapi.Restore{
+				newTestRestore("resources", veleroapi.RestorePhaseInProgress, 10),
+			},
+			now:          start.Add(2 * restoreTestTimeout),
+			wantFinished: true,
+			wantPhase:    v1beta1.RestoreTestPhaseFailed,
+			wantItems:    10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &v1beta1.RestoreTestStatus{
+				Phase:     v1beta1.RestoreTestPhaseRunning,
+				StartTime: &metav1.Time{Time: start},
+			}
+			if got := setRestoreTestResult(status, tt.restores, tt.now); got != tt.wantFinished {
+				t.Errorf("setRestoreTestResult() = %v, want %v", got, tt.wantFinished)
+			}
+			if status.Phase != tt.wantPhase {
+				t.Errorf("setRestoreTestResult() phase = %v, want %v (%s)", status.Phase, tt.wantPhase, status.Message)
+			}
+			if status.ItemsRestored != tt.wantItems {
+				t.Errorf("setRestoreTestResult() items = %v, want %v", status.ItemsRestored, tt.wantItems)
+			}
+			if tt.wantFinished && (status.Duration == nil || status.Duration.Duration != tt.now.Sub(start)) {
+				t.Errorf("setRestoreTestResult() duration = %v, want %v", status.Duration, tt.now.Sub(start))
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/label"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// variable replaced in the transform values with the API server URL of this hub
+	hubAPIServerURLVariable = "${HUB_API_SERVER_URL}"
+	// max number of errors reported for the transforms of a velero restore
+	maxTransformErrors = 10
+)
+
+// defaultRestoreTransforms are applied to the restored resources unless skipDefaultTransforms is set;
+// the restored ACM resources don't keep the hub API server URL, so no default transform uses it
+var defaultRestoreTransforms = []v1beta1.RestoreTransform{
+	{
+		// a generated route host uses the ingress domain of the hub where the route was created,
+		// removing it lets this hub generate a new host
+		APIVersion: "route.openshift.io/v1",
+		Kind:       "Route",
+		Patches: []v1beta1.JSONPatchOperation{
+			{Op: "test", Path: "/metadata/annotations/openshift.io~1host.generated", Value: rawJSON(`"true"`)},
+			{Op: "remove", Path: "/spec/host"},
+		},
+	},
+	{
+		// the git commit deployed by the hub where the subscription was created,
+		// removing it lets this hub deploy the subscription resources
+		APIVersion: "apps.open-cluster-management.io/v1",
+		Kind:       "Subscription",
+		Patches: []v1beta1.JSONPatchOperation{
+			{Op: "remove", Path: "/metadata/annotations/apps.open-cluster-management.io~1git-current-commit"},
+		},
+	},
+}
+
+// transformedCoreResources are the core kinds the restore can transform
+var transformedCoreResources = []string{
+	"secret",
+	"configmap",
+}
+
+// returns true if the restore can transform the restored resources of this kind: secrets, configmaps,
+// routes and resources from the restored api groups, matching the RBAC rules of the restore controller
+func isTransformedKind(gvk schema.GroupVersionKind) bool {
+	switch gvk.Group {
+	case "":
+		return findValue(transformedCoreResources, strings.ToLower(gvk.Kind))
+	case "route.openshift.io":
+		return gvk.Kind == "Route"
+	}
+	return isRestoredAPIGroup(gvk.Group)
+}
+
+// returns a transform value from its JSON encoding
+func rawJSON(value string) *runtime.RawExtension {
+	return &runtime.RawExtension{Raw: []byte(value)}
+}
+
+// returns the transforms applied to the resources restored by the restore
+func getRestoreTransforms(restore *v1beta1.Restore) []v1beta1.RestoreTransform {
+	if restore.Spec.SkipDefaultTransforms {
+		return restore.Spec.Transforms
+	}
+	return append(append([]v1beta1.RestoreTransform{}, defaultRestoreTransforms...), restore.Spec.Transforms...)
+}
+
+// returns true if a transform value uses the hub API server URL
+func isHubAPIServerURLUsed(transforms []v1beta1.RestoreTransform) bool {
+	for _, transform := range transforms {
+		for _, patch := range transform.Patches {
+			if patch.Value != nil && bytes.Contains(patch.Value.Raw, []byte(hubAPIServerURLVariable)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// returns the value found at the JSON pointer in the unstructured content
+func getJSONPointerValue(content interface{}, pointer string) (interface{}, bool) {
+	if pointer == "" {
+		return content, true
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, false
+	}
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch value := content.(type) {
+		case map[string]interface{}:
+			item, ok := value[token]
+			if !ok {
+				return nil, false
+			}
+			content = item
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+			content = value[index]
+		default:
+			return nil, false
+		}
+	}
+	return content, true
+}
+
+// returns the JSON patch applied to the restored resource, without the remove and replace operations
+// on missing paths; returns nil if a test operation fails or there is nothing to patch
+func getTransformPatch(
+	obj *unstructured.Unstructured,
+	patches []v1beta1.JSONPatchOperation,
+	hubAPIServerURL string,
+) ([]byte, error) {
+	operations := []map[string]interface{}{}
+	changes := 0
+	for _, patch := range patches {
+		operation := map[string]interface{}{"op": patch.Op, "path": patch.Path}
+		if patch.From != "" {
+			operation["from"] = patch.From
+		}
+		var value interface{}
+		if patch.Value != nil {
+			raw := bytes.ReplaceAll(patch.Value.Raw, []byte(hubAPIServerURLVariable), []byte(hubAPIServerURL))
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, fmt.Errorf("invalid value for %s %s: %v", patch.Op, patch.Path, err)
+			}
+			operation["value"] = value
+		}
+
+		current, found := getJSONPointerValue(obj.Object, patch.Path)
+		switch patch.Op {
+		case "test":
+			// compare the JSON encodings, the numbers of the unstructured content are not decoded as float64
+			currentJSON, _ := json.Marshal(current)
+			valueJSON, _ := json.Marshal(value)
+			if !found || !bytes.Equal(currentJSON, valueJSON) {
+				return nil, nil
+			}
+		case "remove", "replace":
+			if !found {
+				continue
+			}
+			changes++
+		default:
+			changes++
+		}
+		operations = append(operations, operation)
+	}
+	if changes == 0 {
+		return nil, nil
+	}
+	return json.Marshal(operations)
+}
+
+// returns the transform result of the velero restore, nil if its resources were not transformed yet
+func findRestoreTransformResult(restore *v1beta1.Restore, veleroRestoreName string) *v1beta1.RestoreTransformResult {
+	for i := range restore.Status.TransformResults {
+		if restore.Status.TransformResults[i].VeleroRestoreName == veleroRestoreName {
+			return &restore.Status.TransformResults[i]
+		}
+	}
+	return nil
+}
+
+// patches the resources restored by the velero restore with the transforms
+func (r *RestoreReconciler) transformRestoredResources(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	transforms []v1beta1.RestoreTransform,
+	veleroRestoreName string,
+	hubAPIServerURL string,
+) (v1beta1.RestoreTransformResult, error) {
+	result := v1beta1.RestoreTransformResult{VeleroRestoreName: veleroRestoreName}
+	addError := func(msg string) {
+		if len(result.Errors) < maxTransformErrors {
+			result.Errors = append(result.Errors, msg)
+		}
+	}
+
+	for _, transform := range transforms {
+		gv, err := schema.ParseGroupVersion(transform.APIVersion)
+		if err != nil {
+			addError(fmt.Sprintf("invalid apiVersion %s: %v", transform.APIVersion, err))
+			continue
+		}
+		if !isTransformedKind(gv.WithKind(transform.Kind)) {
+			addError(fmt.Sprintf("%s %s resources can't be transformed", transform.APIVersion, transform.Kind))
+			continue
+		}
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gv.WithKind(transform.Kind + "List"))
+		if err := r.List(
+			ctx,
+			list,
+			client.MatchingLabels{veleroapi.RestoreNameLabel: label.GetValidName(veleroRestoreName)},
+		); err != nil {
+			if apimeta.IsNoMatchError(err) {
+				// the resource is not installed on the hub
+				continue
+			}
+			return result, err
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			patch, err := getTransformPatch(obj, transform.Patches, hubAPIServerURL)
+			if err == nil && patch != nil {
+				err = r.Patch(ctx, obj, client.RawPatch(types.JSONPatchType, patch))
+				if err == nil {
+					result.Patched++
+				}
+			}
+			if err != nil {
+				addError(fmt.Sprintf("%s %s/%s: %v", transform.Kind, obj.GetNamespace(), obj.GetName(), err))
+			}
+		}
+	}
+	return result, nil
+}
+
+// applies the transforms to the resources restored by each velero restore run to completion,
+// once per velero restore
+func (r *RestoreReconciler) applyRestoreTransforms(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+) error {
+	restoreLogger := log.FromContext(ctx)
+
+	transforms := getRestoreTransforms(restore)
+	if len(transforms) == 0 {
+		return nil
+	}
+
+	hubAPIServerURL := ""
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		if veleroRestore.Status.Phase != veleroapi.RestorePhaseCompleted &&
+			veleroRestore.Status.Phase != veleroapi.RestorePhasePartiallyFailed {
+			continue
+		}
+		if findRestoreTransformResult(restore, veleroRestore.Name) != nil {
+			continue
+		}
+
+		if hubAPIServerURL == "" && isHubAPIServerURLUsed(transforms) {
+			url, err := getPublicAPIServerURL(ctx, r.Client)
+			if err != nil {
+				return err
+			}
+			hubAPIServerURL = url
+		}
+
+		result, err := r.transformRestoredResources(ctx, restore, transforms, veleroRestore.Name, hubAPIServerURL)
+		if err != nil {
+			return err
+		}
+		restore.Status.TransformResults = append(restore.Status.TransformResults, result)
+
+		restoreLogger.Info("restored resources transformed",
+			"veleroRestore", veleroRestore.Name, "patched", result.Patched, "errors", len(result.Errors))
+		if len(result.Errors) > 0 {
+			r.Recorder.Event(
+				restore,
+				corev1.EventTypeWarning,
+				"Restore transforms failed:",
+				fmt.Sprintf("%s: %s", veleroRestore.Name, strings.Join(result.Errors, "; ")),
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	ocinfrav1 "github.com/openshift/api/config/v1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_getTransformPatch(t *testing.T) {
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{"openshift.io/host.generated": "true"},
+		},
+		"spec": map[string]interface{}{"host": "app.apps.old-hub.example.com", "port": map[string]interface{}{
+			"targetPort": int64(8080),
+		}},
+	}}
+	tests := []struct {
+		name    string
+		patches []v1beta1.JSONPatchOperation
+		want    string
+	}{
+		{
+			name:    "default route transform",
+			patches: defaultRestoreTransforms[0].Patches,
+			want:    `[{"op":"test","path":"/metadata/annotations/openshift.io~1host.generated","value":"true"},{"op":"remove","path":"/spec/host"}]`,
+		},
+		{
+			name: "failed test",
+			patches: []v1beta1.JSONPatchOperation{
+				{Op: "test", Path: "/spec/port/targetPort", Value: rawJSON(`8443`)},
+				{Op: "remove", Path: "/spec/host"},
+			},
+			want: "",
+		},
+		{
+			name: "number test",
+			patches: []v1beta1.JSONPatchOperation{
+				{Op: "test", Path: "/spec/port/targetPort", Value: rawJSON(`8080`)},
+				{Op: "replace", Path: "/spec/port/targetPort", Value: rawJSON(`8443`)},
+			},
+			want: `[{"op":"test","path":"/spec/port/targetPort","value":8080},{"op":"replace","path":"/spec/port/targetPort","value":8443}]`,
+		},
+		{
+			name: "missing path",
+			patches: []v1beta1.JSONPatchOperation{
+				{Op: "remove", Path: "/spec/tls"},
+				{Op: "replace", Path: "/spec/to", Value: rawJSON(`{"name":"app"}`)},
+			},
+			want: "",
+		},
+		{
+			name: "hub API server URL",
+			patches: []v1beta1.JSONPatchOperation{
+				{Op: "add", Path: "/spec/url", Value: rawJSON(`"${HUB_API_SERVER_URL}/apis"`)},
+			},
+			want: `[{"op":"add","path":"/spec/url","value":"https://api.hub:6443/apis"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getTransformPatch(route, tt.patches, "https://api.hub:6443")
+			if err != nil {
+				t.Fatalf("getTransformPatch() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("getTransformPatch() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isTransformedKind(t *testing.T) {
+	tests := []struct {
+		gvk  schema.GroupVersionKind
+		want bool
+	}{
+		{gvk: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, want: true},
+		{gvk: schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, want: false},
+		{gvk: schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}, want: true},
+		{gvk: schema.GroupVersionKind{Group: "apps.open-cluster-management.io", Version: "v1", Kind: "Channel"}, want: true},
+		{gvk: schema.GroupVersionKind{Group: "work.open-cluster-management.io", Version: "v1", Kind: "ManifestWork"}, want: false},
+		{gvk: schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.gvk.String(), func(t *testing.T) {
+			if got := isTransformedKind(tt.gvk); got != tt.want {
+				t.Errorf("isTransformedKind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_applyRestoreTransforms(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(testScheme)
+	_ = ocinfrav1.AddToScheme(testScheme)
+
+	veleroRestoreName := "restore-acm-resources-generic-schedule-20210910181336"
+	newConfigMap := func(name string, labels map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns1", Labels: labels},
+			Data:       map[string]string{"url": "https://api.old-hub:6443"},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		&ocinfrav1.Infrastructure{
+			ObjectMeta: metav1.ObjectMeta{Name: infrastructureName},
+			Status:     ocinfrav1.InfrastructureStatus{APIServerURL: "https://api.hub:6443"},
+		},
+		newConfigMap("restored", map[string]string{veleroapi.RestoreNameLabel: veleroRestoreName}),
+		newConfigMap("not-restored", nil),
+	).Build()
+	r := &RestoreReconciler{Client: c, Recorder: record.NewFakeRecorder(10)}
+	PublicAPIServerURL = ""
+
+	restore := &v1beta1.Restore{Spec: v1beta1.RestoreSpec{
+		SkipDefaultTransforms: true,
+		Transforms: []v1beta1.RestoreTransform{{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+			Patches: []v1beta1.JSONPatchOperation{
+				{Op: "replace", Path: "/data/url", Value: rawJSON(`"${HUB_API_SERVER_URL}"`)},
+			},
+		}},
+	}}
+	veleroRestoreList := &veleroapi.RestoreList{Items: []veleroapi.Restore{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: veleroRestoreName},
+			Status:     veleroapi.RestoreStatus{Phase: veleroapi.RestorePhaseCompleted},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "restore-acm-resources-schedule-20210910181336"},
+			Status:     veleroapi.RestoreStatus{Phase: veleroapi.RestorePhaseInProgress},
+		},
+	}}
+
+	if err := r.applyRestoreTransforms(context.Background(), restore, veleroRestoreList); err != nil {
+		t.Fatalf("applyRestoreTransforms() error = %v", err)
+	}
+	if len(restore.Status.TransformResults) != 1 || restore.Status.TransformResults[0].Patched != 1 {
+		t.Fatalf("applyRestoreTransforms() results = %v", restore.Status.TransformResults)
+	}
+	for name, want := range map[string]string{
+		"restored":     "https://api.hub:6443",
+		"not-restored": "https://api.old-hub:6443",
+	} {
+		configMap := &corev1.ConfigMap{}
+		if err := c.Get(context.Background(), types.NamespacedName{Namespace: "ns1", Name: name}, configMap); err != nil {
+			t.Fatal(err)
+		}
+		if configMap.Data["url"] != want {
+			t.Errorf("ConfigMap %s url = %s, want %s", name, configMap.Data["url"], want)
+		}
+	}
+
+	// the resources of a velero restore are transformed once
+	if err := r.applyRestoreTransforms(context.Background(), restore, veleroRestoreList); err != nil {
+		t.Fatalf("applyRestoreTransforms() error = %v", err)
+	}
+	if len(restore.Status.TransformResults) != 1 {
+		t.Errorf("applyRestoreTransforms() results = %v", restore.Status.TransformResults)
+	}
+}
@@ -175,6 +175,18 @@ func parseCronSchedule(
 		}
 	}()
 
+	// the test restores are optional
+	if restoreTest := backupSchedule.Spec.RestoreTest; restoreTest != nil {
+		if len(restoreTest.Schedule) == 0 {
+			validationErrors = append(
+				validationErrors,
+				"Restore test schedule must be a non-empty valid Cron expression",
+			)
+		} else if _, err := cron.ParseStandard(restoreTest.Schedule); err != nil {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid restore test schedule: %v", err))
+		}
+	}
+
 	if len(validationErrors) > 0 {
 		return validationErrors
 	}
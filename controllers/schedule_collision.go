@@ -0,0 +1,153 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	ocinfrav1 "github.com/openshift/api/config/v1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// BackupScheduleClusterLabel is set on the velero schedules and on the backups they produce,
+	// with the identity of the hub creating them
+	BackupScheduleClusterLabel = "cluster.open-cluster-management.io/backup-cluster"
+	// name of the openshift ClusterVersion resource
+	clusterVersionName = "version"
+)
+
+// returns the identity of this hub: the cluster ID from the ClusterVersion resource,
+// or the infrastructure name if the cluster ID is not available;
+// an empty identity is returned if the hub is not an OpenShift cluster
+func getHubIdentity(ctx context.Context, c client.Client) (string, error) {
+	clusterVersion := &ocinfrav1.ClusterVersion{}
+	err := c.Get(ctx, types.NamespacedName{Name: clusterVersionName}, clusterVersion)
+	if err == nil && clusterVersion.Spec.ClusterID != "" {
+		return string(clusterVersion.Spec.ClusterID), nil
+	}
+	if err != nil && !k8serr.IsNotFound(err) && !apimeta.IsNoMatchError(err) {
+		return "", fmt.Errorf("unable to get the hub cluster version: %v", err)
+	}
+
+	infra := &ocinfrav1.Infrastructure{}
+	err = c.Get(ctx, types.NamespacedName{Name: infrastructureName}, infra)
+	if err == nil {
+		return infra.Status.InfrastructureName, nil
+	}
+	if k8serr.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+		return "", nil
+	}
+	return "", fmt.Errorf("unable to get the hub infrastructure: %v", err)
+}
+
+// returns true if the velero schedule was not created by the hub with this identity
+func isScheduleHubIdentityUpdated(
+	schedules *veleroapi.ScheduleList,
+	hubIdentity string,
+) bool {
+	for i := range schedules.Items {
+		if schedules.Items[i].Labels[BackupScheduleClusterLabel] != hubIdentity {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the newest backup produced by another hub after the velero schedules
+// of this hub were created, or nil if all recent backups were produced by this hub
+func getCollidingBackup(
+	schedules *veleroapi.ScheduleList,
+	backups []veleroapi.Backup,
+	hubIdentity string,
+) *veleroapi.Backup {
+	if len(schedules.Items) == 0 {
+		return nil
+	}
+
+	// this hub is producing backups since its oldest velero schedule was created
+	schedulesCreated := schedules.Items[0].CreationTimestamp
+	for i := range schedules.Items {
+		if schedules.Items[i].CreationTimestamp.Before(&schedulesCreated) {
+			schedulesCreated = schedules.Items[i].CreationTimestamp
+		}
+	}
+
+	var collidingBackup *veleroapi.Backup
+	for i := range backups {
+		backup := &backups[i]
+		backupHub, ok := backup.Labels[BackupScheduleClusterLabel]
+		if !ok || backupHub == hubIdentity || backup.Status.StartTimestamp == nil {
+			continue
+		}
+		if !schedulesCreated.Before(backup.Status.StartTimestamp) {
+			continue
+		}
+		if collidingBackup == nil ||
+			collidingBackup.Status.StartTimestamp.Before(backup.Status.StartTimestamp) {
+			collidingBackup = backup
+		}
+	}
+	return collidingBackup
+}
+
+// set the BackupCollision condition, true if a colliding backup is found
+func setBackupCollisionCondition(
+	backupSchedule *v1beta1.BackupSchedule,
+	collidingBackup *veleroapi.Backup,
+	hubIdentity string,
+) {
+	condition := metav1.Condition{
+		Type:               v1beta1.BackupScheduleConditionBackupCollision,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: backupSchedule.Generation,
+		Reason:             "NoBackupCollision",
+		Message:            fmt.Sprintf("Backups are produced by this hub %s", hubIdentity),
+	}
+	if collidingBackup != nil {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "BackupFromAnotherHub"
+		condition.Message = fmt.Sprintf(
+			"Backup %s was produced by hub %s after this hub %s started producing backups "+
+				"to the same storage location",
+			collidingBackup.Name,
+			collidingBackup.Labels[BackupScheduleClusterLabel],
+			hubIdentity,
+		)
+	}
+	apimeta.SetStatusCondition(&backupSchedule.Status.Conditions, condition)
+}
+
+// returns true if the schedule stopped on a backup collision and its spec was not updated since
+func isBackupCollisionActive(backupSchedule *v1beta1.BackupSchedule) bool {
+	if backupSchedule.Status.Phase != v1beta1.SchedulePhaseBackupCollision {
+		return false
+	}
+	condition := apimeta.FindStatusCondition(
+		backupSchedule.Status.Conditions,
+		v1beta1.BackupScheduleConditionBackupCollision,
+	)
+	return condition != nil && condition.Status == metav1.ConditionTrue &&
+		condition.ObservedGeneration == backupSchedule.Generation
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	ocinfrav1 "github.com/openshift/api/config/v1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_getHubIdentity(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = ocinfrav1.AddToScheme(testScheme)
+
+	tests := []struct {
+		name    string
+		objects []client.Object
+		want    string
+	}{
+		{
+			name: "cluster version",
+			objects: []client.Object{
+				&ocinfrav1.ClusterVersion{
+					ObjectMeta: metav1.ObjectMeta{Name: clusterVersionName},
+					Spec:       ocinfrav1.ClusterVersionSpec{ClusterID: "cluster-id"},
+				},
+				&ocinfrav1.Infrastructure{
+					ObjectMeta: metav1.ObjectMeta{Name: infrastructureName},
+					Status:     ocinfrav1.InfrastructureStatus{InfrastructureName: "hub-abcde"},
+				},
+			},
+			want: "cluster-id",
+		},
+		{
+			name: "infrastructure",
+			objects: []client.Object{
+				&ocinfrav1.Infrastructure{
+					ObjectMeta: metav1.ObjectMeta{Name: infrastructureName},
+					Status:     ocinfrav1.InfrastructureStatus{InfrastructureName: "hub-abcde"},
+				},
+			},
+			want: "hub-abcde",
+		},
+		{
+			name: "not an openshift cluster",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(tt.objects...).Build()
+			got, err := getHubIdentity(context.Background(), c)
+			if err != nil {
+				t.Fatalf("getHubIdentity() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getHubIdentity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newHubBackup(name, hubIdentity string, startTime time.Time) veleroapi.Backup {
+	return veleroapi.Backup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{BackupScheduleClusterLabel: hubIdentity},
+		},
+		Status: veleroapi.BackupStatus{StartTimestamp: &metav1.Time{Time: startTime}},
+	}
+}
+
+func Test_getCollidingBackup(t *testing.T) {
+	now := time.Now()
+	schedules := &veleroapi.ScheduleList{Items: []veleroapi.Schedule{
+		{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.Time{Time: now.Add(-time.Hour)}}},
+		{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.Time{Time: now.Add(-2 * time.Hour)}}},
+	}}
+
+	tests := []struct {
+		name    string
+		backups []veleroapi.Backup
+		want    string
+	}{
+		{
+			name: "only this hub backups",
+			backups: []veleroapi.Backup{
+				newHubBackup("acm-resources-schedule-1", "hub1", now),
+			},
+			want: "",
+		},
+		{
+			name: "other hub backups before this hub schedules",
+			backups: []veleroapi.Backup{
+				newHubBackup("acm-resources-schedule-1", "hub2", now.Add(-3*time.Hour)),
+				newHubBackup("acm-resources-schedule-2", "hub1", now),
+			},
+			want: "",
+		},
+		{
+			name: "other hub backups after this hub schedules",
+			backups: []veleroapi.Backup{
+				newHubBackup("acm-resources-schedule-1", "hub2", now.Add(-90*time.Minute)),
+				newHubBackup("acm-resources-schedule-2", "hub1", now.Add(-time.Minute)),
+				newHubBackup("acm-resources-schedule-3", "hub2", now.Add(-30*time.Minute)),
+			},
+			want: "acm-resources-schedule-3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getCollidingBackup(schedules, tt.backups, "hub1")
+			gotName := ""
+			if got != nil {
+				gotName = got.Name
+			}
+			if gotName != tt.want {
+				t.Errorf("getCollidingBackup() = %v, want %v", gotName, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isBackupCollisionActive(t *testing.T) {
+	backupSchedule := &v1beta1.BackupSchedule{ObjectMeta: metav1.ObjectMeta{Generation: 1}}
+	collidingBackup := newHubBackup("acm-resources-schedule-1", "hub2", time.Now())
+
+	setBackupCollisionCondition(backupSchedule, &collidingBackup, "hub1")
+	backupSchedule.Status.Phase = v1beta1.SchedulePhaseBackupCollision
+	if !isBackupCollisionActive(backupSchedule) {
+		t.Errorf("isBackupCollisionActive() = false, want true")
+	}
+
+	// the schedule resumes once its spec is updated
+	backupSchedule.Generation = 2
+	if isBackupCollisionActive(backupSchedule) {
+		t.Errorf("isBackupCollisionActive() = true after a spec update, want false")
+	}
+}
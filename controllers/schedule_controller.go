@@ -26,15 +26,21 @@ import (
 	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
 	"github.com/pkg/errors"
 	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // ResourceType is the type to contain resource type string value
@@ -82,6 +88,9 @@ type BackupScheduleReconciler struct {
 	client.Client
 	DiscoveryClient discovery.DiscoveryInterface
 	Scheme          *runtime.Scheme
+	Recorder        record.EventRecorder
+	// PreflightChecks enables the checks run before creating the velero schedules
+	PreflightChecks bool
 }
 
 //+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=backupschedules,verbs=get;list;watch;create;update;patch;delete
@@ -91,9 +100,24 @@ type BackupScheduleReconciler struct {
 //+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=managedclusters,verbs=get;list;watch
 //+kubebuilder:rbac:groups=apps.open-cluster-management.io,resources=channels,verbs=get;list;watch
 //+kubebuilder:rbac:groups=velero.io,resources=schedules,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=velero.io,resources=backups,verbs=get;list;watch;create;update;patch
-//+kubebuilder:rbac:groups=velero.io,resources=deletebackuprequests,verbs=create;list;watch
+//+kubebuilder:rbac:groups=velero.io,resources=backups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=velero.io,resources=deletebackuprequests,verbs=get;list;watch;create;delete
 //+kubebuilder:rbac:groups=velero.io,resources=backupstoragelocations,verbs=get;list;watch
+//+kubebuilder:rbac:groups=config.openshift.io,resources=clusterversions,verbs=get;list;watch
+//+kubebuilder:rbac:groups=config.openshift.io,resources=infrastructures,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;patch
+//+kubebuilder:rbac:groups=operator.open-cluster-management.io,resources=multiclusterhubs,verbs=get;list;patch
+//+kubebuilder:rbac:groups=velero.io,resources=downloadrequests,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=velero.io,resources=restores,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=selfsubjectaccessreviews,verbs=create
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups=hive.openshift.io,resources=clusterdeployments,verbs=get;list;watch
+//+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=policies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=placementbindings,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps.open-cluster-management.io,resources=subscriptions,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -110,75 +134,63 @@ func (r *BackupScheduleReconciler) Reconcile(
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// don't create schedules if backup storage location doesn't exist or is not avaialble
-	veleroStorageLocations := &veleroapi.BackupStorageLocationList{}
-	if err := r.Client.List(ctx, veleroStorageLocations, &client.ListOptions{}); err != nil ||
-		veleroStorageLocations == nil || len(veleroStorageLocations.Items) == 0 {
-
-		msg := "velero.io.BackupStorageLocation resources not found. " +
-			"Verify you have created a konveyor.openshift.io.Velero or oadp.openshift.io.DataProtectionApplications resource."
-		scheduleLogger.Info(msg)
-
-		backupSchedule.Status.Phase = v1beta1.SchedulePhaseFailedValidation
-		backupSchedule.Status.LastMessage = msg
+	// resume the reconcilers paused by a deleted backup schedule, the finalizer is removed once they are resumed
+	if !backupSchedule.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.resumePausedReconcilers(ctx, backupSchedule)
+	}
 
-		// retry after failureInterval
-		return ctrl.Result{RequeueAfter: failureInterval}, errors.Wrap(
-			r.Client.Status().Update(ctx, backupSchedule),
-			msg,
-		)
+	// pause the reconcilers selected by the schedule hooks shortly before a backup and while it is running,
+	// this also resumes them when the hooks are not valid or a backup collision stops the schedule
+	pausedCheckAfter, pausedErr := r.updatePausedReconcilers(ctx, backupSchedule)
+	if pausedErr != nil {
+		scheduleLogger.Error(pausedErr, "failed to pause or resume the reconcilers")
 	}
 
-	// look for available VeleroStorageLocation
-	// and keep track of the velero oadp namespace
-	veleroNamespace := ""
-	isValidStorageLocation := false
-	for i := range veleroStorageLocations.Items {
-		if veleroStorageLocations.Items[i].OwnerReferences != nil &&
-			veleroStorageLocations.Items[i].Status.Phase == veleroapi.BackupStorageLocationPhaseAvailable {
-			for _, ref := range veleroStorageLocations.Items[i].OwnerReferences {
-				if ref.Kind != "" {
-					isValidStorageLocation = true
-					veleroNamespace = veleroStorageLocations.Items[i].Namespace
-					break
-				}
-			}
-		}
-		if isValidStorageLocation {
-			break
-		}
+	// a backup collision stops the schedule until its spec is updated
+	if isBackupCollisionActive(backupSchedule) {
+		return ctrl.Result{}, nil
 	}
 
-	// if no valid storage location found wait for valid value
-	if !isValidStorageLocation {
-		msg := "Backup storage location is not available. " +
-			"Check velero.io.BackupStorageLocation and validate storage credentials."
+	// don't create schedules if backup storage location doesn't exist or is not avaialble
+	veleroStorageLocations, storageLocationStatus, msg := validateStorageLocation(
+		ctx,
+		r.Client,
+		"Schedule",
+		req.NamespacedName,
+		backupSchedule.Spec.StorageLocation,
+	)
+	backupSchedule.Status.StorageLocation = storageLocationStatus
+	if msg != "" {
 		scheduleLogger.Info(msg)
 
 		backupSchedule.Status.Phase = v1beta1.SchedulePhaseFailedValidation
 		backupSchedule.Status.LastMessage = msg
 
-		// retry after failureInterval
+		// the storage locations watch triggers a new reconcile when a storage location becomes available,
+		// retry after failureInterval in case the storage locations couldn't be listed
 		return ctrl.Result{RequeueAfter: failureInterval}, errors.Wrap(
 			r.Client.Status().Update(ctx, backupSchedule),
 			msg,
 		)
 	}
 
-	// return error if the cluster restore file is not in the same namespace with velero
-	if veleroNamespace != req.Namespace {
+	// the secondary storage locations must be available in the velero namespace
+	if unavailable := getUnavailableStorageLocations(
+		veleroStorageLocations,
+		req.Namespace,
+		backupSchedule.Spec.SecondaryStorageLocations,
+	); len(unavailable) > 0 {
 		msg := fmt.Sprintf(
-			"Schedule resource [%s/%s] must be created in the velero namespace [%s]",
+			"Secondary backup storage locations not available in namespace %s: %s",
 			req.Namespace,
-			req.Name,
-			veleroNamespace,
+			strings.Join(unavailable, ", "),
 		)
 		scheduleLogger.Info(msg)
 
 		backupSchedule.Status.Phase = v1beta1.SchedulePhaseFailedValidation
 		backupSchedule.Status.LastMessage = msg
 
-		return ctrl.Result{}, errors.Wrap(
+		return ctrl.Result{RequeueAfter: failureInterval}, errors.Wrap(
 			r.Client.Status().Update(ctx, backupSchedule),
 			msg,
 		)
@@ -196,6 +208,40 @@ func (r *BackupScheduleReconciler) Reconcile(
 		)
 	}
 
+	if err := validateBackupHooks(backupSchedule); err != nil {
+		msg := err.Error()
+		scheduleLogger.Info(msg)
+
+		backupSchedule.Status.Phase = v1beta1.SchedulePhaseFailedValidation
+		backupSchedule.Status.LastMessage = msg
+
+		return ctrl.Result{}, errors.Wrap(
+			r.Client.Status().Update(ctx, backupSchedule),
+			updateStatusFailedMsg,
+		)
+	}
+
+	// keep the encrypted copies of the credentials in sync, they are backed up instead of the credentials
+	if err := syncSealedCredentials(ctx, r.Client, backupSchedule); err != nil {
+		msg := fmt.Sprintf("Unable to encrypt the credentials: %v", err)
+		scheduleLogger.Info(msg)
+
+		backupSchedule.Status.Phase = v1beta1.SchedulePhaseFailedValidation
+		backupSchedule.Status.LastMessage = msg
+
+		return ctrl.Result{RequeueAfter: failureInterval}, errors.Wrap(
+			r.Client.Status().Update(ctx, backupSchedule),
+			updateStatusFailedMsg,
+		)
+	}
+
+	// the hub identity is set on the backups to detect other hubs using the same storage location
+	hubIdentity, err := getHubIdentity(ctx, r.Client)
+	if err != nil {
+		scheduleLogger.Error(err, "unable to get the hub identity")
+		return ctrl.Result{RequeueAfter: failureInterval}, err
+	}
+
 	// retrieve the velero schedules (if any)
 	veleroScheduleList := veleroapi.ScheduleList{}
 	if err := r.List(
@@ -215,7 +261,33 @@ func (r *BackupScheduleReconciler) Reconcile(
 
 	// no velero schedules, so create them
 	if len(veleroScheduleList.Items) == 0 {
-		err := r.initVeleroSchedules(ctx, backupSchedule)
+		if r.PreflightChecks {
+			backupSchedule.Status.PreflightChecks = runPreflightChecks(
+				ctx,
+				r.Client,
+				r.DiscoveryClient,
+				req.Namespace,
+				backupSchedule.Spec.StorageLocation,
+				schedulePermissions,
+			)
+			if failed := getFailedPreflightChecks(backupSchedule.Status.PreflightChecks); len(failed) > 0 {
+				msg := "Pre-flight checks failed: " + strings.Join(failed, "; ")
+				scheduleLogger.Info(msg)
+				backupSchedule.Status.Phase = v1beta1.SchedulePhaseFailedValidation
+				backupSchedule.Status.LastMessage = msg
+				return ctrl.Result{RequeueAfter: preflightCheckInterval}, errors.Wrap(
+					r.Client.Status().Update(ctx, backupSchedule),
+					updateStatusFailedMsg,
+				)
+			}
+		}
+
+		// the first backups of the new velero schedules start right away
+		if err := labelReferencedConfigMaps(ctx, r.Client); err != nil {
+			scheduleLogger.Error(err, "failed to label the referenced ConfigMaps")
+		}
+
+		err := r.initVeleroSchedules(ctx, backupSchedule, hubIdentity)
 		if err != nil {
 			msg := fmt.Errorf(FailedPhaseMsg+": %v", err)
 			scheduleLogger.Error(err, err.Error())
@@ -225,6 +297,9 @@ func (r *BackupScheduleReconciler) Reconcile(
 			backupSchedule.Status.LastMessage = NewPhaseMsg
 			backupSchedule.Status.Phase = v1beta1.SchedulePhaseNew
 		}
+		if hubIdentity != "" {
+			setBackupCollisionCondition(backupSchedule, nil, hubIdentity)
+		}
 
 		return ctrl.Result{RequeueAfter: deleteBackupRequeueInterval}, errors.Wrap(
 			r.Client.Status().Update(ctx, backupSchedule),
@@ -236,6 +311,10 @@ func (r *BackupScheduleReconciler) Reconcile(
 	// delete velero schedules if their spec needs to be updated or any of them is missing
 	// New velero schedules will be created in the next reconcile triggerd by the deletion
 	if isScheduleSpecUpdated(&veleroScheduleList, backupSchedule) ||
+		isScheduleHubIdentityUpdated(&veleroScheduleList, hubIdentity) ||
+		isScheduleStorageLocationUpdated(&veleroScheduleList, backupSchedule) ||
+		isScheduleEncryptionUpdated(&veleroScheduleList, backupSchedule) ||
+		isScheduleHooksUpdated(&veleroScheduleList, backupSchedule) ||
 		len(veleroScheduleList.Items) < len(veleroScheduleNames) {
 		if err := r.deleteVeleroSchedules(ctx, backupSchedule, &veleroScheduleList); err != nil {
 			return ctrl.Result{}, err
@@ -247,17 +326,93 @@ func (r *BackupScheduleReconciler) Reconcile(
 		)
 	}
 
+	// refuse to run if another hub produces backups in the same storage location
+	if hubIdentity != "" {
+		collidingBackup, err := r.getCollidingBackup(ctx, &veleroScheduleList, hubIdentity)
+		if err != nil {
+			return ctrl.Result{RequeueAfter: failureInterval}, err
+		}
+		setBackupCollisionCondition(backupSchedule, collidingBackup, hubIdentity)
+		if collidingBackup != nil {
+			return ctrl.Result{}, r.stopOnBackupCollision(ctx, backupSchedule, &veleroScheduleList, collidingBackup)
+		}
+	}
+
 	// velero schedules already exist, update schedule status with latest velero schedules
 	for i := range veleroScheduleList.Items {
 		updateScheduleStatus(ctx, &veleroScheduleList.Items[i], backupSchedule)
 	}
 	setSchedulePhase(&veleroScheduleList, backupSchedule)
 
+	requeueAfter := deleteBackupRequeueInterval
+
+	// report the velero backups running for longer than the backup timeout
+	timedOut, timeLeft, err := r.checkStuckVeleroBackups(ctx, backupSchedule, veleroScheduleList.Items)
+	if err != nil {
+		scheduleLogger.Error(err, "failed to check the velero backups timeout")
+		requeueAfter = failureInterval
+	} else if len(timedOut) > 0 {
+		backupSchedule.Status.Phase = v1beta1.SchedulePhaseFailed
+		backupSchedule.Status.LastMessage = fmt.Sprintf(
+			"Velero backups have been running for more than %s: %s",
+			backupSchedule.Spec.VeleroBackupTimeout.Duration,
+			strings.Join(timedOut, ", "),
+		)
+	} else if timeLeft > 0 && timeLeft < requeueAfter {
+		// check again when the next velero backup times out
+		requeueAfter = timeLeft
+	}
+
+	// check the paused reconcilers again when the next backup is due or while they are paused
+	if pausedErr != nil {
+		requeueAfter = failureInterval
+	} else if pausedCheckAfter > 0 && pausedCheckAfter < requeueAfter {
+		requeueAfter = pausedCheckAfter
+	}
+
+	// compare the content of the latest completed backups with the hub resources
+	if err := r.verifyLatestBackups(ctx, backupSchedule); err != nil {
+		if errors.Is(err, errDownloadNotReady) {
+			requeueAfter = downloadRequestInterval
+		} else {
+			scheduleLogger.Error(err, "failed to verify the latest backups")
+		}
+	}
+
+	// save the ConfigMaps referenced by the backed up resources with the generic resources backup,
+	// labeled shortly before each scheduled backup
+	if due, untilDue := isBackupDue(veleroScheduleList.Items, time.Now()); due {
+		if err := labelReferencedConfigMaps(ctx, r.Client); err != nil {
+			scheduleLogger.Error(err, "failed to label the referenced ConfigMaps")
+		}
+	} else if untilDue > 0 && untilDue < requeueAfter {
+		requeueAfter = untilDue
+	}
+
+	// report the references from the backed up resources which would be broken after a restore
+	if err := r.updateDependencyReport(ctx, backupSchedule, veleroScheduleList.Items); err != nil {
+		scheduleLogger.Error(err, "failed to analyze the backed up resources references")
+	}
+
+	// report the secrets saved by the credentials backups
+	if err := r.updateCredentialsInventory(ctx, backupSchedule); err != nil {
+		scheduleLogger.Error(err, "failed to update the credentials inventory")
+	}
+
+	// restore the latest backups into sandbox namespaces, when the restore test is enabled
+	restoreTestRequeue, err := r.runRestoreTest(ctx, backupSchedule)
+	if err != nil {
+		scheduleLogger.Error(err, "failed to run the test restore")
+	}
+	if restoreTestRequeue < requeueAfter {
+		requeueAfter = restoreTestRequeue
+	}
+
 	// clean up old backups if they exceed the maxBackups number after backupDeleteRequeueInterval
 	cleanupBackups(ctx, backupSchedule.Spec.MaxBackups, r.Client)
 
-	err := r.Client.Status().Update(ctx, backupSchedule)
-	return ctrl.Result{RequeueAfter: deleteBackupRequeueInterval}, errors.Wrap(
+	err = r.Client.Status().Update(ctx, backupSchedule)
+	return ctrl.Result{RequeueAfter: requeueAfter}, errors.Wrap(
 		err,
 		fmt.Sprintf(
 			"could not update status for schedule %s/%s",
@@ -271,6 +426,7 @@ func (r *BackupScheduleReconciler) Reconcile(
 func (r *BackupScheduleReconciler) initVeleroSchedules(
 	ctx context.Context,
 	backupSchedule *v1beta1.BackupSchedule,
+	hubIdentity string,
 ) error {
 	scheduleLogger := log.FromContext(ctx)
 
@@ -293,6 +449,10 @@ func (r *BackupScheduleReconciler) initVeleroSchedules(
 		veleroSchedule := &veleroapi.Schedule{}
 		veleroSchedule.Name = veleroScheduleIdentity.Name
 		veleroSchedule.Namespace = veleroScheduleIdentity.Namespace
+		if hubIdentity != "" {
+			// velero sets the schedule labels on the backups
+			veleroSchedule.Labels = map[string]string{BackupScheduleClusterLabel: hubIdentity}
+		}
 
 		// create backup based on resource type
 		veleroBackupTemplate := &veleroapi.BackupSpec{}
@@ -312,32 +472,50 @@ func (r *BackupScheduleReconciler) initVeleroSchedules(
 			setGenericResourcesBackupInfo(ctx, veleroBackupTemplate, resourcesToBackup, r.Client)
 
 		}
+		excludeRestoreTestNamespaces(veleroBackupTemplate)
+		if credentialsType := getScheduleCredentialsType(veleroSchedule.Name); credentialsType != "" &&
+			backupSchedule.Spec.CredentialsEncryption != nil {
+			setSealedCredsBackupInfo(veleroBackupTemplate, credentialsType)
+		}
+		veleroBackupTemplate.Hooks = getVeleroBackupHooks(backupSchedule, scheduleKey)
 
 		veleroSchedule.Spec.Template = *veleroBackupTemplate
+		veleroSchedule.Spec.Template.StorageLocation = backupSchedule.Spec.StorageLocation
 		veleroSchedule.Spec.Schedule = backupSchedule.Spec.VeleroSchedule
 		if backupSchedule.Spec.VeleroTTL.Duration != 0 {
 			veleroSchedule.Spec.Template.TTL = backupSchedule.Spec.VeleroTTL
 		}
 
-		if err := ctrl.SetControllerReference(backupSchedule, veleroSchedule, r.Scheme); err != nil {
-			return err
+		// the same backups are saved in each secondary storage location
+		veleroSchedules := []*veleroapi.Schedule{veleroSchedule}
+		for _, location := range backupSchedule.Spec.SecondaryStorageLocations {
+			secondarySchedule := veleroSchedule.DeepCopy()
+			secondarySchedule.Name = getSecondaryScheduleName(veleroSchedule.Name, location)
+			secondarySchedule.Spec.Template.StorageLocation = location
+			veleroSchedules = append(veleroSchedules, secondarySchedule)
 		}
 
-		err := r.Create(ctx, veleroSchedule, &client.CreateOptions{})
-		if err != nil {
-			scheduleLogger.Error(
-				err,
-				"Error in creating velero.io.Schedule",
-				"name", veleroScheduleIdentity.Name,
-				"namespace", veleroScheduleIdentity.Namespace,
+		for _, schedule := range veleroSchedules {
+			if err := ctrl.SetControllerReference(backupSchedule, schedule, r.Scheme); err != nil {
+				return err
+			}
+
+			err := r.Create(ctx, schedule, &client.CreateOptions{})
+			if err != nil {
+				scheduleLogger.Error(
+					err,
+					"Error in creating velero.io.Schedule",
+					"name", schedule.Name,
+					"namespace", schedule.Namespace,
+				)
+				return err
+			}
+			scheduleLogger.Info(
+				"Velero schedule created",
+				"name", schedule.Name,
+				"namespace", schedule.Namespace,
 			)
-			return err
 		}
-		scheduleLogger.Info(
-			"Velero schedule created",
-			"name", veleroSchedule.Name,
-			"namespace", veleroSchedule.Namespace,
-		)
 
 		// set veleroSchedule in backupSchedule status
 		setVeleroScheduleInStatus(scheduleKey, veleroSchedule, backupSchedule)
@@ -385,6 +563,56 @@ func (r *BackupScheduleReconciler) deleteVeleroSchedules(
 	return nil
 }
 
+// returns the newest backup produced by another hub in the velero namespace
+// after the velero schedules of this hub were created
+func (r *BackupScheduleReconciler) getCollidingBackup(
+	ctx context.Context,
+	schedules *veleroapi.ScheduleList,
+	hubIdentity string,
+) (*veleroapi.Backup, error) {
+	veleroBackups := &veleroapi.BackupList{}
+	if err := r.List(
+		ctx,
+		veleroBackups,
+		client.InNamespace(schedules.Items[0].Namespace),
+		client.HasLabels{BackupScheduleClusterLabel},
+	); err != nil {
+		return nil, errors.Wrap(err, "unable to list velero backups")
+	}
+	return getCollidingBackup(schedules, veleroBackups.Items, hubIdentity), nil
+}
+
+// stop producing backups when another hub writes backups to the same storage location
+func (r *BackupScheduleReconciler) stopOnBackupCollision(
+	ctx context.Context,
+	backupSchedule *v1beta1.BackupSchedule,
+	schedules *veleroapi.ScheduleList,
+	collidingBackup *veleroapi.Backup,
+) error {
+	scheduleLogger := log.FromContext(ctx)
+
+	msg := fmt.Sprintf(
+		"Backup %s was produced by another hub %s in the same storage location. "+
+			"The velero schedules were removed; stop the BackupSchedule on the other hub, "+
+			"then update this BackupSchedule spec or recreate it to resume the backups.",
+		collidingBackup.Name,
+		collidingBackup.Labels[BackupScheduleClusterLabel],
+	)
+	scheduleLogger.Info(msg)
+
+	backupSchedule.Status.Phase = v1beta1.SchedulePhaseBackupCollision
+	backupSchedule.Status.LastMessage = msg
+	backupSchedule.Status.VeleroScheduleCredentials = nil
+	backupSchedule.Status.VeleroScheduleManagedClusters = nil
+	backupSchedule.Status.VeleroScheduleResources = nil
+
+	// update the status first so the reconcile triggered by the deletion doesn't recreate the schedules
+	if err := r.Client.Status().Update(ctx, backupSchedule); err != nil {
+		return errors.Wrap(err, updateStatusFailedMsg)
+	}
+	return r.deleteVeleroSchedules(ctx, backupSchedule.DeepCopy(), schedules)
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *BackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	if err := mgr.GetFieldIndexer().IndexField(
@@ -406,14 +634,67 @@ func (r *BackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	generationChanged := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			// Ignore updates to CR status in which case metadata.Generation does not change
+			return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration()
+		},
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1beta1.BackupSchedule{}).
-		Owns(&veleroapi.Schedule{}).
-		WithEventFilter(predicate.Funcs{
-			UpdateFunc: func(e event.UpdateEvent) bool {
-				// Ignore updates to CR status in which case metadata.Generation does not change
-				return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration()
-			},
-		}).
+		For(&v1beta1.BackupSchedule{}, builder.WithPredicates(generationChanged)).
+		Owns(&veleroapi.Schedule{}, builder.WithPredicates(generationChanged)).
+		Watches(
+			&source.Kind{Type: &veleroapi.BackupStorageLocation{}},
+			handler.EnqueueRequestsFromMapFunc(r.getAllSchedules),
+			builder.WithPredicates(storageLocationChanged),
+		).
+		Watches(
+			&source.Kind{Type: &veleroapi.Backup{}},
+			handler.EnqueueRequestsFromMapFunc(r.getSchedulesForBackup),
+			builder.WithPredicates(backupCompleted),
+		).
+		Watches(
+			&source.Kind{Type: &veleroapi.Backup{}},
+			handler.EnqueueRequestsFromMapFunc(r.getSchedulesForBackup),
+			builder.WithPredicates(backupRunningChanged),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.getAllSchedules),
+			builder.WithPredicates(credentialsSecretChanged),
+		).
 		Complete(r)
 }
+
+// returns the backup schedules to reconcile when a velero backup from their namespace completes
+func (r *BackupScheduleReconciler) getSchedulesForBackup(obj client.Object) []reconcile.Request {
+	backupSchedules := &v1beta1.BackupScheduleList{}
+	if err := r.List(context.Background(), backupSchedules, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(backupSchedules.Items))
+	for i := range backupSchedules.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      backupSchedules.Items[i].Name,
+			Namespace: backupSchedules.Items[i].Namespace,
+		}})
+	}
+	return requests
+}
+
+// returns all the backup schedules to reconcile, when a storage location or a backed up secret changes
+func (r *BackupScheduleReconciler) getAllSchedules(client.Object) []reconcile.Request {
+	backupSchedules := &v1beta1.BackupScheduleList{}
+	if err := r.List(context.Background(), backupSchedules); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(backupSchedules.Items))
+	for i := range backupSchedules.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      backupSchedules.Items[i].Name,
+			Namespace: backupSchedules.Items[i].Namespace,
+		}})
+	}
+	return requests
+}
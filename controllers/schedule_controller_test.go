@@ -916,7 +916,7 @@ var _ = Describe("BackupSchedule controller", func() {
 
 				Expect(
 					createdScheduleNew.Status.LastMessage,
-				).Should(BeIdenticalTo("Backup storage location is not available. " +
+				).Should(BeIdenticalTo("Backup storage location not available in namespace " + newVeleroNamespace + ". " +
 					"Check velero.io.BackupStorageLocation and validate storage credentials."))
 			},
 		)
@@ -0,0 +1,267 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const storageLocationsNotFoundMsg = "velero.io.BackupStorageLocation resources not found. " +
+	"Verify you have created a konveyor.openshift.io.Velero or oadp.openshift.io.DataProtectionApplications resource."
+
+// validates the storage location used by a BackupSchedule or Restore resource of this kind;
+// returns the storage locations found on the hub, the status of the storage location
+// used by the resource and a message if no valid storage location is found
+func validateStorageLocation(
+	ctx context.Context,
+	c client.Client,
+	kind string,
+	req types.NamespacedName,
+	selectedName string,
+) (*veleroapi.BackupStorageLocationList, *v1beta1.StorageLocationStatus, string) {
+	locations := &veleroapi.BackupStorageLocationList{}
+	if err := c.List(ctx, locations, &client.ListOptions{}); err != nil || len(locations.Items) == 0 {
+		return locations, nil, storageLocationsNotFoundMsg
+	}
+
+	// look for an available storage location and keep track of the velero oadp namespace
+	var validLocation *veleroapi.BackupStorageLocation
+	for i := range locations.Items {
+		if isValidStorageLocation(&locations.Items[i], selectedName) {
+			validLocation = &locations.Items[i]
+			break
+		}
+	}
+
+	if validLocation == nil {
+		msg := "Backup storage location not available in namespace " + req.Namespace + ". "
+		if selectedName != "" {
+			msg = fmt.Sprintf("Backup storage location %s not available in namespace %s. ", selectedName, req.Namespace)
+		}
+		msg += "Check velero.io.BackupStorageLocation and validate storage credentials."
+		return locations,
+			getStorageLocationStatus(findStorageLocation(locations, req.Namespace, selectedName)),
+			msg
+	}
+
+	status := getStorageLocationStatus(validLocation)
+	// the resource must be in the same namespace with velero
+	if validLocation.Namespace != req.Namespace {
+		return locations, status, fmt.Sprintf(
+			"%s resource [%s/%s] must be created in the velero namespace [%s]",
+			kind,
+			req.Namespace,
+			req.Name,
+			validLocation.Namespace,
+		)
+	}
+	return locations, status, ""
+}
+
+// returns the selected storage location from this namespace,
+// or the first storage location from this namespace if none is selected
+func findStorageLocation(
+	locations *veleroapi.BackupStorageLocationList,
+	namespace string,
+	selectedName string,
+) *veleroapi.BackupStorageLocation {
+	for i := range locations.Items {
+		if locations.Items[i].Namespace == namespace &&
+			(selectedName == "" || locations.Items[i].Name == selectedName) {
+			return &locations.Items[i]
+		}
+	}
+	return nil
+}
+
+// returns the validation status of the storage location, nil if there is no storage location
+func getStorageLocationStatus(location *veleroapi.BackupStorageLocation) *v1beta1.StorageLocationStatus {
+	if location == nil {
+		return nil
+	}
+	status := &v1beta1.StorageLocationStatus{
+		Name:               location.Name,
+		Phase:              string(location.Status.Phase),
+		LastValidationTime: location.Status.LastValidationTime.DeepCopy(),
+	}
+	switch {
+	case location.Status.Phase == "":
+		status.ValidationError = "the storage location was not validated by velero"
+	case location.Status.Phase != veleroapi.BackupStorageLocationPhaseAvailable:
+		status.ValidationError = fmt.Sprintf(
+			"velero can't access the storage location, check the %s credentials and bucket",
+			location.Spec.Provider,
+		)
+	}
+	return status
+}
+
+// storageLocationChanged triggers a reconcile when a storage location
+// is created, deleted or its availability changes
+var storageLocationChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldLocation, okOld := e.ObjectOld.(*veleroapi.BackupStorageLocation)
+		newLocation, okNew := e.ObjectNew.(*veleroapi.BackupStorageLocation)
+		return !okOld || !okNew || oldLocation.Status.Phase != newLocation.Status.Phase
+	},
+}
+
+// returns true if the storage location is available and is the selected location,
+// or a location created by the OADP operator when no location is selected
+func isValidStorageLocation(location *veleroapi.BackupStorageLocation, selectedName string) bool {
+	if location.Status.Phase != veleroapi.BackupStorageLocationPhaseAvailable {
+		return false
+	}
+	if selectedName != "" {
+		return location.Name == selectedName
+	}
+	for _, ref := range location.OwnerReferences {
+		if ref.Kind != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the names of the storage locations not available in the velero namespace
+func getUnavailableStorageLocations(
+	locations *veleroapi.BackupStorageLocationList,
+	namespace string,
+	names []string,
+) []string {
+	unavailable := []string{}
+	for _, name := range names {
+		available := false
+		for i := range locations.Items {
+			if locations.Items[i].Namespace == namespace &&
+				isValidStorageLocation(&locations.Items[i], name) {
+				available = true
+				break
+			}
+		}
+		if !available {
+			unavailable = append(unavailable, name)
+		}
+	}
+	return unavailable
+}
+
+// returns the name of the velero schedule saving backups in a secondary storage location
+func getSecondaryScheduleName(scheduleName string, storageLocation string) string {
+	return scheduleName + "-" + storageLocation
+}
+
+// returns the storage location of each velero schedule created for the backup schedule,
+// by velero schedule name
+func getVeleroScheduleStorageLocations(backupSchedule *v1beta1.BackupSchedule) map[string]string {
+	locations := make(map[string]string)
+	for _, scheduleName := range veleroScheduleNames {
+		locations[scheduleName] = backupSchedule.Spec.StorageLocation
+		for _, location := range backupSchedule.Spec.SecondaryStorageLocations {
+			locations[getSecondaryScheduleName(scheduleName, location)] = location
+		}
+	}
+	return locations
+}
+
+// returns true if the velero schedules don't match the storage locations of the backup schedule
+func isScheduleStorageLocationUpdated(
+	schedules *veleroapi.ScheduleList,
+	backupSchedule *v1beta1.BackupSchedule,
+) bool {
+	locations := getVeleroScheduleStorageLocations(backupSchedule)
+	if len(schedules.Items) != len(locations) {
+		return true
+	}
+	for i := range schedules.Items {
+		location, ok := locations[schedules.Items[i].Name]
+		if !ok || schedules.Items[i].Spec.Template.StorageLocation != location {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the suffix added to the primary velero schedule name by the velero schedule which produced the backup:
+// empty for the backups of the primary schedules, -<location> for the backups of the schedules of a secondary
+// storage location
+func getBackupScheduleSuffix(backupName string) string {
+	timestampIndex := strings.LastIndex(backupName, "-")
+	if timestampIndex == -1 {
+		return ""
+	}
+	scheduleName := backupName[:timestampIndex]
+	for _, name := range veleroScheduleNames {
+		if strings.HasPrefix(scheduleName, name+"-") {
+			return strings.TrimPrefix(scheduleName, name)
+		}
+	}
+	return ""
+}
+
+// returns true if the latest backups can be restored from this backup: the backups of the schedules
+// of a secondary storage location are independent from the primary backups and are only restored
+// when the restore selects a storage location
+func isLatestBackupCandidate(restore *v1beta1.Restore, backup *veleroapi.Backup) bool {
+	if restore.Spec.StorageLocation == "" {
+		return getBackupScheduleSuffix(backup.Name) == ""
+	}
+	return backup.Spec.StorageLocation == restore.Spec.StorageLocation
+}
+
+// returns true if the backup is saved in the storage location selected by the restore, if any
+func isBackupInStorageLocation(restore *v1beta1.Restore, backup *veleroapi.Backup) bool {
+	return restore.Spec.StorageLocation == "" ||
+		backup.Spec.StorageLocation == restore.Spec.StorageLocation
+}
+
+// returns the backup of this resource type with this timestamp suffix, saved in the storage location
+// selected by the restore by the velero schedule of a secondary storage location
+func (r *RestoreReconciler) findSecondaryBackup(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	resourceType ResourceType,
+	backupTimestamp string,
+) (*veleroapi.Backup, error) {
+	veleroBackups := &veleroapi.BackupList{}
+	if err := r.List(ctx, veleroBackups, getRestoreBackupListOptions(restore)...); err != nil {
+		return nil, fmt.Errorf("unable to list velero backups: %v", err)
+	}
+	for i := range veleroBackups.Items {
+		backup := &veleroBackups.Items[i]
+		if strings.HasPrefix(backup.Name, veleroScheduleNames[resourceType]+"-") &&
+			strings.HasSuffix(backup.Name, backupTimestamp) &&
+			isBackupInStorageLocation(restore, backup) {
+			return backup, nil
+		}
+	}
+	return nil, k8serr.NewNotFound(
+		schema.GroupResource{Group: veleroapi.SchemeGroupVersion.Group, Resource: "backups"},
+		veleroScheduleNames[resourceType]+"-*"+backupTimestamp,
+	)
+}
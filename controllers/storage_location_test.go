@@ -0,0 +1,286 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newStorageLocation(
+	name string,
+	owned bool,
+	phase veleroapi.BackupStorageLocationPhase,
+) veleroapi.BackupStorageLocation {
+	location := veleroapi.BackupStorageLocation{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "velero"},
+		Status:     veleroapi.BackupStorageLocationStatus{Phase: phase},
+	}
+	if owned {
+		location.OwnerReferences = []metav1.OwnerReference{{Kind: "DataProtectionApplication"}}
+	}
+	return location
+}
+
+func Test_isValidStorageLocation(t *testing.T) {
+	tests := []struct {
+		name         string
+		location     veleroapi.BackupStorageLocation
+		selectedName string
+		want         bool
+	}{
+		{
+			name:     "owned and available",
+			location: newStorageLocation("default", true, veleroapi.BackupStorageLocationPhaseAvailable),
+			want:     true,
+		},
+		{
+			name:     "not owned",
+			location: newStorageLocation("default", false, veleroapi.BackupStorageLocationPhaseAvailable),
+			want:     false,
+		},
+		{
+			name:     "unavailable",
+			location: newStorageLocation("default", true, veleroapi.BackupStorageLocationPhaseUnavailable),
+			want:     false,
+		},
+		{
+			name:         "selected location",
+			location:     newStorageLocation("dr", false, veleroapi.BackupStorageLocationPhaseAvailable),
+			selectedName: "dr",
+			want:         true,
+		},
+		{
+			name:         "another location selected",
+			location:     newStorageLocation("default", true, veleroapi.BackupStorageLocationPhaseAvailable),
+			selectedName: "dr",
+			want:         false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isValidStorageLocation(&tt.location, tt.selectedName); got != tt.want {
+				t.Errorf("isValidStorageLocation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getUnavailableStorageLocations(t *testing.T) {
+	locations := &veleroapi.BackupStorageLocationList{Items: []veleroapi.BackupStorageLocation{
+		newStorageLocation("default", true, veleroapi.BackupStorageLocationPhaseAvailable),
+		newStorageLocation("dr", false, veleroapi.BackupStorageLocationPhaseAvailable),
+		newStorageLocation("dr-2", false, veleroapi.BackupStorageLocationPhaseUnavailable),
+	}}
+	got := getUnavailableStorageLocations(locations, "velero", []string{"dr", "dr-2", "dr-3"})
+	if !reflect.DeepEqual(got, []string{"dr-2", "dr-3"}) {
+		t.Errorf("getUnavailableStorageLocations() = %v", got)
+	}
+}
+
+func Test_isScheduleStorageLocationUpdated(t *testing.T) {
+	backupSchedule := &v1beta1.BackupSchedule{
+		Spec: v1beta1.BackupScheduleSpec{StorageLocation: "default", SecondaryStorageLocations: []string{"dr"}},
+	}
+	schedules := &veleroapi.ScheduleList{}
+	for scheduleName, location := range getVeleroScheduleStorageLocations(backupSchedule) {
+		schedule := veleroapi.Schedule{ObjectMeta: metav1.ObjectMeta{Name: scheduleName}}
+		schedule.Spec.Template.StorageLocation = location
+		schedules.Items = append(schedules.Items, schedule)
+	}
+	if len(schedules.Items) != 2*len(veleroScheduleNames) {
+		t.Fatalf("getVeleroScheduleStorageLocations() returned %d schedules", len(schedules.Items))
+	}
+	if isScheduleStorageLocationUpdated(schedules, backupSchedule) {
+		t.Errorf("isScheduleStorageLocationUpdated() = true, want false")
+	}
+
+	backupSchedule.Spec.SecondaryStorageLocations = []string{"dr-2"}
+	if !isScheduleStorageLocationUpdated(schedules, backupSchedule) {
+		t.Errorf("isScheduleStorageLocationUpdated() = false after a location change, want true")
+	}
+}
+
+func Test_getVeleroBackupName_storageLocation(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = veleroapi.AddToScheme(testScheme)
+
+	now := time.Now()
+	primaryBackup := newSourceHubBackup("acm-resources-schedule-20210910181336", "hub1", now)
+	primaryBackup.Spec.StorageLocation = "default"
+	secondaryBackup := newSourceHubBackup("acm-resources-schedule-dr-20210910181336", "hub1", now)
+	secondaryBackup.Spec.StorageLocation = "dr"
+	// the secondary schedules run independently from the primary schedules
+	newerSecondaryBackup := newSourceHubBackup("acm-resources-schedule-dr-20210910191336", "hub1", now.Add(time.Hour))
+	newerSecondaryBackup.Spec.StorageLocation = "dr"
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		primaryBackup,
+		secondaryBackup,
+		newerSecondaryBackup,
+	).Build()
+	r := &RestoreReconciler{Client: c}
+
+	tests := []struct {
+		name            string
+		storageLocation string
+		backupName      string
+		want            string
+		wantErr         bool
+	}{
+		{
+			name:       "name from any location",
+			backupName: "acm-credentials-schedule-20210910181336",
+			want:       "acm-resources-schedule-20210910181336",
+		},
+		{
+			name:       "name of a secondary backup from any location",
+			backupName: "acm-credentials-schedule-dr-20210910181336",
+			want:       "acm-resources-schedule-dr-20210910181336",
+		},
+		{
+			name:       "latest from any location",
+			backupName: latestBackupStr,
+			want:       "acm-resources-schedule-20210910181336",
+		},
+		{
+			name:            "name from secondary location",
+			storageLocation: "dr",
+			backupName:      "acm-credentials-schedule-20210910181336",
+			want:            "acm-resources-schedule-dr-20210910181336",
+		},
+		{
+			name:            "latest from secondary location",
+			storageLocation: "dr",
+			backupName:      latestBackupStr,
+			want:            "acm-resources-schedule-dr-20210910191336",
+		},
+		{
+			name:            "unknown location",
+			storageLocation: "dr-2",
+			backupName:      "acm-credentials-schedule-20210910181336",
+			wantErr:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restore := &v1beta1.Restore{
+				ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "velero"},
+				Spec:       v1beta1.RestoreSpec{StorageLocation: tt.storageLocation},
+			}
+			got, err := r.getVeleroBackupName(context.Background(), restore, Resources, tt.backupName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getVeleroBackupName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getVeleroBackupName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateStorageLocation(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = veleroapi.AddToScheme(testScheme)
+
+	validated := metav1.Now()
+	available := newStorageLocation("default", true, veleroapi.BackupStorageLocationPhaseAvailable)
+	available.Status.LastValidationTime = &validated
+	unavailable := newStorageLocation("dr", true, veleroapi.BackupStorageLocationPhaseUnavailable)
+	unavailable.Spec.Provider = "aws"
+
+	tests := []struct {
+		name         string
+		locations    []veleroapi.BackupStorageLocation
+		namespace    string
+		selectedName string
+		wantMsg      string
+		wantStatus   *v1beta1.StorageLocationStatus
+	}{
+		{
+			name:      "no storage location",
+			namespace: "velero",
+			wantMsg:   storageLocationsNotFoundMsg,
+		},
+		{
+			name:      "available",
+			locations: []veleroapi.BackupStorageLocation{available, unavailable},
+			namespace: "velero",
+			wantStatus: &v1beta1.StorageLocationStatus{
+				Name:               "default",
+				Phase:              "Available",
+				LastValidationTime: &validated,
+			},
+		},
+		{
+			name:         "selected location unavailable",
+			locations:    []veleroapi.BackupStorageLocation{available, unavailable},
+			namespace:    "velero",
+			selectedName: "dr",
+			wantMsg: "Backup storage location dr not available in namespace velero. " +
+				"Check velero.io.BackupStorageLocation and validate storage credentials.",
+			wantStatus: &v1beta1.StorageLocationStatus{
+				Name:            "dr",
+				Phase:           "Unavailable",
+				ValidationError: "velero can't access the storage location, check the aws credentials and bucket",
+			},
+		},
+		{
+			name:      "another namespace",
+			locations: []veleroapi.BackupStorageLocation{available},
+			namespace: "default",
+			wantMsg:   "Schedule resource [default/schedule] must be created in the velero namespace [velero]",
+			wantStatus: &v1beta1.StorageLocationStatus{
+				Name:               "default",
+				Phase:              "Available",
+				LastValidationTime: &validated,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(testScheme).WithLists(
+				&veleroapi.BackupStorageLocationList{Items: tt.locations},
+			).Build()
+			_, status, msg := validateStorageLocation(
+				context.Background(),
+				c,
+				"Schedule",
+				types.NamespacedName{Name: "schedule", Namespace: tt.namespace},
+				tt.selectedName,
+			)
+			if msg != tt.wantMsg {
+				t.Errorf("validateStorageLocation() msg = %v, want %v", msg, tt.wantMsg)
+			}
+			if status != nil && status.LastValidationTime != nil {
+				// the fake client doesn't keep the sub-second time precision
+				status.LastValidationTime = &validated
+			}
+			if !reflect.DeepEqual(status, tt.wantStatus) {
+				t.Errorf("validateStorageLocation() status = %v, want %v", status, tt.wantStatus)
+			}
+		})
+	}
+}
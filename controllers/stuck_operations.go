@@ -0,0 +1,253 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// annotation set on the velero backups and restores running for longer than their timeout,
+	// with the timeout as value
+	timedOutAnnotation = "cluster.open-cluster-management.io/timed-out"
+	// max number of timed out velero backups reported by a schedule
+	maxTimedOutVeleroBackups = 10
+)
+
+// returns the time left before a velero operation created or started at the given times times out;
+// a velero operation waiting to start times out from its creation
+func getVeleroOperationTimeLeft(
+	creationTime metav1.Time,
+	startTime *metav1.Time,
+	timeout *metav1.Duration,
+	now time.Time,
+) time.Duration {
+	start := creationTime.Time
+	if startTime != nil {
+		start = startTime.Time
+	}
+	return start.Add(timeout.Duration).Sub(now)
+}
+
+// returns true if the timeout is set
+func isVeleroTimeoutSet(timeout *metav1.Duration) bool {
+	return timeout != nil && timeout.Duration > 0
+}
+
+// requests velero to delete the stuck velero backup with its data in the storage location; deleting the
+// velero backup alone would let the backup sync create it again. Velero refuses to delete a backup it is
+// still processing, the processed request is then replaced by a new one
+func requestVeleroBackupDeletion(ctx context.Context, c client.Client, backup *veleroapi.Backup) error {
+	request := &veleroapi.DeleteBackupRequest{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: backup.Namespace, Name: backup.Name}, request)
+	if err == nil {
+		if request.Status.Phase != veleroapi.DeleteBackupRequestPhaseProcessed {
+			return nil
+		}
+		if err := c.Delete(ctx, request); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	} else if !k8serr.IsNotFound(err) {
+		return err
+	}
+
+	request = &veleroapi.DeleteBackupRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: backup.Name, Namespace: backup.Namespace},
+		Spec:       veleroapi.DeleteBackupRequestSpec{BackupName: backup.Name},
+	}
+	if err := c.Create(ctx, request); err != nil && !k8serr.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// annotates the velero backup or restore running for longer than its timeout,
+// or deletes it according to the policy
+func handleStuckVeleroObject(
+	ctx context.Context,
+	c client.Client,
+	obj client.Object,
+	timeout *metav1.Duration,
+	policy v1beta1.StuckOperationPolicy,
+) error {
+	if policy == v1beta1.StuckOperationPolicyDelete {
+		if backup, ok := obj.(*veleroapi.Backup); ok {
+			return requestVeleroBackupDeletion(ctx, c, backup)
+		}
+		// velero can't cancel a restore, deleting the velero restore only removes it from the cluster
+		return client.IgnoreNotFound(c.Delete(ctx, obj))
+	}
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[timedOutAnnotation]; ok {
+		return nil
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[timedOutAnnotation] = timeout.Duration.String()
+	obj.SetAnnotations(annotations)
+	return c.Update(ctx, obj)
+}
+
+// returns true if the velero backup is not processed yet, new or in progress
+func isVeleroBackupRunning(veleroBackup *veleroapi.Backup) bool {
+	return veleroBackup.Status.Phase == "" ||
+		veleroBackup.Status.Phase == veleroapi.BackupPhaseNew ||
+		veleroBackup.Status.Phase == veleroapi.BackupPhaseInProgress
+}
+
+// returns true if the restore stopped because its velero restores running for longer than their timeout
+// were deleted; the timed out velero restores which are only reported can still complete, and the restore
+// reports their phase again
+func isRestoreTimedOut(restore *v1beta1.Restore) bool {
+	return restore.Spec.StuckRestorePolicy == v1beta1.StuckOperationPolicyDelete &&
+		restore.Status.Phase == v1beta1.RestorePhaseError &&
+		len(restore.Status.TimedOutVeleroRestores) > 0
+}
+
+// reports the velero restores running for longer than veleroRestoreTimeout and applies the stuck restore policy;
+// returns the names of the timed out velero restores and the time left before the next velero restore times out
+func (r *RestoreReconciler) checkStuckVeleroRestores(
+	ctx context.Context,
+	restore *v1beta1.Restore,
+	veleroRestoreList *veleroapi.RestoreList,
+) ([]string, time.Duration, error) {
+	restoreLogger := log.FromContext(ctx)
+
+	timeout := restore.Spec.VeleroRestoreTimeout
+	if !isVeleroTimeoutSet(timeout) {
+		return nil, 0, nil
+	}
+
+	now := time.Now()
+	timedOut := []string{}
+	nextCheck := time.Duration(0)
+	for i := range veleroRestoreList.Items {
+		veleroRestore := &veleroRestoreList.Items[i]
+		// a velero restore not processed by velero yet has no phase
+		if veleroRestore.Status.Phase != "" && !isVeleroRestoreRunning(veleroRestore) {
+			continue
+		}
+		timeLeft := getVeleroOperationTimeLeft(
+			veleroRestore.CreationTimestamp,
+			veleroRestore.Status.StartTimestamp,
+			timeout,
+			now,
+		)
+		if timeLeft > 0 {
+			if nextCheck == 0 || timeLeft < nextCheck {
+				nextCheck = timeLeft
+			}
+			continue
+		}
+
+		restoreLogger.Info("velero restore timed out", "name", veleroRestore.Name, "timeout", timeout.Duration)
+		if err := handleStuckVeleroObject(
+			ctx,
+			r.Client,
+			veleroRestore,
+			timeout,
+			restore.Spec.StuckRestorePolicy,
+		); err != nil {
+			return nil, 0, err
+		}
+		timedOut = append(timedOut, veleroRestore.Name)
+		if !findValue(restore.Status.TimedOutVeleroRestores, veleroRestore.Name) {
+			restore.Status.TimedOutVeleroRestores = append(restore.Status.TimedOutVeleroRestores, veleroRestore.Name)
+			r.Recorder.Event(
+				restore,
+				corev1.EventTypeWarning,
+				"Velero restore timed out:",
+				fmt.Sprintf("%s has been running for more than %s", veleroRestore.Name, timeout.Duration),
+			)
+		}
+	}
+	return timedOut, nextCheck, nil
+}
+
+// reports the velero backups of the schedules running for longer than veleroBackupTimeout and applies
+// the stuck backup policy; returns the names of the timed out velero backups and the time left
+// before the next velero backup times out
+func (r *BackupScheduleReconciler) checkStuckVeleroBackups(
+	ctx context.Context,
+	backupSchedule *v1beta1.BackupSchedule,
+	schedules []veleroapi.Schedule,
+) ([]string, time.Duration, error) {
+	scheduleLogger := log.FromContext(ctx)
+
+	timeout := backupSchedule.Spec.VeleroBackupTimeout
+	if !isVeleroTimeoutSet(timeout) {
+		return nil, 0, nil
+	}
+
+	backups := &veleroapi.BackupList{}
+	if err := r.List(ctx, backups, client.InNamespace(backupSchedule.Namespace)); err != nil {
+		return nil, 0, err
+	}
+	scheduleNames := []string{}
+	for i := range schedules {
+		scheduleNames = append(scheduleNames, schedules[i].Name)
+	}
+
+	now := time.Now()
+	timedOut := []string{}
+	nextCheck := time.Duration(0)
+	for i := range backups.Items {
+		backup := &backups.Items[i]
+		if !isVeleroBackupRunning(backup) ||
+			!findValue(scheduleNames, backup.Labels[veleroapi.ScheduleNameLabel]) {
+			continue
+		}
+		timeLeft := getVeleroOperationTimeLeft(backup.CreationTimestamp, backup.Status.StartTimestamp, timeout, now)
+		if timeLeft > 0 {
+			if nextCheck == 0 || timeLeft < nextCheck {
+				nextCheck = timeLeft
+			}
+			continue
+		}
+
+		scheduleLogger.Info("velero backup timed out", "name", backup.Name, "timeout", timeout.Duration)
+		if err := handleStuckVeleroObject(ctx, r.Client, backup, timeout, backupSchedule.Spec.StuckBackupPolicy); err != nil {
+			return nil, 0, err
+		}
+		timedOut = append(timedOut, backup.Name)
+		if !findValue(backupSchedule.Status.TimedOutVeleroBackups, backup.Name) {
+			backupSchedule.Status.TimedOutVeleroBackups = append(backupSchedule.Status.TimedOutVeleroBackups, backup.Name)
+			if len(backupSchedule.Status.TimedOutVeleroBackups) > maxTimedOutVeleroBackups {
+				backupSchedule.Status.TimedOutVeleroBackups = backupSchedule.Status.TimedOutVeleroBackups[1:]
+			}
+			r.Recorder.Event(
+				backupSchedule,
+				corev1.EventTypeWarning,
+				"Velero backup timed out:",
+				fmt.Sprintf("%s has been running for more than %s", backup.Name, timeout.Duration),
+			)
+		}
+	}
+	return timedOut, nextCheck, nil
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/open-cluster-management/cluster-backup-operator/api/v1beta1"
+	veleroapi "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_getVeleroOperationTimeLeft(t *testing.T) {
+	now := time.Now()
+	timeout := &metav1.Duration{Duration: time.Hour}
+	created := metav1.Time{Time: now.Add(-90 * time.Minute)}
+
+	if timeLeft := getVeleroOperationTimeLeft(created, nil, timeout, now); timeLeft != -30*time.Minute {
+		t.Errorf("getVeleroOperationTimeLeft() = %s for a velero operation not started", timeLeft)
+	}
+	started := &metav1.Time{Time: now.Add(-15 * time.Minute)}
+	if timeLeft := getVeleroOperationTimeLeft(created, started, timeout, now); timeLeft != 45*time.Minute {
+		t.Errorf("getVeleroOperationTimeLeft() = %s for a started velero operation", timeLeft)
+	}
+}
+
+func Test_checkStuckVeleroRestores(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = veleroapi.AddToScheme(testScheme)
+
+	now := time.Now()
+	newVeleroRestore := func(name string, phase veleroapi.RestorePhase, startTime time.Time) *veleroapi.Restore {
+		return &veleroapi.Restore{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "velero-ns"},
+			Status: veleroapi.RestoreStatus{
+				Phase:          phase,
+				StartTimestamp: &metav1.Time{Time: startTime},
+			},
+		}
+	}
+	veleroRestores := []*veleroapi.Restore{
+		newVeleroRestore("stuck", veleroapi.RestorePhaseInProgress, now.Add(-2*time.Hour)),
+		newVeleroRestore("running", veleroapi.RestorePhaseInProgress, now.Add(-30*time.Minute)),
+		newVeleroRestore("completed", veleroapi.RestorePhaseCompleted, now.Add(-3*time.Hour)),
+	}
+
+	tests := []struct {
+		name        string
+		policy      v1beta1.StuckOperationPolicy
+		wantDeleted bool
+	}{
+		{
+			name:   "report",
+			policy: v1beta1.StuckOperationPolicyReport,
+		},
+		{
+			name:        "delete",
+			policy:      v1beta1.StuckOperationPolicyDelete,
+			wantDeleted: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(testScheme)
+			for _, veleroRestore := range veleroRestores {
+				builder = builder.WithObjects(veleroRestore.DeepCopy())
+			}
+			c := builder.Build()
+			veleroRestoreList := &veleroapi.RestoreList{}
+			if err := c.List(context.Background(), veleroRestoreList); err != nil {
+				t.Fatal(err)
+			}
+			r := &RestoreReconciler{Client: c, Recorder: record.NewFakeRecorder(10)}
+			restore := &v1beta1.Restore{Spec: v1beta1.RestoreSpec{
+				VeleroRestoreTimeout: &metav1.Duration{Duration: time.Hour},
+				StuckRestorePolicy:   tt.policy,
+			}}
+
+			timedOut, timeLeft, err := r.checkStuckVeleroRestores(context.Background(), restore, veleroRestoreList)
+			if err != nil {
+				t.Fatalf("checkStuckVeleroRestores() error = %v", err)
+			}
+			if len(timedOut) != 1 || timedOut[0] != "stuck" {
+				t.Errorf("checkStuckVeleroRestores() timed out = %v", timedOut)
+			}
+			if timeLeft <= 0 || timeLeft > 30*time.Minute {
+				t.Errorf("checkStuckVeleroRestores() time left = %s", timeLeft)
+			}
+			if len(restore.Status.TimedOutVeleroRestores) != 1 {
+				t.Errorf("checkStuckVeleroRestores() status = %v", restore.Status.TimedOutVeleroRestores)
+			}
+
+			stuck := &veleroapi.Restore{}
+			err = c.Get(context.Background(), types.NamespacedName{Namespace: "velero-ns", Name: "stuck"}, stuck)
+			if tt.wantDeleted {
+				if !k8serr.IsNotFound(err) {
+					t.Errorf("stuck velero restore not deleted: %v", err)
+				}
+				return
+			}
+			if err != nil || stuck.Annotations[timedOutAnnotation] != "1h0m0s" {
+				t.Errorf("stuck velero restore annotations = %v, error = %v", stuck.Annotations, err)
+			}
+		})
+	}
+}
+
+func Test_checkStuckVeleroBackups(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	_ = veleroapi.AddToScheme(testScheme)
+
+	newBackup := func(name, scheduleName string, creationTime time.Time) *veleroapi.Backup {
+		return &veleroapi.Backup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "velero-ns",
+				CreationTimestamp: metav1.Time{Time: creationTime},
+				Labels:            map[string]string{veleroapi.ScheduleNameLabel: scheduleName},
+			},
+			Status: veleroapi.BackupStatus{Phase: veleroapi.BackupPhaseNew},
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		newBackup("acm-resources-schedule-20210910181336", veleroScheduleNames[Resources], old),
+		newBackup("other-schedule-20210910181336", "other-schedule", old),
+	).Build()
+	r := &BackupScheduleReconciler{Client: c, Recorder: record.NewFakeRecorder(10)}
+
+	backupSchedule := &v1beta1.BackupSchedule{
+		ObjectMeta: metav1.ObjectMeta{Name: "schedule", Namespace: "velero-ns"},
+		Spec:       v1beta1.BackupScheduleSpec{VeleroBackupTimeout: &metav1.Duration{Duration: time.Hour}},
+	}
+	schedules := []veleroapi.Schedule{{ObjectMeta: metav1.ObjectMeta{Name: veleroScheduleNames[Resources]}}}
+
+	timedOut, _, err := r.checkStuckVeleroBackups(context.Background(), backupSchedule, schedules)
+	if err != nil {
+		t.Fatalf("checkStuckVeleroBackups() error = %v", err)
+	}
+	if len(timedOut) != 1 || timedOut[0] != "acm-resources-schedule-20210910181336" {
+		t.Errorf("checkStuckVeleroBackups() timed out = %v", timedOut)
+	}
+
+	// a timed out velero backup is reported once
+	if _, _, err := r.checkStuckVeleroBackups(context.Background(), backupSchedule, schedules); err != nil {
+		t.Fatalf("checkStuckVeleroBackups() error = %v", err)
+	}
+	if len(backupSchedule.Status.TimedOutVeleroBackups) != 1 {
+		t.Errorf("checkStuckVeleroBackups() status = %v", backupSchedule.Status.TimedOutVeleroBackups)
+	}
+
+	// the delete policy requests velero to delete the backup, instead of deleting the velero backup
+	backupSchedule.Spec.StuckBackupPolicy = v1beta1.StuckOperationPolicyDelete
+	if _, _, err := r.checkStuckVeleroBackups(context.Background(), backupSchedule, schedules); err != nil {
+		t.Fatalf("checkStuckVeleroBackups() error = %v", err)
+	}
+	backupName := types.NamespacedName{Namespace: "velero-ns", Name: "acm-resources-schedule-20210910181336"}
+	if err := c.Get(context.Background(), backupName, &veleroapi.Backup{}); err != nil {
+		t.Errorf("stuck velero backup deleted: %v", err)
+	}
+	request := &veleroapi.DeleteBackupRequest{}
+	if err := c.Get(context.Background(), backupName, request); err != nil || request.Spec.BackupName != backupName.Name {
+		t.Errorf("delete backup request = %v, error = %v", request.Spec, err)
+	}
+
+	// a request refused by velero while it was processing the backup is replaced
+	request.Status.Phase = veleroapi.DeleteBackupRequestPhaseProcessed
+	request.Status.Errors = []string{"backup is still in progress"}
+	if err := c.Update(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.checkStuckVeleroBackups(context.Background(), backupSchedule, schedules); err != nil {
+		t.Fatalf("checkStuckVeleroBackups() error = %v", err)
+	}
+	request = &veleroapi.DeleteBackupRequest{}
+	if err := c.Get(context.Background(), backupName, request); err != nil || request.Status.Phase != "" {
+		t.Errorf("delete backup request status = %v, error = %v", request.Status, err)
+	}
+
+	// no timeout set
+	backupSchedule.Spec.VeleroBackupTimeout = nil
+	if timedOut, _, _ := r.checkStuckVeleroBackups(context.Background(), backupSchedule, schedules); len(timedOut) != 0 {
+		t.Errorf("checkStuckVeleroBackups() timed out = %v without timeout", timedOut)
+	}
+}
+
+func Test_isRestoreTimedOut(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy v1beta1.StuckOperationPolicy
+		phase  v1beta1.RestorePhase
+		want   bool
+	}{
+		{
+			name:   "timed out velero restores deleted",
+			policy: v1beta1.StuckOperationPolicyDelete,
+			phase:  v1beta1.RestorePhaseError,
+			want:   true,
+		},
+		{
+			name:   "timed out velero restores reported",
+			policy: v1beta1.StuckOperationPolicyReport,
+			phase:  v1beta1.RestorePhaseError,
+			want:   false,
+		},
+		{
+			name:   "restore started again",
+			policy: v1beta1.StuckOperationPolicyDelete,
+			phase:  v1beta1.RestorePhaseStarted,
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restore := &v1beta1.Restore{
+				Spec: v1beta1.RestoreSpec{StuckRestorePolicy: tt.policy},
+				Status: v1beta1.RestoreStatus{
+					Phase:                  tt.phase,
+					TimedOutVeleroRestores: []string{"stuck"},
+				},
+			}
+			if got := isRestoreTimedOut(restore); got != tt.want {
+				t.Errorf("isRestoreTimedOut() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -290,10 +290,11 @@ var _ = BeforeSuite(func() {
 	Expect(mgr).NotTo(BeNil())
 
 	err = (&RestoreReconciler{
-		KubeClient: nil,
-		Client:     mgr.GetClient(),
-		Scheme:     mgr.GetScheme(),
-		Recorder:   mgr.GetEventRecorderFor("restore reconciler"),
+		KubeClient:      nil,
+		DiscoveryClient: fakeDiscovery,
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Recorder:        mgr.GetEventRecorderFor("restore reconciler"),
 	}).SetupWithManager(mgr)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -301,6 +302,14 @@ var _ = BeforeSuite(func() {
 		Client:          mgr.GetClient(),
 		DiscoveryClient: fakeDiscovery,
 		Scheme:          mgr.GetScheme(),
+		Recorder:        mgr.GetEventRecorderFor("BackupSchedule controller"),
+	}).SetupWithManager(mgr)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&HubFailoverReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("hub failover reconciler"),
 	}).SetupWithManager(mgr)
 	Expect(err).ToNot(HaveOccurred())
 
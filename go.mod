@@ -11,6 +11,7 @@ require (
 	github.com/openshift/api v0.0.0-20210521075222-e273a339932a //Openshift 4.6
 	github.com/openshift/hive/apis v0.0.0-20210915004009-18827f64c00e
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.11.0
 	github.com/robfig/cron/v3 v3.0.0
 	github.com/vmware-tanzu/velero v1.6.1
 	k8s.io/api v0.21.3
@@ -18,6 +19,7 @@ require (
 	k8s.io/client-go v12.0.0+incompatible
 	open-cluster-management.io/api v0.0.0-20210908005819-815ac23c7308
 	sigs.k8s.io/controller-runtime v0.9.1
+	sigs.k8s.io/yaml v1.2.0
 )
 
 require (
@@ -58,7 +60,6 @@ require (
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.1 // indirect
 	github.com/nxadm/tail v1.4.8 // indirect
-	github.com/prometheus/client_golang v1.11.0 // indirect
 	github.com/prometheus/client_model v0.2.0 // indirect
 	github.com/prometheus/common v0.26.0 // indirect
 	github.com/prometheus/procfs v0.6.0 // indirect
@@ -87,7 +88,6 @@ require (
 	k8s.io/kube-openapi v0.0.0-20210305001622-591a79e4bda7 // indirect
 	k8s.io/utils v0.0.0-20210527160623-6fdb442a123b // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.1.2 // indirect
-	sigs.k8s.io/yaml v1.2.0 // indirect
 )
 
 replace (
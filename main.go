@@ -31,12 +31,14 @@ import (
 	chnv1 "github.com/open-cluster-management/multicloud-operators-channel/pkg/apis/apps/v1"
 	ocinfrav1 "github.com/openshift/api/config/v1"
 	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	appsv1 "k8s.io/api/apps/v1"
 	certsv1 "k8s.io/api/certificates/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -70,6 +72,9 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var preflightChecks bool
+	var credentialsLabeling string
+	var credentialsLabelingReportNamespace string
 	flag.StringVar(
 		&metricsAddr,
 		"metrics-bind-address",
@@ -85,6 +90,17 @@ func main() {
 	flag.BoolVar(&enableLeaderElection, "leader-elect", true,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&preflightChecks, "preflight-checks", true,
+		"Verify velero, the storage location credentials, the hub CRDs and the operator permissions "+
+			"before creating velero schedules and restores.")
+	flag.StringVar(&credentialsLabeling, "credentials-labeling", string(controllers.CredentialsLabelingDisabled),
+		"Add the backup label to the secrets referenced by channels, cluster deployments and cluster pools: "+
+			"disabled, dry-run to only report the secrets to label, or enabled.")
+	flag.StringVar(
+		&credentialsLabelingReportNamespace,
+		"credentials-labeling-report-namespace",
+		os.Getenv("POD_NAMESPACE"),
+		"Namespace of the ConfigMap listing the secrets to label in dry-run mode, defaults to the operator namespace.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -100,6 +116,8 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "58497677.cluster.management.io",
+		// the resources paused by the backup schedules are only listed after the backups, don't cache them
+		ClientDisableCacheFor: []client.Object{&appsv1.Deployment{}, &appsv1.StatefulSet{}},
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -118,6 +136,8 @@ func main() {
 		Client:          mgr.GetClient(),
 		DiscoveryClient: dc,
 		Scheme:          mgr.GetScheme(),
+		Recorder:        mgr.GetEventRecorderFor("BackupSchedule controller"),
+		PreflightChecks: preflightChecks,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create Schedule controller")
 		os.Exit(1)
@@ -127,14 +147,45 @@ func main() {
 		kubeClient = nil
 	}
 	if err = (&controllers.RestoreReconciler{
-		Client:     mgr.GetClient(),
-		KubeClient: kubeClient,
-		Scheme:     mgr.GetScheme(),
-		Recorder:   mgr.GetEventRecorderFor("Restore controller"),
+		Client:          mgr.GetClient(),
+		KubeClient:      kubeClient,
+		DiscoveryClient: dc,
+		Scheme:          mgr.GetScheme(),
+		Recorder:        mgr.GetEventRecorderFor("Restore controller"),
+		PreflightChecks: preflightChecks,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create Restore controller")
 		os.Exit(1)
 	}
+	if err = (&controllers.HubFailoverReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("HubFailover controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create HubFailover controller")
+		os.Exit(1)
+	}
+	switch controllers.CredentialsLabelingMode(credentialsLabeling) {
+	case controllers.CredentialsLabelingDisabled:
+	case controllers.CredentialsLabelingDryRun, controllers.CredentialsLabelingEnabled:
+		dryRun := credentialsLabeling == string(controllers.CredentialsLabelingDryRun)
+		if dryRun && credentialsLabelingReportNamespace == "" {
+			setupLog.Error(nil, "credentials-labeling-report-namespace must be set in dry-run mode")
+			os.Exit(1)
+		}
+		if err = (&controllers.CredentialsLabelingReconciler{
+			Client:          mgr.GetClient(),
+			Recorder:        mgr.GetEventRecorderFor("CredentialsLabeling controller"),
+			DryRun:          dryRun,
+			ReportNamespace: credentialsLabelingReportNamespace,
+		}).SetupWithManager(mgr, dc); err != nil {
+			setupLog.Error(err, "unable to create CredentialsLabeling controller")
+			os.Exit(1)
+		}
+	default:
+		setupLog.Error(nil, "invalid credentials-labeling value", "value", credentialsLabeling)
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {